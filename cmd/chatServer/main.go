@@ -0,0 +1,181 @@
+package main
+
+import (
+	"chat_go/internal/app"
+	user_client "chat_go/internal/clients/user"
+	chat_config "chat_go/internal/config/chat"
+	chatmaker_config "chat_go/internal/config/chatmaker"
+	msg_config "chat_go/internal/config/msg"
+	user_config "chat_go/internal/config/user"
+	grpc_server "chat_go/internal/grpc-server"
+	http_server "chat_go/internal/http-server"
+	"chat_go/internal/http-server/handlers/health"
+	"chat_go/internal/lib/logger"
+	"chat_go/internal/lib/logger/sl"
+	"chat_go/internal/lib/metrics"
+	"chat_go/internal/lib/tracing"
+	chatmaker_service "chat_go/internal/services/chatmaker"
+	msg_service "chat_go/internal/services/msg"
+	user_service "chat_go/internal/services/user"
+	"chat_go/internal/storage/sqlite"
+	"context"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"google.golang.org/grpc"
+)
+
+// service is what every service in internal/services has.
+type service interface {
+	Routes(router chi.Router)
+	RegisterGRPC(srv *grpc.Server)
+}
+
+var known = []string{"user", "chatmaker", "msg"}
+
+func main() {
+	cfg := chat_config.MustLoad()
+
+	log := logger.New(cfg.Env)
+
+	for _, name := range cfg.Services {
+		if !slices.Contains(known, name) {
+			log.Error("unknown service: " + name + ", expected one of " + strings.Join(known, ", "))
+			os.Exit(1)
+		}
+	}
+
+	log.Info("chat server enabled on: "+cfg.Address, "services", cfg.Services)
+
+	stopTracing, err := tracing.Setup(context.Background(), "chatServer", cfg.Tracing)
+	if err != nil {
+		log.Error("failed to init tracing", sl.Err(err))
+		os.Exit(1)
+	}
+
+	storage, err := sqlite.New(cfg.StoragePath)
+	if err != nil {
+		log.Error("failed to init storage", sl.Err(err))
+		os.Exit(1)
+	}
+
+	var (
+		services []service
+		// accounts, remoteUsers and messages have workers or connections to
+		// close.
+		accounts    *user_service.Service
+		remoteUsers *user_client.Client
+		messages    *msg_service.Service
+	)
+
+	if slices.Contains(cfg.Services, "user") {
+		userCfg := user_config.MustLoadPath(cfg.Configs.User)
+
+		accounts, err = user_service.New(log, userCfg, storage)
+		if err != nil {
+			log.Error("failed to init user service", sl.Err(err))
+			os.Exit(1)
+		}
+		services = append(services, accounts)
+	}
+
+	if slices.Contains(cfg.Services, "chatmaker") {
+		chatmakerCfg := chatmaker_config.MustLoadPath(cfg.Configs.Chatmaker)
+
+		// With the user service in the same process the users are checked in
+		// the shared storage instead of over the network.
+		var users user_client.UserDirectory = user_client.NewLocal(storage)
+		if !slices.Contains(cfg.Services, "user") {
+			remoteUsers, err = chatmaker_service.NewUserDirectory(log, chatmakerCfg)
+			if err != nil {
+				log.Error("failed to init user service client", sl.Err(err))
+				os.Exit(1)
+			}
+			if err := chatmaker_service.CheckToken(context.Background(), remoteUsers); err != nil {
+				log.Error("user service rejected the token", sl.Err(err))
+				os.Exit(1)
+			}
+			users = remoteUsers
+		}
+
+		services = append(services, chatmaker_service.New(log, chatmakerCfg, storage, users))
+	}
+
+	if slices.Contains(cfg.Services, "msg") {
+		msgCfg := msg_config.MustLoadPath(cfg.Configs.Msg)
+
+		messages, err = msg_service.New(log, msgCfg, storage)
+		if err != nil {
+			log.Error("failed to init message service", sl.Err(err))
+			os.Exit(1)
+		}
+		services = append(services, messages)
+	}
+
+	router, err := http_server.NewRouter(log, cfg.TrustedProxies)
+	if err != nil {
+		log.Error("failed to init router", sl.Err(err))
+		os.Exit(1)
+	}
+
+	if err := metrics.RegisterDB(storage); err != nil {
+		log.Error("failed to init metrics", sl.Err(err))
+		os.Exit(1)
+	}
+	http_server.MetricsRoute(router)
+
+	for _, svc := range services {
+		svc.Routes(router)
+	}
+
+	srv := &http.Server{
+		Addr:         cfg.Address,
+		Handler:      router,
+		ReadTimeout:  cfg.HTTPServer.Timeout,
+		WriteTimeout: cfg.HTTPServer.Timeout,
+		IdleTimeout:  cfg.HTTPServer.IdleTimeout,
+	}
+
+	application := app.New(log, srv, app.Config{
+		ShutdownDelay:   cfg.HTTPServer.ShutdownDelay,
+		ShutdownTimeout: cfg.HTTPServer.ShutdownTimeout,
+	})
+	application.OnClose("tracing", stopTracing)
+	application.OnClose("storage", storage.Close)
+	if accounts != nil {
+		application.OnCloseContext("user service", accounts.Close)
+	}
+	if remoteUsers != nil {
+		application.OnClose("user service client", remoteUsers.Close)
+	}
+	if messages != nil {
+		application.OnCloseContext("message service", messages.Close)
+	}
+
+	checks := []health.Check{
+		{Name: "storage", Run: storage.Ping},
+		{Name: "migrations", Run: storage.CheckMigrations},
+	}
+	if remoteUsers != nil {
+		checks = append(checks, chatmaker_service.UserServiceCheck(remoteUsers))
+	}
+	http_server.HealthRoutes(router, log, application.Ready, checks...)
+
+	if cfg.GRPC.Address != "" {
+		gRPC := grpc_server.New(log, cfg.InternalAPI.Token)
+		for _, svc := range services {
+			svc.RegisterGRPC(gRPC)
+		}
+		application.ServeGRPC(gRPC, cfg.GRPC.Address)
+	}
+
+	if err := application.Run(); err != nil {
+		log.Error("server stopped", sl.Err(err))
+		os.Exit(1)
+	}
+
+	log.Info("server stopped")
+}
@@ -1,92 +1,99 @@
 package main
 
 import (
+	"chat_go/internal/app"
 	chatmaker_config "chat_go/internal/config/chatmaker"
-	chatmaker_handler "chat_go/internal/http-server/handlers/chatmaker"
-	authorization_middleware "chat_go/internal/http-server/middlewares/authorization"
-	mwLogger "chat_go/internal/http-server/middlewares/logger"
-	"chat_go/internal/lib/logger/handlers/slogpretty"
+	grpc_server "chat_go/internal/grpc-server"
+	http_server "chat_go/internal/http-server"
+	"chat_go/internal/http-server/handlers/health"
+	"chat_go/internal/lib/logger"
 	"chat_go/internal/lib/logger/sl"
+	"chat_go/internal/lib/metrics"
+	"chat_go/internal/lib/tracing"
+	chatmaker_service "chat_go/internal/services/chatmaker"
 	"chat_go/internal/storage/sqlite"
-	"log/slog"
+	"context"
 	"net/http"
 	"os"
-
-	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
-)
-
-const (
-	envLocal = "local"
-	envDev   = "dev"
-	envProd  = "prod"
 )
 
 func main() {
-
 	cfg := chatmaker_config.MustLoad()
 
-	log := setupLogger(cfg.Env)
+	log := logger.New(cfg.Env)
 
 	log.Info("chatmaker server enabled on: " + cfg.Address)
 
+	stopTracing, err := tracing.Setup(context.Background(), "chatmakerServer", cfg.Tracing)
+	if err != nil {
+		log.Error("failed to init tracing", sl.Err(err))
+		os.Exit(1)
+	}
+
 	storage, err := sqlite.New(cfg.StoragePath)
 	if err != nil {
 		log.Error("failed to init storage", sl.Err(err))
 		os.Exit(1)
 	}
 
-	router := chi.NewRouter()
-
-	router.Use(middleware.RequestID)
-	router.Use(middleware.Logger)
-	router.Use(mwLogger.New(log))
-	router.Use(middleware.Recoverer)
-	router.Use(middleware.URLFormat)
-
-	router.Group(func(r chi.Router) {
-		r.Use(authorization_middleware.AuthorizeJWTToken)
+	users, err := chatmaker_service.NewUserDirectory(log, cfg)
+	if err != nil {
+		log.Error("failed to init user service client", sl.Err(err))
+		os.Exit(1)
+	}
+	if err := chatmaker_service.CheckToken(context.Background(), users); err != nil {
+		log.Error("user service rejected the token", sl.Err(err))
+		os.Exit(1)
+	}
 
-		r.Post("/chat/make", chatmaker_handler.NewChatmakerHandler(log, storage))
-		r.Get("/chat/{chatName}/{ID}", chatmaker_handler.NewGetChatHandler(log, storage))
-	})
+	service := chatmaker_service.New(log, cfg, storage, users)
 
-		srv := &http.Server{
-		Addr: cfg.Address,
-		Handler: router,
-		ReadTimeout: cfg.HTTPServer.Timeout,
-		WriteTimeout: cfg.HTTPServer.Timeout,
-		IdleTimeout: cfg.HTTPServer.IdleTimeout,
+	router, err := http_server.NewRouter(log, cfg.TrustedProxies)
+	if err != nil {
+		log.Error("failed to init router", sl.Err(err))
+		os.Exit(1)
 	}
 
-	if err := srv.ListenAndServe(); err != nil {
-		log.Error("failed to start server")
+	if err := metrics.RegisterDB(storage); err != nil {
+		log.Error("failed to init metrics", sl.Err(err))
+		os.Exit(1)
 	}
-}
+	http_server.MetricsRoute(router)
 
-func setupLogger(env string) *slog.Logger {
-	var log *slog.Logger
+	service.Routes(router)
 
-	switch env {
-	case envLocal:
-		log = setupPrettySlog()
-	case envDev:
-		log = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
-	case envProd:
-		log = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	srv := &http.Server{
+		Addr:         cfg.Address,
+		Handler:      router,
+		ReadTimeout:  cfg.HTTPServer.Timeout,
+		WriteTimeout: cfg.HTTPServer.Timeout,
+		IdleTimeout:  cfg.HTTPServer.IdleTimeout,
 	}
 
-	return log
-}
-
-func setupPrettySlog() *slog.Logger {
-	opts := slogpretty.PrettyHandlerOptions{
-		SlogOpts: &slog.HandlerOptions{
-			Level: slog.LevelDebug,
-		},
+	application := app.New(log, srv, app.Config{
+		ShutdownDelay:   cfg.HTTPServer.ShutdownDelay,
+		ShutdownTimeout: cfg.HTTPServer.ShutdownTimeout,
+	})
+	application.OnClose("tracing", stopTracing)
+	application.OnClose("storage", storage.Close)
+	application.OnClose("user service client", users.Close)
+
+	http_server.HealthRoutes(router, log, application.Ready,
+		health.Check{Name: "storage", Run: storage.Ping},
+		health.Check{Name: "migrations", Run: storage.CheckMigrations},
+		chatmaker_service.UserServiceCheck(users),
+	)
+
+	if cfg.GRPC.Address != "" {
+		gRPC := grpc_server.New(log, cfg.InternalAPI.Token)
+		service.RegisterGRPC(gRPC)
+		application.ServeGRPC(gRPC, cfg.GRPC.Address)
 	}
 
-	handler := opts.NewPrettyHandler(os.Stdout)
+	if err := application.Run(); err != nil {
+		log.Error("server stopped", sl.Err(err))
+		os.Exit(1)
+	}
 
-	return slog.New(handler)
+	log.Info("server stopped")
 }
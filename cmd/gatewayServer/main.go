@@ -0,0 +1,105 @@
+package main
+
+import (
+	"chat_go/internal/app"
+	gateway_config "chat_go/internal/config/gateway"
+	"chat_go/internal/gateway"
+	http_server "chat_go/internal/http-server"
+	"chat_go/internal/http-server/handlers/health"
+	mwLogger "chat_go/internal/http-server/middlewares/logger"
+	"chat_go/internal/lib/logger"
+	"chat_go/internal/lib/logger/sl"
+	"chat_go/internal/lib/tracing"
+	"context"
+	"net/http"
+	"os"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/cors"
+)
+
+func main() {
+	cfg := gateway_config.MustLoad()
+
+	log := logger.New(cfg.Env)
+
+	log.Info("gateway enabled on: " + cfg.Address)
+
+	stopTracing, err := tracing.Setup(context.Background(), "gatewayServer", cfg.Tracing)
+	if err != nil {
+		log.Error("failed to init tracing", sl.Err(err))
+		os.Exit(1)
+	}
+
+	services := map[string]gateway.Service{}
+	for name, svc := range cfg.Services {
+		services[name] = gateway.Service{Instances: svc.Instances, HealthPath: svc.HealthPath}
+	}
+
+	var routes []gateway.Route
+	for _, r := range cfg.Routes {
+		routes = append(routes, gateway.Route{Methods: r.Methods, Path: r.Path, Service: r.Service, Public: r.Public})
+	}
+
+	gw, err := gateway.New(log, gateway.Config{
+		Services:       services,
+		Routes:         routes,
+		HealthInterval: cfg.Health.Interval,
+		HealthTimeout:  cfg.Health.Timeout,
+	})
+	if err != nil {
+		log.Error("failed to init gateway", sl.Err(err))
+		os.Exit(1)
+	}
+
+	ctx, stopHealth := context.WithCancel(context.Background())
+	go gw.CheckHealth(ctx)
+
+	router := chi.NewRouter()
+
+	router.Use(middleware.RequestID)
+	router.Use(tracing.Middleware())
+	router.Use(middleware.Logger)
+	router.Use(mwLogger.New(log))
+	router.Use(middleware.Recoverer)
+	router.Use(cors.Handler(cors.Options{
+		AllowedOrigins:   cfg.CORS.AllowedOrigins,
+		AllowedMethods:   []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete},
+		AllowedHeaders:   []string{"Content-Type", "Authorization", middleware.RequestIDHeader},
+		ExposedHeaders:   []string{middleware.RequestIDHeader, "Retry-After"},
+		AllowCredentials: true,
+		MaxAge:           cfg.CORS.MaxAge,
+	}))
+
+	router.Handle("/*", gw)
+
+	srv := &http.Server{
+		Addr:         cfg.Address,
+		Handler:      router,
+		ReadTimeout:  cfg.HTTPServer.Timeout,
+		WriteTimeout: cfg.HTTPServer.Timeout,
+		IdleTimeout:  cfg.HTTPServer.IdleTimeout,
+	}
+
+	application := app.New(log, srv, app.Config{
+		ShutdownDelay:   cfg.HTTPServer.ShutdownDelay,
+		ShutdownTimeout: cfg.HTTPServer.ShutdownTimeout,
+	})
+	application.OnClose("tracing", stopTracing)
+	application.OnClose("health checks", func() error {
+		stopHealth()
+		return nil
+	})
+
+	http_server.HealthRoutes(router, log, application.Ready,
+		health.Check{Name: "upstreams", Run: gw.CheckUpstreams},
+	)
+
+	if err := application.Run(); err != nil {
+		log.Error("server stopped", sl.Err(err))
+		os.Exit(1)
+	}
+
+	log.Info("server stopped")
+}
@@ -1,54 +1,60 @@
 package main
 
 import (
+	"chat_go/internal/app"
 	msg_config "chat_go/internal/config/msg"
-	"chat_go/internal/http-server/handlers/msg/write"
-	authorization_middleware "chat_go/internal/http-server/middlewares/authorization"
-	mwLogger "chat_go/internal/http-server/middlewares/logger"
-	"chat_go/internal/lib/logger/handlers/slogpretty"
+	grpc_server "chat_go/internal/grpc-server"
+	http_server "chat_go/internal/http-server"
+	"chat_go/internal/http-server/handlers/health"
+	"chat_go/internal/lib/logger"
 	"chat_go/internal/lib/logger/sl"
+	"chat_go/internal/lib/metrics"
+	"chat_go/internal/lib/tracing"
+	msg_service "chat_go/internal/services/msg"
 	"chat_go/internal/storage/sqlite"
-	"log/slog"
+	"context"
 	"net/http"
 	"os"
-
-	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
-)
-
-const (
-	envLocal = "local"
-	envDev   = "dev"
-	envProd  = "prod"
 )
 
 func main() {
 	cfg := msg_config.MustLoad()
 
-	log := setupLogger(cfg.Env)
+	log := logger.New(cfg.Env)
 
 	log.Info("message server enabled on: " + cfg.Address)
 
+	stopTracing, err := tracing.Setup(context.Background(), "msgServer", cfg.Tracing)
+	if err != nil {
+		log.Error("failed to init tracing", sl.Err(err))
+		os.Exit(1)
+	}
+
 	storage, err := sqlite.New(cfg.StoragePath)
 	if err != nil {
 		log.Error("failed to init storage", sl.Err(err))
 		os.Exit(1)
 	}
 
+	service, err := msg_service.New(log, cfg, storage)
+	if err != nil {
+		log.Error("failed to init message service", sl.Err(err))
+		os.Exit(1)
+	}
 
-	router := chi.NewRouter()
-
-	router.Use(middleware.RequestID)
-	router.Use(middleware.Logger)
-	router.Use(mwLogger.New(log))
-	router.Use(middleware.Recoverer)
-	router.Use(middleware.URLFormat)
+	router, err := http_server.NewRouter(log, cfg.TrustedProxies)
+	if err != nil {
+		log.Error("failed to init router", sl.Err(err))
+		os.Exit(1)
+	}
 
-	router.Group(func(r chi.Router) {
-		r.Use(authorization_middleware.AuthorizeJWTToken)
+	if err := metrics.RegisterDB(storage); err != nil {
+		log.Error("failed to init metrics", sl.Err(err))
+		os.Exit(1)
+	}
+	http_server.MetricsRoute(router)
 
-		r.Post("/chat/write", write.NewWriteMessagesHandler(log, storage))
-	})
+	service.Routes(router)
 
 	srv := &http.Server{
 		Addr:         cfg.Address,
@@ -58,34 +64,29 @@ func main() {
 		IdleTimeout:  cfg.HTTPServer.IdleTimeout,
 	}
 
-	if err := srv.ListenAndServe(); err != nil {
-		log.Error("failed to start server")
-	}
-}
-
-func setupLogger(env string) *slog.Logger {
-	var log *slog.Logger
-
-	switch env {
-	case envLocal:
-		log = setupPrettySlog()
-	case envDev:
-		log = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
-	case envProd:
-		log = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	application := app.New(log, srv, app.Config{
+		ShutdownDelay:   cfg.HTTPServer.ShutdownDelay,
+		ShutdownTimeout: cfg.HTTPServer.ShutdownTimeout,
+	})
+	application.OnClose("tracing", stopTracing)
+	application.OnClose("storage", storage.Close)
+	application.OnCloseContext("message service", service.Close)
+
+	http_server.HealthRoutes(router, log, application.Ready,
+		health.Check{Name: "storage", Run: storage.Ping},
+		health.Check{Name: "migrations", Run: storage.CheckMigrations},
+	)
+
+	if cfg.GRPC.Address != "" {
+		gRPC := grpc_server.New(log, cfg.InternalAPI.Token)
+		service.RegisterGRPC(gRPC)
+		application.ServeGRPC(gRPC, cfg.GRPC.Address)
 	}
 
-	return log
-}
-
-func setupPrettySlog() *slog.Logger {
-	opts := slogpretty.PrettyHandlerOptions{
-		SlogOpts: &slog.HandlerOptions{
-			Level: slog.LevelDebug,
-		},
+	if err := application.Run(); err != nil {
+		log.Error("server stopped", sl.Err(err))
+		os.Exit(1)
 	}
 
-	handler := opts.NewPrettyHandler(os.Stdout)
-
-	return slog.New(handler)
+	log.Info("server stopped")
 }
@@ -1,97 +1,92 @@
 package main
 
 import (
+	"chat_go/internal/app"
 	user_config "chat_go/internal/config/user"
-	login_handler "chat_go/internal/http-server/handlers/user/login"
-	profile_handler "chat_go/internal/http-server/handlers/user/profile"
-	"chat_go/internal/http-server/handlers/user/save"
-	authorization_middleware "chat_go/internal/http-server/middlewares/authorization"
-	mwLogger "chat_go/internal/http-server/middlewares/logger"
-	"chat_go/internal/lib/logger/handlers/slogpretty"
+	grpc_server "chat_go/internal/grpc-server"
+	http_server "chat_go/internal/http-server"
+	"chat_go/internal/http-server/handlers/health"
+	"chat_go/internal/lib/logger"
 	"chat_go/internal/lib/logger/sl"
+	"chat_go/internal/lib/metrics"
+	"chat_go/internal/lib/tracing"
+	user_service "chat_go/internal/services/user"
 	"chat_go/internal/storage/sqlite"
-	"log/slog"
+	"context"
 	"net/http"
 	"os"
-
-	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
-)
-
-const (
-	envLocal = "local"
-	envDev   = "dev"
-	envProd  = "prod"
 )
 
 func main() {
-
 	cfg := user_config.MustLoad()
 
-	log := setupLogger(cfg.Env)
+	log := logger.New(cfg.Env)
 
 	log.Info("user server enabled on: " + cfg.Address)
 
+	stopTracing, err := tracing.Setup(context.Background(), "userServer", cfg.Tracing)
+	if err != nil {
+		log.Error("failed to init tracing", sl.Err(err))
+		os.Exit(1)
+	}
+
 	storage, err := sqlite.New(cfg.StoragePath)
 	if err != nil {
 		log.Error("failed to init storage", sl.Err(err))
 		os.Exit(1)
 	}
 
+	service, err := user_service.New(log, cfg, storage)
+	if err != nil {
+		log.Error("failed to init user service", sl.Err(err))
+		os.Exit(1)
+	}
 
-	router := chi.NewRouter()
-
-	router.Use(middleware.RequestID)
-	router.Use(middleware.Logger)
-	router.Use(mwLogger.New(log))
-	router.Use(middleware.Recoverer)
-	router.Use(middleware.URLFormat)
-
-	router.Post("/chat/register", save_handler.NewSaveHandler(log, storage))
-	router.Post("/chat/login", login_handler.NewLoginHandler(log, storage))
+	router, err := http_server.NewRouter(log, cfg.TrustedProxies)
+	if err != nil {
+		log.Error("failed to init router", sl.Err(err))
+		os.Exit(1)
+	}
 
-	router.Group(func(r chi.Router) {
-		r.Use(authorization_middleware.AuthorizeJWTToken)
+	if err := metrics.RegisterDB(storage); err != nil {
+		log.Error("failed to init metrics", sl.Err(err))
+		os.Exit(1)
+	}
+	http_server.MetricsRoute(router)
 
-		r.Get("/chat/{username}", profile_handler.NewGetUserHandler(log, storage))
-	})
+	service.Routes(router)
 
 	srv := &http.Server{
-		Addr: cfg.Address,
-		Handler: router,
-		ReadTimeout: cfg.HTTPServer.Timeout,
+		Addr:         cfg.Address,
+		Handler:      router,
+		ReadTimeout:  cfg.HTTPServer.Timeout,
 		WriteTimeout: cfg.HTTPServer.Timeout,
-		IdleTimeout: cfg.HTTPServer.IdleTimeout,
-	}
-
-	if err := srv.ListenAndServe(); err != nil {
-		log.Error("failed to start server")
+		IdleTimeout:  cfg.HTTPServer.IdleTimeout,
 	}
-}
-
-func setupLogger(env string) *slog.Logger {
-	var log *slog.Logger
 
-	switch env {
-	case envLocal:
-		log = setupPrettySlog()
-	case envDev:
-		log = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
-	case envProd:
-		log = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	application := app.New(log, srv, app.Config{
+		ShutdownDelay:   cfg.HTTPServer.ShutdownDelay,
+		ShutdownTimeout: cfg.HTTPServer.ShutdownTimeout,
+	})
+	application.OnClose("tracing", stopTracing)
+	application.OnClose("storage", storage.Close)
+	application.OnCloseContext("user service", service.Close)
+
+	http_server.HealthRoutes(router, log, application.Ready,
+		health.Check{Name: "storage", Run: storage.Ping},
+		health.Check{Name: "migrations", Run: storage.CheckMigrations},
+	)
+
+	if cfg.GRPC.Address != "" {
+		gRPC := grpc_server.New(log, cfg.InternalAPI.Token)
+		service.RegisterGRPC(gRPC)
+		application.ServeGRPC(gRPC, cfg.GRPC.Address)
 	}
 
-	return log
-}
-
-func setupPrettySlog() *slog.Logger {
-	opts := slogpretty.PrettyHandlerOptions{
-		SlogOpts: &slog.HandlerOptions{
-			Level: slog.LevelDebug,
-		},
+	if err := application.Run(); err != nil {
+		log.Error("server stopped", sl.Err(err))
+		os.Exit(1)
 	}
 
-	handler := opts.NewPrettyHandler(os.Stdout)
-
-	return slog.New(handler)
+	log.Info("server stopped")
 }
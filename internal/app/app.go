@@ -0,0 +1,191 @@
+package app
+
+import (
+	"chat_go/internal/lib/logger/sl"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// Config says how the servers stop.
+type Config struct {
+	// ShutdownDelay is how long the servers keep serving, reporting not ready,
+	// after a signal, so the gateway can stop sending them requests.
+	ShutdownDelay time.Duration
+	// ShutdownTimeout is how long the requests in flight, and then the
+	// closers, get to finish.
+	ShutdownTimeout time.Duration
+}
+
+// App runs the HTTP and gRPC servers of a command until SIGINT or SIGTERM,
+// then drains them and closes everything registered with OnClose and
+// OnCloseContext.
+type App struct {
+	log   *slog.Logger
+	cfg   Config
+	srv   *http.Server
+	gRPC  *grpc.Server
+	gAddr string
+
+	closers []closer
+	ready   atomic.Bool
+}
+
+type closer struct {
+	name  string
+	close func(ctx context.Context) error
+}
+
+func New(log *slog.Logger, srv *http.Server, cfg Config) *App {
+	return &App{log: log, cfg: cfg, srv: srv}
+}
+
+// ServeGRPC makes Run serve srv on address as well.
+func (a *App) ServeGRPC(srv *grpc.Server, address string) {
+	a.gRPC, a.gAddr = srv, address
+}
+
+// OnClose registers fn to be called once the servers have stopped and the
+// requests in flight have returned. They are called in the reverse order, like
+// defers, so the storage, which is opened first, is closed last.
+//
+// When the requests don't return in time, or a closer fails, the closers left
+// are not called: what they close may still be in use.
+func (a *App) OnClose(name string, fn func() error) {
+	a.OnCloseContext(name, func(context.Context) error { return fn() })
+}
+
+// OnCloseContext is OnClose for a fn that waits for work of its own. ctx is
+// done once ShutdownTimeout, counted from the signal, is over.
+func (a *App) OnCloseContext(name string, fn func(ctx context.Context) error) {
+	a.closers = append(a.closers, closer{name: name, close: fn})
+}
+
+// Ready tells whether the servers take requests. It is false before they
+// listen and from the moment they are asked to stop.
+func (a *App) Ready() bool {
+	return a.ready.Load()
+}
+
+// Run serves until a signal comes or a server fails, then shuts down. The
+// error is the one of the failed server, a signal gives nil.
+func (a *App) Run() error {
+	const op = "app.Run"
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	errs := make(chan error, 2)
+
+	lis, err := net.Listen("tcp", a.srv.Addr)
+	if err != nil {
+		// Nothing has been served yet, so nothing can hold the closers up.
+		a.close(context.Background())
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	go func() {
+		if err := a.srv.Serve(lis); !errors.Is(err, http.ErrServerClosed) {
+			errs <- fmt.Errorf("%s: http: %w", op, err)
+		}
+	}()
+
+	if a.gRPC != nil {
+		gLis, err := net.Listen("tcp", a.gAddr)
+		if err != nil {
+			a.srv.Close()
+			a.close(context.Background())
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		a.log.Info("grpc server enabled on: " + a.gAddr)
+
+		go func() {
+			if err := a.gRPC.Serve(gLis); err != nil {
+				errs <- fmt.Errorf("%s: grpc: %w", op, err)
+			}
+		}()
+	}
+
+	a.ready.Store(true)
+
+	var runErr error
+	select {
+	case <-ctx.Done():
+		a.log.Info("shutting down")
+	case runErr = <-errs:
+		a.log.Error("server failed, shutting down", sl.Err(runErr))
+	}
+	stop()
+
+	a.ready.Store(false)
+
+	if runErr == nil && a.cfg.ShutdownDelay > 0 {
+		time.Sleep(a.cfg.ShutdownDelay)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), a.cfg.ShutdownTimeout)
+	defer cancel()
+
+	if a.shutdown(shutdownCtx) {
+		a.close(shutdownCtx)
+	} else {
+		a.log.Warn("requests are still running, leaving everything open")
+	}
+
+	return runErr
+}
+
+// shutdown stops both servers, waiting for the requests in flight until ctx
+// is done. It tells whether they all returned.
+func (a *App) shutdown(ctx context.Context) (drained bool) {
+	drained = true
+
+	if a.gRPC != nil {
+		stopped := make(chan struct{})
+		go func() {
+			a.gRPC.GracefulStop()
+			close(stopped)
+		}()
+		defer func() {
+			select {
+			case <-stopped:
+			case <-ctx.Done():
+				a.log.Warn("grpc calls didn't finish in time")
+				a.gRPC.Stop()
+				drained = false
+			}
+		}()
+	}
+
+	if err := a.srv.Shutdown(ctx); err != nil {
+		a.log.Warn("http requests didn't finish in time", sl.Err(err))
+		// Close doesn't wait for the handlers, they may still be running.
+		a.srv.Close()
+		drained = false
+	}
+
+	return drained
+}
+
+func (a *App) close(ctx context.Context) {
+	for i := len(a.closers) - 1; i >= 0; i-- {
+		c := a.closers[i]
+		if err := c.close(ctx); err != nil {
+			// The closers registered before c may be used by what c failed
+			// to stop.
+			a.log.Error("failed to close "+c.name+", leaving the rest open", sl.Err(err))
+			return
+		}
+		a.log.Debug("closed " + c.name)
+	}
+}
@@ -0,0 +1,31 @@
+package user_client
+
+import (
+	"context"
+	"fmt"
+)
+
+type UserChecker interface {
+	MissingUsers(ctx context.Context, usernames []string) ([]string, error)
+}
+
+// Local is a UserDirectory for when the user service runs in the same process
+// and shares the storage, so there is nothing to call.
+type Local struct {
+	users UserChecker
+}
+
+func NewLocal(users UserChecker) *Local {
+	return &Local{users: users}
+}
+
+func (l *Local) ExistUsers(ctx context.Context, usernames []string) ([]string, error) {
+	const op = "clients.user.Local.ExistUsers"
+
+	missing, err := l.users.MissingUsers(ctx, usernames)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return missing, nil
+}
@@ -0,0 +1,296 @@
+package user_client
+
+import (
+	"bytes"
+	"chat_go/internal/grpc-server/gen/chatv1"
+	"chat_go/internal/lib/api/response"
+	"chat_go/internal/lib/tracing"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// batchSize is how many usernames userServer checks in one request.
+const batchSize = 200
+
+// ErrUnavailable means the user service couldn't be reached, or that the
+// circuit breaker is open after earlier failures.
+var ErrUnavailable = errors.New("user service unavailable")
+
+// ErrUnauthorized means userServer rejected the service token. It is a
+// configuration error, retrying doesn't help.
+var ErrUnauthorized = errors.New("user service rejected the service token, check user_service.token")
+
+// UserDirectory answers questions about accounts that live in userServer.
+type UserDirectory interface {
+	// ExistUsers returns the usernames that have no account.
+	ExistUsers(ctx context.Context, usernames []string) ([]string, error)
+}
+
+type Config struct {
+	BaseURL string
+	// GRPCAddress is the gRPC address of userServer. When it is set, calls go
+	// over gRPC instead of HTTP.
+	GRPCAddress string
+	// Token authenticates this service to userServer.
+	Token   string
+	Timeout time.Duration
+	// Retries is how many times a failed call is repeated, RetryDelay is the
+	// wait before the first retry and doubles after every one.
+	Retries    int
+	RetryDelay time.Duration
+	// After BreakerThreshold failed calls in a row the client stops calling
+	// for BreakerCooldown.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
+// Client is a UserDirectory that talks to userServer over HTTP or gRPC.
+type Client struct {
+	cfg     Config
+	http    *http.Client
+	conn    *grpc.ClientConn
+	users   chatv1.UserServiceClient
+	breaker *breaker
+}
+
+func New(cfg Config) (*Client, error) {
+	const op = "clients.user.New"
+
+	c := &Client{
+		cfg:  cfg,
+		http: &http.Client{Timeout: cfg.Timeout, Transport: tracing.Transport(http.DefaultTransport)},
+		breaker: &breaker{
+			threshold: max(cfg.BreakerThreshold, 1),
+			cooldown:  cfg.BreakerCooldown,
+		},
+	}
+
+	if cfg.GRPCAddress != "" {
+		conn, err := grpc.NewClient(cfg.GRPCAddress,
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithPerRPCCredentials(tokenCredentials(cfg.Token)),
+			grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		c.conn = conn
+		c.users = chatv1.NewUserServiceClient(conn)
+	}
+
+	return c, nil
+}
+
+// Close closes the gRPC connection, if there is one.
+func (c *Client) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+
+	return c.conn.Close()
+}
+
+type existRequest struct {
+	Usernames []string `json:"Usernames"`
+}
+
+type existResponse struct {
+	Missing []string `json:"missing"`
+}
+
+func (c *Client) ExistUsers(ctx context.Context, usernames []string) ([]string, error) {
+	const op = "clients.user.ExistUsers"
+
+	var missing []string
+
+	for start := 0; start < len(usernames); start += batchSize {
+		batch := usernames[start:min(start+batchSize, len(usernames))]
+
+		err := c.retry(ctx, func() (bool, error) {
+			if c.users != nil {
+				callCtx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+				defer cancel()
+
+				resp, err := c.users.ExistUsers(callCtx, &chatv1.ExistUsersRequest{Usernames: batch})
+				if err != nil {
+					return retryable(ctx, err), grpcError(err)
+				}
+
+				missing = append(missing, resp.GetMissing()...)
+				return false, nil
+			}
+
+			var resp existResponse
+			retry, err := c.post(ctx, "/internal/users/exist", existRequest{Usernames: batch}, &resp)
+			if err == nil {
+				missing = append(missing, resp.Missing...)
+			}
+			return retry, err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return missing, nil
+}
+
+// Ping checks that userServer answers. It makes a single call, without
+// retries and without the circuit breaker, so it reports the service as it is
+// right now.
+func (c *Client) Ping(ctx context.Context) error {
+	const op = "clients.user.Ping"
+
+	var err error
+	if c.users != nil {
+		callCtx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+		defer cancel()
+
+		_, err = c.users.ExistUsers(callCtx, &chatv1.ExistUsersRequest{})
+		err = grpcError(err)
+	} else {
+		_, err = c.post(ctx, "/internal/users/exist", existRequest{Usernames: []string{}}, &existResponse{})
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// retry runs call until it succeeds, fails for good or runs out of retries.
+// call reports whether its failure is worth retrying.
+//
+// The breaker counts calls, not attempts: a call that fails after all its
+// retries is one failure. A call that gets an answer, even a 4xx one, shows
+// that the service is up. A canceled call says nothing either way.
+func (c *Client) retry(ctx context.Context, call func() (bool, error)) error {
+	if !c.breaker.allow() {
+		return ErrUnavailable
+	}
+
+	delay := c.cfg.RetryDelay
+
+	for attempt := 0; ; attempt++ {
+		retry, err := call()
+		if err != nil && ctx.Err() != nil {
+			c.breaker.release()
+			return err
+		}
+		if !retry {
+			c.breaker.success()
+			return err
+		}
+
+		if attempt >= c.cfg.Retries {
+			c.breaker.failure()
+			return fmt.Errorf("%w: %w", ErrUnavailable, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			c.breaker.release()
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// post sends in as JSON to path and decodes the answer into out. It reports
+// whether the call is worth retrying: network errors and 5xx answers are.
+func (c *Client) post(ctx context.Context, path string, in any, out any) (bool, error) {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(c.cfg.BaseURL, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.cfg.Token)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		// A canceled request says nothing about the health of the service.
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		io.Copy(io.Discard, resp.Body)
+		return true, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		io.Copy(io.Discard, resp.Body)
+		return false, fmt.Errorf("%w: status %s", ErrUnauthorized, resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		var errResp response.ErrorResponse
+		if json.Unmarshal(msg, &errResp) == nil && errResp.Error.Message != "" {
+			return false, fmt.Errorf("unexpected status %s: %s: %s", resp.Status, errResp.Error.Code, errResp.Error.Message)
+		}
+		return false, fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return false, fmt.Errorf("decode response: %w", err)
+	}
+
+	return false, nil
+}
+
+// retryable reports whether a failed gRPC call is worth retrying.
+func retryable(ctx context.Context, err error) bool {
+	// A canceled call says nothing about the health of the service.
+	if ctx.Err() != nil {
+		return false
+	}
+
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Internal, codes.ResourceExhausted:
+		return true
+	}
+
+	return false
+}
+
+// grpcError marks a rejected service token with ErrUnauthorized.
+func grpcError(err error) error {
+	switch status.Code(err) {
+	case codes.Unauthenticated, codes.PermissionDenied:
+		return fmt.Errorf("%w: %w", ErrUnauthorized, err)
+	}
+
+	return err
+}
+
+// tokenCredentials sends the service token with every gRPC call.
+type tokenCredentials string
+
+func (t tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+func (t tokenCredentials) RequireTransportSecurity() bool {
+	return false
+}
@@ -0,0 +1,105 @@
+package user_client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	c, err := New(Config{
+		BaseURL:          srv.URL,
+		Token:            "token",
+		Timeout:          time.Second,
+		Retries:          2,
+		RetryDelay:       time.Millisecond,
+		BreakerThreshold: 2,
+		BreakerCooldown:  time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	return c
+}
+
+func TestBreakerCountsCallsNotAttempts(t *testing.T) {
+	var hits atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	if _, err := c.ExistUsers(context.Background(), []string{"@bob"}); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("first call: got %v, want ErrUnavailable", err)
+	}
+	if got := hits.Load(); got != 3 {
+		t.Fatalf("first call made %d attempts, want 3", got)
+	}
+	if c.breaker.failures != 1 {
+		t.Fatalf("one failed call counted as %d failures", c.breaker.failures)
+	}
+
+	c.ExistUsers(context.Background(), []string{"@bob"})
+
+	hits.Store(0)
+	if _, err := c.ExistUsers(context.Background(), []string{"@bob"}); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("open breaker: got %v, want ErrUnavailable", err)
+	}
+	if got := hits.Load(); got != 0 {
+		t.Fatalf("open breaker let %d attempts through", got)
+	}
+}
+
+func TestBreakerIgnoresCanceledProbe(t *testing.T) {
+	done := make(chan struct{})
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	})
+	t.Cleanup(func() { close(done) })
+
+	// Half open: the cooldown is over and the next call is a probe.
+	c.breaker.failures = c.breaker.threshold
+	c.breaker.openUntil = time.Now().Add(-time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := c.ExistUsers(ctx, []string{"@bob"}); err == nil {
+		t.Fatal("canceled probe succeeded")
+	}
+	if c.breaker.failures != c.breaker.threshold {
+		t.Fatalf("canceled probe changed the failures to %d", c.breaker.failures)
+	}
+	if c.breaker.probing {
+		t.Fatal("canceled probe still holds the probe")
+	}
+}
+
+func TestUnauthorizedIsNotRetried(t *testing.T) {
+	var hits atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+
+	if _, err := c.ExistUsers(context.Background(), []string{"@bob"}); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("got %v, want ErrUnauthorized", err)
+	}
+	if got := hits.Load(); got != 1 {
+		t.Fatalf("made %d attempts, want 1", got)
+	}
+}
@@ -0,0 +1,77 @@
+package chat_config
+
+import (
+	"chat_go/internal/lib/tracing"
+	"log"
+	"os"
+	"time"
+
+	"github.com/ilyakaznacheev/cleanenv"
+)
+
+// Config is the config of chatServer, which runs several services in one
+// process over one storage. Everything else about a service is read from its
+// own config file.
+type Config struct {
+	Env         string `yaml:"env" env-default:"local"`
+	StoragePath string `yaml:"storage_path" env-required:"./storage"`
+	HTTPServer  `yaml:"http_server"`
+	// Services are the services to run: user, chatmaker and msg.
+	Services    []string `yaml:"services" env:"CHAT_SERVICES" env-default:"user,chatmaker,msg"`
+	Configs     Configs  `yaml:"configs"`
+	InternalAPI `yaml:"internal_api"`
+	GRPC        GRPC           `yaml:"grpc"`
+	Tracing     tracing.Config `yaml:"tracing"`
+}
+
+type HTTPServer struct {
+	Address     string        `yaml:"address" env-default:"localhost:8084"`
+	Timeout     time.Duration `yaml:"timeout" env-default:"4s"`
+	IdleTimeout time.Duration `yaml:"idle_timeout" env-default:"60s"`
+	// ShutdownDelay is how long the server keeps serving after SIGINT or
+	// SIGTERM while reporting not ready, so the gateway stops sending requests.
+	ShutdownDelay time.Duration `yaml:"shutdown_delay" env-default:"0s"`
+	// ShutdownTimeout is how long the requests in flight, and then the
+	// workers, get to finish.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env-default:"10s"`
+	// TrustedProxies are the networks of the proxies in front of the server,
+	// like the gateway. Their X-Forwarded-For header tells the client address.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+// Configs are the paths to the config files of the services.
+type Configs struct {
+	User      string `yaml:"user" env-default:"./config/user/local.yaml"`
+	Chatmaker string `yaml:"chatmaker" env-default:"./config/chatmaker/local.yaml"`
+	Msg       string `yaml:"msg" env-default:"./config/msg/local.yaml"`
+}
+
+// InternalAPI is the token the other services must send to the gRPC server.
+type InternalAPI struct {
+	Token string `yaml:"token" env:"INTERNAL_API_TOKEN"`
+}
+
+// GRPC serves the internal API of the services that run. An empty address
+// turns it off.
+type GRPC struct {
+	Address string `yaml:"address" env-default:"localhost:9084"`
+}
+
+func MustLoad() *Config {
+	configPath := os.Getenv("CONFIG_PATH")
+	if configPath == "" {
+		configPath = "./config/chat/local.yaml"
+	}
+
+	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+		log.Fatalf("config file does not exist: %s", configPath)
+	}
+
+	var cfg Config
+
+	if err := cleanenv.ReadConfig(configPath, &cfg); err != nil {
+		log.Fatalf("cannot read config: %s", err)
+	}
+
+	return &cfg
+}
@@ -1,6 +1,7 @@
 package chatmaker_config
 
 import (
+	"chat_go/internal/lib/tracing"
 	"log"
 	"os"
 	"time"
@@ -12,12 +13,61 @@ type Config struct {
 	Env         string `yaml:"env" env-default:"local"`
 	StoragePath string `yaml:"storage_path" env-required:"./storage"`
 	HTTPServer  `yaml:"http_server"`
+	Pins        `yaml:"pins"`
+	Attachments `yaml:"attachments"`
+	UserService `yaml:"user_service"`
+	InternalAPI `yaml:"internal_api"`
+	GRPC        GRPC           `yaml:"grpc"`
+	Tracing     tracing.Config `yaml:"tracing"`
 }
 
 type HTTPServer struct {
 	Address     string        `yaml:"address" env-default:"localhost:8082"`
 	Timeout     time.Duration `yaml:"timeout" env-default:"4s"`
 	IdleTimeout time.Duration `yaml:"idle_timeout" env-default:"60s"`
+	// ShutdownDelay is how long the server keeps serving after SIGINT or
+	// SIGTERM while reporting not ready, so the gateway stops sending requests.
+	ShutdownDelay time.Duration `yaml:"shutdown_delay" env-default:"0s"`
+	// ShutdownTimeout is how long the requests in flight, and then the
+	// workers, get to finish.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env-default:"10s"`
+	// TrustedProxies are the networks of the proxies in front of the server,
+	// like the gateway. Their X-Forwarded-For header tells the client address.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+type Pins struct {
+	// Limit is how many messages can be pinned in one chat.
+	Limit int `yaml:"limit" env-default:"10"`
+}
+
+type Attachments struct {
+	// BaseURL is where msgServer can be reached, attachment URLs start with it.
+	BaseURL string `yaml:"base_url" env-default:"http://localhost:8081"`
+}
+
+// UserService is how userServer is reached. Token must match internal_api.token
+// of userServer.
+type UserService struct {
+	BaseURL          string        `yaml:"base_url" env-default:"http://localhost:8083"`
+	GRPCAddress      string        `yaml:"grpc_address"`
+	Token            string        `yaml:"token" env:"INTERNAL_API_TOKEN"`
+	Timeout          time.Duration `yaml:"timeout" env-default:"2s"`
+	Retries          int           `yaml:"retries" env-default:"2"`
+	RetryDelay       time.Duration `yaml:"retry_delay" env-default:"100ms"`
+	BreakerThreshold int           `yaml:"breaker_threshold" env-default:"5"`
+	BreakerCooldown  time.Duration `yaml:"breaker_cooldown" env-default:"30s"`
+}
+
+// InternalAPI is the token the other services must send to the gRPC server.
+type InternalAPI struct {
+	Token string `yaml:"token" env:"INTERNAL_API_TOKEN"`
+}
+
+// GRPC serves the internal API to the other services. An empty address turns
+// it off.
+type GRPC struct {
+	Address string `yaml:"address" env-default:"localhost:9082"`
 }
 
 func MustLoad() *Config{
@@ -26,6 +76,11 @@ func MustLoad() *Config{
 		configPath = "./config/chatmaker/local.yaml"
 	}
 
+	return MustLoadPath(configPath)
+}
+
+// MustLoadPath reads the config from configPath.
+func MustLoadPath(configPath string) *Config {
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
 		log.Fatalf("config file does not exist: %s", configPath)
 	}
@@ -0,0 +1,76 @@
+package gateway_config
+
+import (
+	"chat_go/internal/lib/tracing"
+	"log"
+	"os"
+	"time"
+
+	"github.com/ilyakaznacheev/cleanenv"
+)
+
+type Config struct {
+	Env        string `yaml:"env" env-default:"local"`
+	HTTPServer `yaml:"http_server"`
+	CORS       `yaml:"cors"`
+	Health     `yaml:"health"`
+	Services   map[string]Service `yaml:"services"`
+	Routes     []Route            `yaml:"routes"`
+	Tracing    tracing.Config     `yaml:"tracing"`
+}
+
+type HTTPServer struct {
+	Address     string        `yaml:"address" env-default:"localhost:8080"`
+	Timeout     time.Duration `yaml:"timeout" env-default:"10s"`
+	IdleTimeout time.Duration `yaml:"idle_timeout" env-default:"60s"`
+	// ShutdownDelay is how long the server keeps serving after SIGINT or
+	// SIGTERM while reporting not ready, so the gateway stops sending requests.
+	ShutdownDelay time.Duration `yaml:"shutdown_delay" env-default:"0s"`
+	// ShutdownTimeout is how long the requests in flight, and then the
+	// workers, get to finish.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env-default:"10s"`
+}
+
+// CORS lists the web origins that may call the API from a browser. Cookies
+// are allowed, so "*" can't be used.
+type CORS struct {
+	AllowedOrigins []string `yaml:"allowed_origins"`
+	MaxAge         int      `yaml:"max_age" env-default:"300"`
+}
+
+type Health struct {
+	Interval time.Duration `yaml:"interval" env-default:"5s"`
+	Timeout  time.Duration `yaml:"timeout" env-default:"1s"`
+}
+
+type Service struct {
+	Instances  []string `yaml:"instances"`
+	HealthPath string   `yaml:"health_path"`
+}
+
+// Route is matched in order, so more specific paths go first.
+type Route struct {
+	Methods []string `yaml:"methods"`
+	Path    string   `yaml:"path"`
+	Service string   `yaml:"service"`
+	Public  bool     `yaml:"public"`
+}
+
+func MustLoad() *Config {
+	configPath := os.Getenv("CONFIG_PATH")
+	if configPath == "" {
+		configPath = "./config/gateway/local.yaml"
+	}
+
+	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+		log.Fatalf("config file does not exist: %s", configPath)
+	}
+
+	var cfg Config
+
+	if err := cleanenv.ReadConfig(configPath, &cfg); err != nil {
+		log.Fatalf("cannot read config: %s", err)
+	}
+
+	return &cfg
+}
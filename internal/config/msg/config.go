@@ -1,6 +1,7 @@
 package msg_config
 
 import (
+	"chat_go/internal/lib/tracing"
 	"log"
 	"os"
 	"time"
@@ -12,12 +13,91 @@ type Config struct {
 	Env         string `yaml:"env" env-default:"local"`
 	StoragePath string `yaml:"storage_path" env-required:"./storage"`
 	HTTPServer  `yaml:"http_server"`
+	Notifier    `yaml:"notifier"`
+	Attachments `yaml:"attachments"`
+	InternalAPI `yaml:"internal_api"`
+	GRPC        GRPC           `yaml:"grpc"`
+	Tracing     tracing.Config `yaml:"tracing"`
 }
 
 type HTTPServer struct {
 	Address     string        `yaml:"address" env-default:"localhost:8081"`
 	Timeout     time.Duration `yaml:"timeout" env-default:"4s"`
 	IdleTimeout time.Duration `yaml:"idle_timeout" env-default:"60s"`
+	// ShutdownDelay is how long the server keeps serving after SIGINT or
+	// SIGTERM while reporting not ready, so the gateway stops sending requests.
+	ShutdownDelay time.Duration `yaml:"shutdown_delay" env-default:"0s"`
+	// ShutdownTimeout is how long the requests in flight, and then the
+	// workers, get to finish.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env-default:"10s"`
+	// TrustedProxies are the networks of the proxies in front of the server,
+	// like the gateway. Their X-Forwarded-For header tells the client address.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+// Notifier delivers mention notifications.
+type Notifier struct {
+	Kind     string `yaml:"kind" env-default:"log"`
+	FilePath string `yaml:"file_path"`
+	SMTP     SMTP   `yaml:"smtp"`
+	// Workers send the notifications, and at most QueueSize wait for one.
+	Workers   int `yaml:"workers" env-default:"4"`
+	QueueSize int `yaml:"queue_size" env-default:"256"`
+	// Timeout bounds the handling of one notification, SMTP included.
+	Timeout time.Duration `yaml:"timeout" env-default:"15s"`
+}
+
+type SMTP struct {
+	Address  string `yaml:"address"`
+	From     string `yaml:"from"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password" env:"SMTP_PASSWORD"`
+	// Timeout bounds the whole conversation with the server for one message.
+	Timeout time.Duration `yaml:"timeout" env-default:"10s"`
+}
+
+type Attachments struct {
+	// MaxSize is the largest file that can be uploaded, in bytes.
+	MaxSize      int64    `yaml:"max_size" env-default:"10485760"`
+	AllowedTypes []string `yaml:"allowed_types"`
+	// BaseURL is where this server can be reached, download URLs start with it.
+	BaseURL    string     `yaml:"base_url" env-default:"http://localhost:8081"`
+	Store      BlobStore  `yaml:"store"`
+	Thumbnails Thumbnails `yaml:"thumbnails"`
+}
+
+// Thumbnails are made for uploaded images by a pool of Workers. Uploads that
+// find the queue full are kept without thumbnails.
+type Thumbnails struct {
+	// Sizes are the longest sides of the thumbnails, in pixels.
+	Sizes     []int `yaml:"sizes" env-default:"160,320,640"`
+	Workers   int   `yaml:"workers" env-default:"2"`
+	QueueSize int   `yaml:"queue_size" env-default:"64"`
+}
+
+type BlobStore struct {
+	Kind string `yaml:"kind" env-default:"local"`
+	Dir  string `yaml:"dir" env-default:"./storage/blobs"`
+	S3   S3     `yaml:"s3"`
+}
+
+type S3 struct {
+	Endpoint  string `yaml:"endpoint"`
+	Region    string `yaml:"region"`
+	Bucket    string `yaml:"bucket"`
+	AccessKey string `yaml:"access_key" env:"S3_ACCESS_KEY"`
+	SecretKey string `yaml:"secret_key" env:"S3_SECRET_KEY"`
+}
+
+// InternalAPI is the token the other services must send to the gRPC server.
+type InternalAPI struct {
+	Token string `yaml:"token" env:"INTERNAL_API_TOKEN"`
+}
+
+// GRPC serves the internal API to the other services. An empty address turns
+// it off.
+type GRPC struct {
+	Address string `yaml:"address" env-default:"localhost:9081"`
 }
 
 func MustLoad() *Config{
@@ -26,6 +106,11 @@ func MustLoad() *Config{
 		configPath = "./config/msg/local.yaml"
 	}
 
+	return MustLoadPath(configPath)
+}
+
+// MustLoadPath reads the config from configPath.
+func MustLoadPath(configPath string) *Config {
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
 		log.Fatalf("config file does not exist: %s", configPath)
 	}
@@ -1,6 +1,7 @@
 package user_config
 
 import (
+	"chat_go/internal/lib/tracing"
 	"log"
 	"os"
 	"time"
@@ -9,23 +10,119 @@ import (
 )
 
 type Config struct {
-	Env         string `yaml:"env" env-default:"local"`
-	StoragePath string `yaml:"storage_path" env-required:"./storage"`
-	HTTPServer  `yaml:"http_server"`
+	Env            string `yaml:"env" env-default:"local"`
+	StoragePath    string `yaml:"storage_path" env-required:"./storage"`
+	HTTPServer     `yaml:"http_server"`
+	MFA            `yaml:"mfa"`
+	Lockout        `yaml:"lockout"`
+	Admin          `yaml:"admin"`
+	PasswordReset  `yaml:"password_reset"`
+	Notifier       `yaml:"notifier"`
+	PasswordPolicy `yaml:"password_policy"`
+	OIDC           `yaml:"oidc"`
+	InternalAPI    `yaml:"internal_api"`
+	GRPC           GRPC           `yaml:"grpc"`
+	Tracing        tracing.Config `yaml:"tracing"`
 }
 
 type HTTPServer struct {
 	Address     string        `yaml:"address" env-default:"localhost:8083"`
 	Timeout     time.Duration `yaml:"timeout" env-default:"4s"`
 	IdleTimeout time.Duration `yaml:"idle_timeout" env-default:"60s"`
+	// ShutdownDelay is how long the server keeps serving after SIGINT or
+	// SIGTERM while reporting not ready, so the gateway stops sending requests.
+	ShutdownDelay time.Duration `yaml:"shutdown_delay" env-default:"0s"`
+	// ShutdownTimeout is how long the requests in flight, and then the
+	// workers, get to finish.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env-default:"10s"`
+	// TrustedProxies are the networks of the proxies in front of the server,
+	// like the gateway. Their X-Forwarded-For header tells the client address.
+	TrustedProxies []string `yaml:"trusted_proxies"`
 }
 
-func MustLoad() *Config{
+type MFA struct {
+	Issuer            string `yaml:"issuer" env-default:"Chat"`
+	RecoveryCodeCount int    `yaml:"recovery_code_count" env-default:"10"`
+}
+
+type Lockout struct {
+	AccountMaxFailures int           `yaml:"account_max_failures" env-default:"5"`
+	IPMaxFailures      int           `yaml:"ip_max_failures" env-default:"20"`
+	BaseDelay          time.Duration `yaml:"base_delay" env-default:"1s"`
+	MaxDelay           time.Duration `yaml:"max_delay" env-default:"30s"`
+	Duration           time.Duration `yaml:"duration" env-default:"15m"`
+}
+
+type Admin struct {
+	// Bootstrap lists usernames that are made admins on startup, so the first
+	// admin can be created without touching the database.
+	Bootstrap []string `yaml:"bootstrap" env:"ADMIN_BOOTSTRAP" env-separator:","`
+}
+
+type PasswordReset struct {
+	TokenTTL time.Duration `yaml:"token_ttl" env-default:"30m"`
+}
+
+type Notifier struct {
+	Kind     string `yaml:"kind" env-default:"log"`
+	FilePath string `yaml:"file_path"`
+	SMTP     SMTP   `yaml:"smtp"`
+	// Workers send the notifications, and at most QueueSize wait for one.
+	Workers   int `yaml:"workers" env-default:"4"`
+	QueueSize int `yaml:"queue_size" env-default:"256"`
+	// Timeout bounds the handling of one notification, SMTP included.
+	Timeout time.Duration `yaml:"timeout" env-default:"15s"`
+}
+
+type SMTP struct {
+	Address  string `yaml:"address"`
+	From     string `yaml:"from"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password" env:"SMTP_PASSWORD"`
+	// Timeout bounds the whole conversation with the server for one message.
+	Timeout time.Duration `yaml:"timeout" env-default:"10s"`
+}
+
+type PasswordPolicy struct {
+	MinLength      int    `yaml:"min_length" env-default:"8"`
+	MaxLength      int    `yaml:"max_length" env-default:"128"`
+	BreachListPath string `yaml:"breach_list_path"`
+}
+
+type OIDC struct {
+	Issuer         string        `yaml:"issuer" env-default:"http://localhost:8083"`
+	SigningKeyPath string        `yaml:"signing_key_path" env:"OIDC_SIGNING_KEY_PATH"`
+	AccessTokenTTL time.Duration `yaml:"access_token_ttl" env-default:"15m"`
+	IDTokenTTL     time.Duration `yaml:"id_token_ttl" env-default:"15m"`
+	// LoginURL is the login page of the web client. A browser that opens the
+	// authorization endpoint without being logged in is sent there, with the
+	// URL to come back to in return_to. Without it the endpoint answers 401.
+	LoginURL string `yaml:"login_url" env:"OIDC_LOGIN_URL"`
+}
+
+// InternalAPI serves the other services over HTTP and gRPC. Without a token it
+// is turned off.
+type InternalAPI struct {
+	Token string `yaml:"token" env:"INTERNAL_API_TOKEN"`
+}
+
+// GRPC serves the internal API to the other services. An empty address turns
+// it off.
+type GRPC struct {
+	Address string `yaml:"address" env-default:"localhost:9083"`
+}
+
+func MustLoad() *Config {
 	configPath := os.Getenv("CONFIG_PATH")
 	if configPath == "" {
 		configPath = "./config/user/local.yaml"
 	}
 
+	return MustLoadPath(configPath)
+}
+
+// MustLoadPath reads the config from configPath.
+func MustLoadPath(configPath string) *Config {
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
 		log.Fatalf("config file does not exist: %s", configPath)
 	}
@@ -0,0 +1,158 @@
+package gateway
+
+import (
+	authorization_middleware "chat_go/internal/http-server/middlewares/authorization"
+	"chat_go/internal/lib/api/response"
+	"chat_go/internal/lib/logger/sl"
+	"chat_go/internal/lib/tracing"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+type Config struct {
+	Services map[string]Service
+	Routes   []Route
+	// Every HealthInterval each instance gets HealthTimeout to answer.
+	HealthInterval time.Duration
+	HealthTimeout  time.Duration
+}
+
+// Gateway is the single public entry point. It finds the route of a request,
+// checks the auth token unless the route is public, and proxies the request
+// to a healthy instance of the route's service.
+type Gateway struct {
+	log       *slog.Logger
+	cfg       Config
+	routes    []route
+	upstreams map[string]*upstream
+}
+
+func New(log *slog.Logger, cfg Config) (*Gateway, error) {
+	const op = "gateway.New"
+
+	g := &Gateway{
+		log:       log.With(slog.String("component", "gateway")),
+		cfg:       cfg,
+		upstreams: map[string]*upstream{},
+	}
+
+	for name, svc := range cfg.Services {
+		if len(svc.Instances) == 0 {
+			return nil, fmt.Errorf("%s: service %q has no instances", op, name)
+		}
+
+		u := &upstream{name: name, healthPath: svc.HealthPath}
+		for _, raw := range svc.Instances {
+			target, err := url.Parse(raw)
+			if err != nil || target.Scheme == "" || target.Host == "" {
+				return nil, fmt.Errorf("%s: service %q: invalid instance %q", op, name, raw)
+			}
+
+			inst := &instance{url: target}
+			inst.proxy = g.newProxy(name, inst)
+			inst.healthy.Store(true)
+			u.instances = append(u.instances, inst)
+		}
+		g.upstreams[name] = u
+	}
+
+	for _, r := range cfg.Routes {
+		rt, err := compileRoute(r)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if _, ok := g.upstreams[rt.Service]; !ok {
+			return nil, fmt.Errorf("%s: route %q: unknown service %q", op, rt.Path, rt.Service)
+		}
+		g.routes = append(g.routes, rt)
+	}
+
+	return g, nil
+}
+
+// CheckUpstreams returns an error when a service has no healthy instance
+// left, as the last health check found them.
+func (g *Gateway) CheckUpstreams(ctx context.Context) error {
+	const op = "gateway.CheckUpstreams"
+
+	var down []string
+	for name, u := range g.upstreams {
+		if !u.up() {
+			down = append(down, name)
+		}
+	}
+	if len(down) > 0 {
+		slices.Sort(down)
+		return fmt.Errorf("%s: no healthy instances of %s", op, strings.Join(down, ", "))
+	}
+
+	return nil
+}
+
+// CheckHealth keeps the health of the instances up to date until ctx is done.
+func (g *Gateway) CheckHealth(ctx context.Context) {
+	checkHealth(ctx, g.log, g.upstreams, g.cfg.HealthInterval, g.cfg.HealthTimeout)
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt, status := match(g.routes, r)
+	if status != http.StatusOK {
+		response.Error(w, r, status, http.StatusText(status))
+		return
+	}
+
+	proxy := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inst := g.upstreams[rt.Service].pick()
+		if inst == nil {
+			g.log.Error("no healthy instance", slog.String("service", rt.Service),
+				slog.String("request_id", middleware.GetReqID(r.Context())),
+				sl.TraceID(r.Context()),
+			)
+			response.Error(w, r, http.StatusServiceUnavailable, "Service is unavailable, try again later")
+			return
+		}
+
+		inst.proxy.ServeHTTP(w, r)
+	})
+
+	if rt.Public {
+		proxy.ServeHTTP(w, r)
+		return
+	}
+
+	authorization_middleware.AuthorizeJWTToken(proxy).ServeHTTP(w, r)
+}
+
+func (g *Gateway) newProxy(service string, inst *instance) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		// The trace of the request goes on to the service.
+		Transport: tracing.Transport(http.DefaultTransport),
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(inst.url)
+			pr.SetXForwarded()
+			pr.Out.Header.Set(middleware.RequestIDHeader, middleware.GetReqID(pr.In.Context()))
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			// The instance is taken out until the next health check finds
+			// it up again.
+			if r.Context().Err() == nil {
+				inst.healthy.Store(false)
+			}
+			g.log.Error("failed to reach upstream", sl.Err(err),
+				slog.String("service", service), slog.String("instance", inst.url.String()),
+				slog.String("request_id", middleware.GetReqID(r.Context())),
+				sl.TraceID(r.Context()),
+			)
+			response.Error(w, r, http.StatusBadGateway, "Bad gateway")
+		},
+	}
+}
@@ -0,0 +1,95 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Route sends the requests that match it to one of the instances of Service.
+type Route struct {
+	// Methods are the HTTP methods of the route, all of them when empty.
+	Methods []string
+	// Path is matched segment by segment. A segment in braces like {ID}
+	// matches any one segment, and a final * matches the rest of the path.
+	Path    string
+	Service string
+	// Public routes are proxied without an auth token. The others need a
+	// valid one before the request leaves the gateway.
+	Public bool
+}
+
+type route struct {
+	Route
+	segments []string
+	prefix   bool
+}
+
+func compileRoute(r Route) (route, error) {
+	if !strings.HasPrefix(r.Path, "/") {
+		return route{}, fmt.Errorf("route %q must start with /", r.Path)
+	}
+
+	segments := strings.Split(strings.TrimPrefix(r.Path, "/"), "/")
+	prefix := segments[len(segments)-1] == "*"
+	if prefix {
+		segments = segments[:len(segments)-1]
+	}
+	for _, s := range segments {
+		if strings.Contains(s, "*") {
+			return route{}, fmt.Errorf("route %q: * is only allowed at the end", r.Path)
+		}
+	}
+
+	methods := make([]string, len(r.Methods))
+	for i, m := range r.Methods {
+		methods[i] = strings.ToUpper(m)
+	}
+	r.Methods = methods
+
+	return route{Route: r, segments: segments, prefix: prefix}, nil
+}
+
+func (r route) matchPath(path string) bool {
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(segments) < len(r.segments) || (!r.prefix && len(segments) != len(r.segments)) {
+		return false
+	}
+
+	for i, s := range r.segments {
+		if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+			if segments[i] == "" {
+				return false
+			}
+			continue
+		}
+		if s != segments[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r route) matchMethod(method string) bool {
+	return len(r.Methods) == 0 || slices.Contains(r.Methods, method)
+}
+
+// match returns the first route that matches the request. The status is 404
+// when no route has the path and 405 when none of them has the method.
+func match(routes []route, r *http.Request) (route, int) {
+	status := http.StatusNotFound
+
+	for _, rt := range routes {
+		if !rt.matchPath(r.URL.Path) {
+			continue
+		}
+		if rt.matchMethod(r.Method) {
+			return rt, http.StatusOK
+		}
+		status = http.StatusMethodNotAllowed
+	}
+
+	return route{}, status
+}
@@ -0,0 +1,119 @@
+package gateway
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync/atomic"
+	"time"
+)
+
+// Service is a pool of instances that serve the same routes.
+type Service struct {
+	Instances []string
+	// HealthPath is requested on every instance to check its health. When it
+	// is empty, connecting to the instance is enough.
+	HealthPath string
+}
+
+type instance struct {
+	url     *url.URL
+	proxy   *httputil.ReverseProxy
+	healthy atomic.Bool
+}
+
+type upstream struct {
+	name       string
+	healthPath string
+	instances  []*instance
+	next       atomic.Uint64
+}
+
+// pick returns the next healthy instance, round robin, or nil when all of
+// them are down.
+func (u *upstream) pick() *instance {
+	n := uint64(len(u.instances))
+	start := u.next.Add(1)
+
+	for i := uint64(0); i < n; i++ {
+		inst := u.instances[(start+i)%n]
+		if inst.healthy.Load() {
+			return inst
+		}
+	}
+
+	return nil
+}
+
+// up reports whether any instance is healthy.
+func (u *upstream) up() bool {
+	for _, inst := range u.instances {
+		if inst.healthy.Load() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// check updates the health of every instance of the upstream.
+func (u *upstream) check(ctx context.Context, log *slog.Logger, client *http.Client) {
+	for _, inst := range u.instances {
+		healthy := u.probe(ctx, client, inst)
+		if inst.healthy.Swap(healthy) != healthy {
+			log.Warn("upstream health changed",
+				slog.String("service", u.name), slog.String("instance", inst.url.String()), slog.Bool("healthy", healthy),
+			)
+		}
+	}
+}
+
+func (u *upstream) probe(ctx context.Context, client *http.Client, inst *instance) bool {
+	if u.healthPath == "" {
+		var d net.Dialer
+		ctx, cancel := context.WithTimeout(ctx, client.Timeout)
+		defer cancel()
+
+		conn, err := d.DialContext(ctx, "tcp", inst.url.Host)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, inst.url.JoinPath(u.healthPath).String(), nil)
+	if err != nil {
+		return false
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode >= 200 && resp.StatusCode < 300
+}
+
+// checkHealth checks every upstream each interval until ctx is done.
+func checkHealth(ctx context.Context, log *slog.Logger, upstreams map[string]*upstream, interval time.Duration, timeout time.Duration) {
+	client := &http.Client{Timeout: timeout}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for _, u := range upstreams {
+			u.check(ctx, log, client)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
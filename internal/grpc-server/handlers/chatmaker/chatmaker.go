@@ -0,0 +1,56 @@
+package chatmaker_grpc
+
+import (
+	"chat_go/internal/grpc-server/gen/chatv1"
+	"chat_go/internal/lib/api/models"
+	"chat_go/internal/lib/logger/sl"
+	"chat_go/internal/storage"
+	"context"
+	"errors"
+	"log/slog"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type ChatStorage interface {
+	GetChatInfo(ctx context.Context, chatID int64) (models.ChatInfo, error)
+	GetChatRole(ctx context.Context, chatID int64, username string) (string, error)
+}
+
+type server struct {
+	chatv1.UnimplementedChatServiceServer
+	log   *slog.Logger
+	chats ChatStorage
+}
+
+func Register(gRPC *grpc.Server, log *slog.Logger, chats ChatStorage) {
+	chatv1.RegisterChatServiceServer(gRPC, &server{log: log, chats: chats})
+}
+
+func (s *server) GetMembership(ctx context.Context, req *chatv1.GetMembershipRequest) (*chatv1.GetMembershipResponse, error) {
+	const op = "grpc.chatmaker.GetMembership"
+
+	log := s.log.With(slog.String("op", op), sl.TraceID(ctx))
+
+	info, err := s.chats.GetChatInfo(ctx, req.GetChatId())
+	if errors.Is(err, storage.ErrChatNotFound) {
+		return nil, status.Error(codes.NotFound, "chat not found")
+	}
+	if err != nil {
+		log.Error("failed to get chat info", sl.Err(err))
+		return nil, status.Error(codes.Internal, "failed to get chat")
+	}
+
+	role, err := s.chats.GetChatRole(ctx, req.GetChatId(), req.GetUsername())
+	if errors.Is(err, storage.ErrNotChatMember) {
+		return &chatv1.GetMembershipResponse{Kind: info.Kind}, nil
+	}
+	if err != nil {
+		log.Error("failed to get chat role", sl.Err(err))
+		return nil, status.Error(codes.Internal, "failed to get chat role")
+	}
+
+	return &chatv1.GetMembershipResponse{Member: true, Role: role, Kind: info.Kind}, nil
+}
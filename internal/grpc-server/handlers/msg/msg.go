@@ -0,0 +1,79 @@
+package msg_grpc
+
+import (
+	"chat_go/internal/grpc-server/gen/chatv1"
+	"chat_go/internal/http-server/handlers/msg/write"
+	"chat_go/internal/lib/api/models"
+	"chat_go/internal/lib/chatrole"
+	"chat_go/internal/lib/logger/sl"
+	"chat_go/internal/lib/metrics"
+	"chat_go/internal/storage"
+	"context"
+	"errors"
+	"log/slog"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type MessageStorage interface {
+	GetChatInfo(ctx context.Context, chatID int64) (models.ChatInfo, error)
+	GetChatRole(ctx context.Context, chatID int64, username string) (string, error)
+	SaveMessage(ctx context.Context, sender string, chatName string, chatID int64, text string) (int64, error)
+	SaveMentions(ctx context.Context, chatID int64, messageID int64, usernames []string) ([]string, error)
+}
+
+type server struct {
+	chatv1.UnimplementedMessageServiceServer
+	log       *slog.Logger
+	messages  MessageStorage
+	publisher write.EventPublisher
+}
+
+func Register(gRPC *grpc.Server, log *slog.Logger, messages MessageStorage, publisher write.EventPublisher) {
+	chatv1.RegisterMessageServiceServer(gRPC, &server{log: log, messages: messages, publisher: publisher})
+}
+
+func (s *server) WriteMessage(ctx context.Context, req *chatv1.WriteMessageRequest) (*chatv1.WriteMessageResponse, error) {
+	const op = "grpc.msg.WriteMessage"
+
+	log := s.log.With(slog.String("op", op), sl.TraceID(ctx))
+
+	if req.GetSender() == "" || req.GetText() == "" {
+		return nil, status.Error(codes.InvalidArgument, "sender and text are required")
+	}
+
+	info, err := s.messages.GetChatInfo(ctx, req.GetChatId())
+	if errors.Is(err, storage.ErrChatNotFound) {
+		return nil, status.Error(codes.NotFound, "chat not found")
+	}
+	if err != nil {
+		log.Error("failed to get chat info", sl.Err(err))
+		return nil, status.Error(codes.Internal, "failed to write a message")
+	}
+
+	role, err := s.messages.GetChatRole(ctx, req.GetChatId(), req.GetSender())
+	if errors.Is(err, storage.ErrNotChatMember) {
+		return nil, status.Error(codes.PermissionDenied, "sender is not in this chat")
+	}
+	if err != nil {
+		log.Error("failed to get chat role", sl.Err(err))
+		return nil, status.Error(codes.Internal, "failed to write a message")
+	}
+	if info.Kind == models.ChatKindChannel && !chatrole.Role(role).Can(chatrole.Broadcast) {
+		return nil, status.Error(codes.PermissionDenied, "sender can't post in this channel")
+	}
+
+	id, err := s.messages.SaveMessage(ctx, req.GetSender(), info.Name, req.GetChatId(), req.GetText())
+	if err != nil {
+		log.Error("failed to write a message", sl.Err(err))
+		return nil, status.Error(codes.Internal, "failed to write a message")
+	}
+	metrics.MessageWritten()
+	log.Info("message added", slog.Int64("id", id))
+
+	write.NotifyMentions(ctx, log, s.messages, s.publisher, req.GetChatId(), info.Name, id, req.GetSender(), req.GetText())
+
+	return &chatv1.WriteMessageResponse{MessageId: id}, nil
+}
@@ -0,0 +1,68 @@
+package user_grpc
+
+import (
+	"chat_go/internal/grpc-server/gen/chatv1"
+	"chat_go/internal/lib/api/models"
+	"chat_go/internal/lib/logger/sl"
+	"chat_go/internal/storage"
+	"context"
+	"errors"
+	"log/slog"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxExistUsers matches the limit of POST /internal/users/exist.
+const maxExistUsers = 200
+
+type UserStorage interface {
+	MissingUsers(ctx context.Context, usernames []string) ([]string, error)
+	GetUser(ctx context.Context, username string) (models.User, error)
+}
+
+type server struct {
+	chatv1.UnimplementedUserServiceServer
+	log   *slog.Logger
+	users UserStorage
+}
+
+func Register(gRPC *grpc.Server, log *slog.Logger, users UserStorage) {
+	chatv1.RegisterUserServiceServer(gRPC, &server{log: log, users: users})
+}
+
+func (s *server) ExistUsers(ctx context.Context, req *chatv1.ExistUsersRequest) (*chatv1.ExistUsersResponse, error) {
+	const op = "grpc.user.ExistUsers"
+
+	if len(req.GetUsernames()) > maxExistUsers {
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d usernames can be checked at once", maxExistUsers)
+	}
+
+	missing, err := s.users.MissingUsers(ctx, req.GetUsernames())
+	if err != nil {
+		s.log.Error("failed to check users", slog.String("op", op), sl.Err(err))
+		return nil, status.Error(codes.Internal, "failed to check users")
+	}
+
+	return &chatv1.ExistUsersResponse{Missing: missing}, nil
+}
+
+func (s *server) GetUser(ctx context.Context, req *chatv1.GetUserRequest) (*chatv1.GetUserResponse, error) {
+	const op = "grpc.user.GetUser"
+
+	user, err := s.users.GetUser(ctx, req.GetUsername())
+	if errors.Is(err, storage.ErrUserNotFound) {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	if err != nil {
+		s.log.Error("failed to get user", slog.String("op", op), sl.Err(err))
+		return nil, status.Error(codes.Internal, "failed to get user")
+	}
+
+	return &chatv1.GetUserResponse{
+		Username: user.Username,
+		Nickname: user.Nickname,
+		Bio:      user.Bio,
+	}, nil
+}
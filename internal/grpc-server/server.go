@@ -0,0 +1,67 @@
+package grpc_server
+
+import (
+	"chat_go/internal/lib/logger/sl"
+	"context"
+	"crypto/subtle"
+	"log/slog"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// New returns a gRPC server for the internal API. Callers authenticate with
+// token as a bearer token in the "authorization" metadata, the same token the
+// HTTP internal endpoints take. An empty token rejects every call. Calls
+// continue the trace of the caller.
+//
+// The server has no TLS, so the token is sent in the clear: it must only be
+// reachable on a private network.
+func New(log *slog.Logger, token string) *grpc.Server {
+	return grpc.NewServer(
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(
+			logRequests(log.With(slog.String("component", "grpc/logger"))),
+			authenticate(token),
+		),
+	)
+}
+
+func authenticate(token string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+
+		var got string
+		if values := md.Get("authorization"); len(values) > 0 {
+			got, _ = strings.CutPrefix(values[0], "Bearer ")
+		}
+
+		if token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			return nil, status.Error(codes.Unauthenticated, "invalid service token")
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func logRequests(log *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		t1 := time.Now()
+
+		resp, err := handler(ctx, req)
+
+		log.Info("call completed",
+			slog.String("method", info.FullMethod),
+			slog.String("code", status.Code(err).String()),
+			slog.String("duration", time.Since(t1).String()),
+			sl.TraceID(ctx),
+		)
+
+		return resp, err
+	}
+}
@@ -0,0 +1,257 @@
+package grpc_server_test
+
+import (
+	grpc_server "chat_go/internal/grpc-server"
+	"chat_go/internal/grpc-server/gen/chatv1"
+	chatmaker_grpc "chat_go/internal/grpc-server/handlers/chatmaker"
+	msg_grpc "chat_go/internal/grpc-server/handlers/msg"
+	user_grpc "chat_go/internal/grpc-server/handlers/user"
+	"chat_go/internal/lib/api/models"
+	"chat_go/internal/lib/events"
+	"chat_go/internal/storage"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const token = "s3cret"
+
+type fakeStorage struct {
+	mu       sync.Mutex
+	users    []string
+	chats    map[int64]models.ChatInfo
+	roles    map[int64]map[string]string
+	messages []string
+	mentions []string
+}
+
+func (s *fakeStorage) MissingUsers(ctx context.Context, usernames []string) ([]string, error) {
+	var missing []string
+	for _, username := range usernames {
+		if !slices.Contains(s.users, username) {
+			missing = append(missing, username)
+		}
+	}
+	return missing, nil
+}
+
+func (s *fakeStorage) GetUser(ctx context.Context, username string) (models.User, error) {
+	if !slices.Contains(s.users, username) {
+		return models.User{}, storage.ErrUserNotFound
+	}
+	return models.User{Username: username}, nil
+}
+
+func (s *fakeStorage) GetChatInfo(ctx context.Context, chatID int64) (models.ChatInfo, error) {
+	info, ok := s.chats[chatID]
+	if !ok {
+		return models.ChatInfo{}, storage.ErrChatNotFound
+	}
+	return info, nil
+}
+
+func (s *fakeStorage) GetChatRole(ctx context.Context, chatID int64, username string) (string, error) {
+	role, ok := s.roles[chatID][username]
+	if !ok {
+		return "", storage.ErrNotChatMember
+	}
+	return role, nil
+}
+
+func (s *fakeStorage) SaveMessage(ctx context.Context, sender string, chatName string, chatID int64, text string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.messages = append(s.messages, text)
+	return int64(len(s.messages)), nil
+}
+
+func (s *fakeStorage) SaveMentions(ctx context.Context, chatID int64, messageID int64, usernames []string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.mentions = append(s.mentions, usernames...)
+	return usernames, nil
+}
+
+type fakePublisher struct {
+	mu     sync.Mutex
+	events []events.Event
+}
+
+func (p *fakePublisher) Publish(ctx context.Context, e events.Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.events = append(p.events, e)
+}
+
+// setup serves the three services over an in-memory connection, the way
+// the servers run them, and returns a connection to it.
+func setup(t *testing.T) (*grpc.ClientConn, *fakeStorage, *fakePublisher) {
+	t.Helper()
+
+	st := &fakeStorage{
+		users: []string{"@alice", "@bob"},
+		chats: map[int64]models.ChatInfo{
+			1: {ID: 1, Name: "group", Kind: models.ChatKindGroup},
+			2: {ID: 2, Name: "news", Kind: models.ChatKindChannel},
+		},
+		roles: map[int64]map[string]string{
+			1: {"@alice": "owner", "@bob": "member"},
+			2: {"@alice": "owner", "@bob": "member"},
+		},
+	}
+	pub := &fakePublisher{}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	srv := grpc_server.New(log, token)
+	user_grpc.Register(srv, log, st)
+	chatmaker_grpc.Register(srv, log, st)
+	msg_grpc.Register(srv, log, st, pub)
+
+	lis := bufconn.Listen(1 << 20)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn, st, pub
+}
+
+func withToken(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+func wantCode(t *testing.T, err error, want codes.Code) {
+	t.Helper()
+
+	if got := status.Code(err); got != want {
+		t.Fatalf("got code %s (%v), want %s", got, err, want)
+	}
+}
+
+func TestTokenIsRequired(t *testing.T) {
+	conn, _, _ := setup(t)
+
+	calls := map[string]func(ctx context.Context) error{
+		"ExistUsers": func(ctx context.Context) error {
+			_, err := chatv1.NewUserServiceClient(conn).ExistUsers(ctx, &chatv1.ExistUsersRequest{Usernames: []string{"@alice"}})
+			return err
+		},
+		"GetMembership": func(ctx context.Context) error {
+			_, err := chatv1.NewChatServiceClient(conn).GetMembership(ctx, &chatv1.GetMembershipRequest{ChatId: 1, Username: "@alice"})
+			return err
+		},
+		"WriteMessage": func(ctx context.Context) error {
+			_, err := chatv1.NewMessageServiceClient(conn).WriteMessage(ctx, &chatv1.WriteMessageRequest{ChatId: 1, Sender: "@alice", Text: "hi"})
+			return err
+		},
+	}
+
+	for name, call := range calls {
+		t.Run(name+"/missing", func(t *testing.T) {
+			wantCode(t, call(context.Background()), codes.Unauthenticated)
+		})
+		t.Run(name+"/wrong", func(t *testing.T) {
+			wantCode(t, call(withToken("wrong")), codes.Unauthenticated)
+		})
+		t.Run(name+"/right", func(t *testing.T) {
+			wantCode(t, call(withToken(token)), codes.OK)
+		})
+	}
+}
+
+func TestExistUsers(t *testing.T) {
+	conn, _, _ := setup(t)
+	client := chatv1.NewUserServiceClient(conn)
+
+	resp, err := client.ExistUsers(withToken(token), &chatv1.ExistUsersRequest{Usernames: []string{"@alice", "@carol", "@bob", "@dave"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := resp.GetMissing(), []string{"@carol", "@dave"}; !slices.Equal(got, want) {
+		t.Fatalf("missing = %v, want %v", got, want)
+	}
+
+	_, err = client.ExistUsers(withToken(token), &chatv1.ExistUsersRequest{Usernames: make([]string, 1001)})
+	wantCode(t, err, codes.InvalidArgument)
+}
+
+func TestGetMembership(t *testing.T) {
+	conn, _, _ := setup(t)
+	client := chatv1.NewChatServiceClient(conn)
+
+	resp, err := client.GetMembership(withToken(token), &chatv1.GetMembershipRequest{ChatId: 2, Username: "@bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.GetMember() || resp.GetRole() != "member" || resp.GetKind() != models.ChatKindChannel {
+		t.Fatalf("member: got %v", resp)
+	}
+
+	resp, err = client.GetMembership(withToken(token), &chatv1.GetMembershipRequest{ChatId: 1, Username: "@carol"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.GetMember() || resp.GetRole() != "" {
+		t.Fatalf("not a member: got %v", resp)
+	}
+
+	_, err = client.GetMembership(withToken(token), &chatv1.GetMembershipRequest{ChatId: 3, Username: "@alice"})
+	wantCode(t, err, codes.NotFound)
+}
+
+func TestWriteMessage(t *testing.T) {
+	conn, st, pub := setup(t)
+	client := chatv1.NewMessageServiceClient(conn)
+
+	resp, err := client.WriteMessage(withToken(token), &chatv1.WriteMessageRequest{ChatId: 1, Sender: "@bob", Text: "hi @alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.GetMessageId() != 1 || !slices.Equal(st.messages, []string{"hi @alice"}) {
+		t.Fatalf("got id %d, saved %v", resp.GetMessageId(), st.messages)
+	}
+	if !slices.Equal(st.mentions, []string{"@alice"}) || len(pub.events) != 1 {
+		t.Fatalf("mentions %v, events %v", st.mentions, pub.events)
+	}
+
+	tests := []struct {
+		name string
+		req  *chatv1.WriteMessageRequest
+		want codes.Code
+	}{
+		{"empty text", &chatv1.WriteMessageRequest{ChatId: 1, Sender: "@bob"}, codes.InvalidArgument},
+		{"unknown chat", &chatv1.WriteMessageRequest{ChatId: 3, Sender: "@bob", Text: "hi"}, codes.NotFound},
+		{"not a member", &chatv1.WriteMessageRequest{ChatId: 1, Sender: "@carol", Text: "hi"}, codes.PermissionDenied},
+		{"member of a channel", &chatv1.WriteMessageRequest{ChatId: 2, Sender: "@bob", Text: "hi"}, codes.PermissionDenied},
+		{"owner of a channel", &chatv1.WriteMessageRequest{ChatId: 2, Sender: "@alice", Text: "hi"}, codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.WriteMessage(withToken(token), tt.req)
+			wantCode(t, err, tt.want)
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package chatmaker_handler
+
+import (
+	"chat_go/internal/lib/api/models"
+	"chat_go/internal/lib/api/page"
+	"chat_go/internal/lib/api/response"
+	"chat_go/internal/lib/logger/sl"
+	"chat_go/internal/storage"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+type ChannelSearcher interface {
+	SearchChannels(ctx context.Context, query string, limit int, offset int) ([]models.Channel, error)
+}
+
+type ChannelJoiner interface {
+	JoinChannel(ctx context.Context, chatID int64, username string) (bool, error)
+}
+
+// NewSearchChannelsHandler lists public channels matching the q parameter,
+// with their subscriber counts.
+func NewSearchChannelsHandler(log *slog.Logger, searcher ChannelSearcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.chatmaker.SearchChannels"
+
+		log := log.With(slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		limit, offset, err := page.FromQuery(r)
+		if err != nil {
+			response.Error(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		channels, err := searcher.SearchChannels(r.Context(), r.URL.Query().Get("q"), limit, offset)
+		if err != nil {
+			log.Error("failed to search channels", sl.Err(err))
+			response.FromError(w, r, err, "Failed to search channels")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(channels)
+	}
+}
+
+// NewJoinChannelHandler subscribes the logged in user to a public channel. No
+// invite is needed, and joining twice is not an error.
+func NewJoinChannelHandler(log *slog.Logger, joiner ChannelJoiner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.chatmaker.JoinChannel"
+
+		log := log.With(slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		chatID, claims, ok := chatRequest(w, r)
+		if !ok {
+			return
+		}
+
+		joined, err := joiner.JoinChannel(r.Context(), chatID, claims.Username)
+		if errors.Is(err, storage.ErrChatNotFound) {
+			response.ErrorFor(w, r, err, "Public channel not found")
+			return
+		}
+		if err != nil {
+			log.Error("failed to join channel", sl.Err(err))
+			response.FromError(w, r, err, "Failed to join channel")
+			return
+		}
+
+		if joined {
+			log.Info("channel joined", slog.Int64("chat_id", chatID), slog.String("user", claims.Username))
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -1,16 +1,22 @@
 package chatmaker_handler
 
 import (
+	user_client "chat_go/internal/clients/user"
 	"chat_go/internal/lib/api/models"
-	val "chat_go/internal/lib/api/validation"
+	"chat_go/internal/lib/api/response"
+	"chat_go/internal/lib/jwts"
 	"chat_go/internal/lib/logger/sl"
+	"chat_go/internal/lib/metrics"
 	"chat_go/internal/storage"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
@@ -18,40 +24,90 @@ import (
 )
 
 type Request struct {
-	Name         string `json:"Name" validate:"required"`
-	Participants string `json:"Participants" validate:"required"`
+	Name string `json:"Name" validate:"required"`
+	// Participants is optional, people can also join later with an invite link.
+	Participants string `json:"Participants"`
+	// Kind is "group" by default. Only admins can post in a "channel".
+	Kind string `json:"Kind" validate:"omitempty,oneof=group channel"`
+	// Public channels can be found and joined by anyone.
+	Public bool `json:"Public"`
 }
 
 type ResponseMessages struct {
-	ID     int64  `json:"id"`
-	Sender string `json:"sender"`
-	Text   string `json:"text"`
+	ID          int64                `json:"id"`
+	Sender      string               `json:"sender"`
+	Text        string               `json:"text"`
+	Kind        string               `json:"kind"`
+	Attachments []ResponseAttachment `json:"attachments,omitempty"`
+}
+
+type ResponseAttachment struct {
+	ID          int64               `json:"id"`
+	Filename    string              `json:"filename"`
+	ContentType string              `json:"content_type"`
+	Size        int64               `json:"size"`
+	Width       int                 `json:"width,omitempty"`
+	Height      int                 `json:"height,omitempty"`
+	URL         string              `json:"url"`
+	Thumbnails  []ResponseThumbnail `json:"thumbnails,omitempty"`
+}
+
+type ResponseThumbnail struct {
+	Size   int    `json:"size"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	URL    string `json:"url"`
+}
+
+type ResponsePin struct {
+	MessageID int64     `json:"message_id"`
+	Sender    string    `json:"sender"`
+	Text      string    `json:"text"`
+	PinnedBy  string    `json:"pinned_by"`
+	PinnedAt  time.Time `json:"pinned_at"`
 }
 
 type ResponseData struct {
-	Name         string             `json:"name"`
-	Participants string             `json:"participants"`
-	RespMsg      []ResponseMessages `json:"messages"`
+	Name         string              `json:"name"`
+	Kind         string              `json:"kind"`
+	Public       bool                `json:"public"`
+	Description  string              `json:"description"`
+	Topic        string              `json:"topic"`
+	Avatar       string              `json:"avatar"`
+	CreatedBy    string              `json:"created_by"`
+	CreatedAt    *time.Time          `json:"created_at"`
+	Participants string              `json:"participants"`
+	MemberCount  int                 `json:"member_count"`
+	Members      []models.ChatMember `json:"members"`
+	Pins         []ResponsePin       `json:"pins"`
+	RespMsg      []ResponseMessages  `json:"messages"`
 }
 
 type ChatInteractor interface {
-	MakeChat(name, username string) (int64, error)
-	GetParticipantsByChatNameAndID(chatName string, id int64) (string, error)
-	GetSenderOfMessageByChatName(chatName string) (string, error)
-	GetAllMessagesByChatnameAndID(chatName string, id int64) ([]models.Message, error)
-	GetNicknameByUsername(username string) (string, error)
+	MakeChat(ctx context.Context, name string, kind string, public bool, owner string, members []string) (int64, error)
+	GetChatRole(ctx context.Context, chatID int64, username string) (string, error)
+	GetChatMembers(ctx context.Context, chatID int64) ([]models.ChatMember, error)
+	GetChatInfo(ctx context.Context, chatID int64) (models.ChatInfo, error)
+	GetPins(ctx context.Context, chatID int64) ([]models.Pin, error)
+	GetChatAttachments(ctx context.Context, chatID int64) ([]models.Attachment, error)
+	GetParticipantsByChatNameAndID(ctx context.Context, chatName string, id int64) (string, error)
+	GetSenderOfMessageByChatName(ctx context.Context, chatName string) (string, error)
+	GetAllMessagesByChatnameAndID(ctx context.Context, chatName string, id int64) ([]models.Message, error)
+	GetNicknameByUsername(ctx context.Context, username string) (string, error)
 }
 
-func NewChatmakerHandler(log *slog.Logger, ChatInteractor ChatInteractor) http.HandlerFunc {
+func NewChatmakerHandler(log *slog.Logger, ChatInteractor ChatInteractor, directory user_client.UserDirectory) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handlers.chatmaker.Chatmaker"
 
 		if r.Method != http.MethodPost {
-			http.Error(w, "Wrong method", http.StatusMethodNotAllowed)
+			response.Error(w, r, http.StatusMethodNotAllowed, "Wrong method")
+			return
 		}
 
-		log = log.With(slog.String("op", op),
+		log := log.With(slog.String("op", op),
 			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
 		)
 
 		var req Request
@@ -59,97 +115,89 @@ func NewChatmakerHandler(log *slog.Logger, ChatInteractor ChatInteractor) http.H
 		err := render.DecodeJSON(r.Body, &req)
 		if err != nil {
 			log.Error("failed to decode request body", sl.Err(err))
+			response.Error(w, r, http.StatusBadRequest, "Failed to decode request body")
 			return
 		}
 
 		if err := validator.New().Struct(req); err != nil {
 			validateErr := err.(validator.ValidationErrors)
 			log.Error("invalid request", sl.Err(err))
-			http.Error(w, val.ValidationError(validateErr), http.StatusBadRequest)
+			response.ValidationError(w, r, validateErr)
 			return
 		}
 
 		log.Info("request bosy decoded", slog.Any("request", req))
 
+		claims, ok := r.Context().Value("claims").(jwts.Claims)
+		if !ok {
+			response.Error(w, r, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		if req.Kind == "" {
+			req.Kind = models.ChatKindGroup
+		}
+		if req.Public && req.Kind != models.ChatKindChannel {
+			response.Error(w, r, http.StatusBadRequest, "Only channels can be public")
+			return
+		}
+
 		users := strings.ReplaceAll(req.Participants, " ", "")
-		listOfUsers := strings.Split(users, ",")
-		for _, user := range listOfUsers {
-			req, err := http.NewRequest("GET", "http://localhost:8083/chat/"+user, nil)
-			if err != nil {
-				log.Error("wrong url", sl.Err(err))
-				http.Error(w, "invalid url", http.StatusBadRequest)
-				return
-			}
-			cookie, err := r.Cookie("auth_token")
-			if err != nil {
-				log.Error("failed checking cookie", sl.Err(err))
-				http.Error(w, "failed checking your cookie", http.StatusInternalServerError)
-				return
-			}
-			tokenString := cookie.Value
-			req.AddCookie(&http.Cookie{
-				Name:     "auth_token",
-				Value:    tokenString,
-				Path:     "/",
-				SameSite: http.SameSiteNoneMode,
-				Secure:   true,
-			})
-			client := &http.Client{}
-			resp, err := client.Do(req)
-			if err != nil {
-				log.Error("failed to create a response while checking users", sl.Err(err))
-				http.Error(w, "failed to create a response while checking users", http.StatusInternalServerError)
-				return
-			}
-			if resp.StatusCode != http.StatusOK {
-				http.Error(w, "there are some non-existing users", http.StatusBadRequest)
-				return
-			}
+		var listOfUsers []string
+		if users != "" {
+			listOfUsers = strings.Split(users, ",")
 		}
-		if len(users) == 0 {
-			log.Error("no users in the chat")
-			http.Error(w, "no users in the chat", http.StatusConflict)
+		missing, ok := missingUsers(w, r, log, directory, listOfUsers)
+		if !ok {
 			return
-		} else {
-			id, err := ChatInteractor.MakeChat(req.Name, req.Participants)
-			if errors.Is(err, storage.ErrChatAlreadyExists) {
-				log.Info("chat already exists", slog.String("chat", req.Name))
-				http.Error(w, "chat already exists", http.StatusBadRequest)
-				return
-			}
-			if err != nil {
-				log.Error("failed to make chat", sl.Err(err))
-				http.Error(w, "Failed to make chat", http.StatusInternalServerError)
-				return
-			}
-			log.Info("chat added", slog.Int64("id", id))
+		}
+		if len(missing) > 0 {
+			unknownUsers(w, r, missing)
+			return
+		}
+		id, err := ChatInteractor.MakeChat(r.Context(), req.Name, req.Kind, req.Public, claims.Username, listOfUsers)
+		if errors.Is(err, storage.ErrChatAlreadyExists) {
+			log.Info("chat already exists", slog.String("chat", req.Name))
+			response.ErrorFor(w, r, err, "chat already exists")
+			return
+		}
+		if err != nil {
+			log.Error("failed to make chat", sl.Err(err))
+			response.FromError(w, r, err, "Failed to make chat")
+			return
+		}
+		metrics.ChatCreated(req.Kind)
+		log.Info("chat added", slog.Int64("id", id))
 
-			response1 := map[string]string{"You have successfully created a chat with this name:": req.Name}
-			json.NewEncoder(w).Encode(response1)
+		w.WriteHeader(http.StatusCreated)
 
-			response2 := map[string]int64{"Here is your chat`s ID:": id}
-			json.NewEncoder(w).Encode(response2)
+		response1 := map[string]string{"You have successfully created a chat with this name:": req.Name}
+		json.NewEncoder(w).Encode(response1)
 
-			w.WriteHeader(http.StatusCreated)
-		}
+		response2 := map[string]int64{"Here is your chat`s ID:": id}
+		json.NewEncoder(w).Encode(response2)
 	}
 }
 
-func NewGetChatHandler(log *slog.Logger, chatInteractor ChatInteractor) http.HandlerFunc {
+// NewGetChatHandler returns the chat with its messages. Attachment URLs start
+// with attachmentsURL, the address of the message server.
+func NewGetChatHandler(log *slog.Logger, chatInteractor ChatInteractor, attachmentsURL string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handlers.chatmaker.GetChat"
 
 		if r.Method != http.MethodGet {
-			http.Error(w, "Wrong method", http.StatusMethodNotAllowed)
+			response.Error(w, r, http.StatusMethodNotAllowed, "Wrong method")
+			return
 		}
 
-		log = log.With(slog.String("op", op),
+		log := log.With(slog.String("op", op),
 			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
 		)
 
 		pathValues := strings.Split(r.URL.Path, "/")
-		if len(pathValues) < 3 || pathValues[2] == "" {
-			http.Error(w, "Invalid URL format", http.StatusBadRequest)
+		if len(pathValues) < 4 || pathValues[2] == "" {
+			response.Error(w, r, http.StatusBadRequest, "Invalid URL format")
 			return
 		}
 		ChatName := pathValues[2]
@@ -158,29 +206,40 @@ func NewGetChatHandler(log *slog.Logger, chatInteractor ChatInteractor) http.Han
 		id, err := strconv.Atoi(ID)
 		if err != nil {
 			log.Error("failed to convert ID", sl.Err(err))
-			http.Error(w, "Failed to convert ID", http.StatusInternalServerError)
+			response.Error(w, r, http.StatusBadRequest, "Invalid chat ID")
 			return
 		}
 
-		participants, err := chatInteractor.GetParticipantsByChatNameAndID(ChatName, int64(id))
+		participants, err := chatInteractor.GetParticipantsByChatNameAndID(r.Context(), ChatName, int64(id))
 		if err != nil {
 			log.Error("failed to get participants of this chat", sl.Err(err))
-			http.Error(w, "Failed to get participants of this chat", http.StatusBadRequest)
+			response.FromError(w, r, err, "Failed to get participants of this chat")
 			return
 		}
 
-		cookie, err := r.Cookie("your_username")
-		if err != nil {
-			log.Error("failed checking cookie", sl.Err(err))
-			http.Error(w, "Failed checking your cookie", http.StatusInternalServerError)
+		claims, ok := r.Context().Value("claims").(jwts.Claims)
+		if !ok {
+			response.Error(w, r, http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 
-		sender := cookie.Value
-
-		if !strings.Contains(participants, sender) {
+		if _, err := chatInteractor.GetChatRole(r.Context(), int64(id), claims.Username); err != nil {
 			log.Warn("You are not in this chat")
-			http.Error(w, "You are not in this chat", http.StatusForbidden)
+			response.Error(w, r, http.StatusForbidden, "You are not in this chat")
+			return
+		}
+
+		info, err := chatInteractor.GetChatInfo(r.Context(), int64(id))
+		if err != nil {
+			log.Error("failed to get chat info", sl.Err(err))
+			response.FromError(w, r, err, "Failed to get the chat")
+			return
+		}
+
+		members, err := chatInteractor.GetChatMembers(r.Context(), int64(id))
+		if err != nil {
+			log.Error("failed to get members of this chat", sl.Err(err))
+			response.FromError(w, r, err, "Failed to get participants of this chat")
 			return
 		}
 
@@ -188,16 +247,17 @@ func NewGetChatHandler(log *slog.Logger, chatInteractor ChatInteractor) http.Han
 
 		usernames := strings.Fields(participants)
 		if len(usernames) <= 0 {
-			http.Error(w, "Invalid chat", http.StatusBadRequest)
+			response.Error(w, r, http.StatusBadRequest, "Invalid chat")
 			return
 		}
 
 		var ParticipantsNicknames []string
 
 		for _, username := range usernames {
-			nickname, err := chatInteractor.GetNicknameByUsername(username)
+			nickname, err := chatInteractor.GetNicknameByUsername(r.Context(), username)
 			if err != nil {
 				log.Error("failed to get nickname", sl.Err(err))
+				response.FromError(w, r, err, "Failed to get participants of this chat")
 				return
 			}
 			ParticipantsNicknames = append(ParticipantsNicknames, nickname)
@@ -205,29 +265,120 @@ func NewGetChatHandler(log *slog.Logger, chatInteractor ChatInteractor) http.Han
 
 		Participants := strings.Join(ParticipantsNicknames, ", ")
 
-		messages, err := chatInteractor.GetAllMessagesByChatnameAndID(ChatName, int64(id))
+		messages, err := chatInteractor.GetAllMessagesByChatnameAndID(r.Context(), ChatName, int64(id))
 		if err != nil {
 			log.Error("failed to get the list of messages in this chat", sl.Err(err))
-			http.Error(w, "Failed to get the list of messages in this chat", http.StatusBadRequest)
+			response.FromError(w, r, err, "Failed to get the list of messages in this chat")
 			return
 		}
 
+		pins, err := chatInteractor.GetPins(r.Context(), int64(id))
+		if err != nil {
+			log.Error("failed to get pinned messages", sl.Err(err))
+			response.FromError(w, r, err, "Failed to get pinned messages")
+			return
+		}
+
+		respPins := []ResponsePin{}
+		for _, pin := range pins {
+			respPins = append(respPins, ResponsePin{
+				MessageID: pin.MessageID,
+				Sender:    pin.Sender,
+				Text:      pin.Text,
+				PinnedBy:  pin.PinnedBy,
+				PinnedAt:  pin.PinnedAt,
+			})
+		}
+
+		attachments, err := chatInteractor.GetChatAttachments(r.Context(), int64(id))
+		if err != nil {
+			log.Error("failed to get attachments", sl.Err(err))
+			response.FromError(w, r, err, "Failed to get the list of messages in this chat")
+			return
+		}
+
+		respAttachments := map[int64][]ResponseAttachment{}
+		for _, att := range attachments {
+			url := fmt.Sprintf("%s/chat/%d/attachments/%d", attachmentsURL, id, att.ID)
+
+			var thumbnails []ResponseThumbnail
+			for _, t := range att.Thumbnails {
+				thumbnails = append(thumbnails, ResponseThumbnail{
+					Size:   t.Size,
+					Width:  t.Width,
+					Height: t.Height,
+					URL:    fmt.Sprintf("%s/thumbnails/%d", url, t.Size),
+				})
+			}
+
+			respAttachments[att.MessageID] = append(respAttachments[att.MessageID], ResponseAttachment{
+				ID:          att.ID,
+				Filename:    att.Filename,
+				ContentType: att.ContentType,
+				Size:        att.Size,
+				Width:       att.Width,
+				Height:      att.Height,
+				URL:         url,
+				Thumbnails:  thumbnails,
+			})
+		}
+
 		var respMsg []ResponseMessages
 
 		for _, msg := range messages {
 			resp := ResponseMessages{
-				ID:     msg.ID,
-				Sender: msg.Sender,
-				Text:   msg.Text,
+				ID:          msg.ID,
+				Sender:      msg.Sender,
+				Text:        msg.Text,
+				Kind:        msg.Kind,
+				Attachments: respAttachments[msg.ID],
 			}
 			respMsg = append(respMsg, resp)
 		}
 		respData := ResponseData{
 			Name:         ChatName,
+			Kind:         info.Kind,
+			Public:       info.Public,
+			Description:  info.Description,
+			Topic:        info.Topic,
+			Avatar:       info.Avatar,
+			CreatedBy:    info.CreatedBy,
+			CreatedAt:    info.CreatedAt,
 			Participants: Participants,
+			MemberCount:  info.MemberCount,
+			Members:      members,
+			Pins:         respPins,
 			RespMsg:      respMsg,
 		}
 		json.NewEncoder(w).Encode(respData)
 		log.Info("successful GetChatOperation")
 	}
 }
+
+// missingUsers asks the user service which of usernames have no account. It
+// returns false after writing the error when the service can't answer.
+func missingUsers(w http.ResponseWriter, r *http.Request, log *slog.Logger, users user_client.UserDirectory, usernames []string) ([]string, bool) {
+	missing, err := users.ExistUsers(r.Context(), usernames)
+	if errors.Is(err, user_client.ErrUnavailable) {
+		log.Error("user service is unavailable", sl.Err(err))
+		response.Error(w, r, http.StatusServiceUnavailable, "User service is unavailable, try again later")
+		return nil, false
+	}
+	if err != nil {
+		log.Error("failed to check users", sl.Err(err))
+		response.FromError(w, r, err, "Failed to check users")
+		return nil, false
+	}
+
+	return missing, true
+}
+
+// unknownUsers answers a request naming users that have no account, the
+// details list them.
+func unknownUsers(w http.ResponseWriter, r *http.Request, missing []string) {
+	response.Write(w, r, http.StatusBadRequest, response.ErrorBody{
+		Code:    "unknown_users",
+		Message: "there are some non-existing users: " + strings.Join(missing, ", "),
+		Details: map[string][]string{"usernames": missing},
+	})
+}
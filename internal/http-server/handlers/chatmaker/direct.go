@@ -0,0 +1,89 @@
+package chatmaker_handler
+
+import (
+	user_client "chat_go/internal/clients/user"
+	"chat_go/internal/lib/api/models"
+	"chat_go/internal/lib/api/response"
+	"chat_go/internal/lib/jwts"
+	"chat_go/internal/lib/logger/sl"
+	"chat_go/internal/lib/metrics"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+type DirectChatResponse struct {
+	ID      int64  `json:"id"`
+	Name    string `json:"name"`
+	Created bool   `json:"created"`
+}
+
+type DirectChatMaker interface {
+	GetOrMakeDirectChat(ctx context.Context, from string, to string) (int64, bool, error)
+	GetChatInfo(ctx context.Context, chatID int64) (models.ChatInfo, error)
+}
+
+// NewDirectChatHandler returns the direct chat between the logged in user and
+// the user in the URL, creating it on first use. Calling it again, from either
+// side, gives the same chat.
+func NewDirectChatHandler(log *slog.Logger, maker DirectChatMaker, directory user_client.UserDirectory) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.chatmaker.DirectChat"
+
+		log := log.With(slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		claims, ok := r.Context().Value("claims").(jwts.Claims)
+		if !ok {
+			response.Error(w, r, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		username := chi.URLParam(r, "username")
+		if !strings.HasPrefix(username, "@") {
+			response.Error(w, r, http.StatusBadRequest, "Username must start with @")
+			return
+		}
+
+		missing, ok := missingUsers(w, r, log, directory, []string{username})
+		if !ok {
+			return
+		}
+		if len(missing) > 0 {
+			response.Error(w, r, http.StatusNotFound, "User not found")
+			return
+		}
+
+		id, created, err := maker.GetOrMakeDirectChat(r.Context(), claims.Username, username)
+		if err != nil {
+			log.Error("failed to get direct chat", sl.Err(err))
+			response.FromError(w, r, err, "Failed to get direct chat")
+			return
+		}
+
+		info, err := maker.GetChatInfo(r.Context(), id)
+		if err != nil {
+			log.Error("failed to get chat info", sl.Err(err))
+			response.FromError(w, r, err, "Failed to get direct chat")
+			return
+		}
+
+		status := http.StatusOK
+		if created {
+			metrics.ChatCreated(models.ChatKindDirect)
+			log.Info("direct chat created", slog.Int64("id", id), slog.String("from", claims.Username), slog.String("to", username))
+			status = http.StatusCreated
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(DirectChatResponse{ID: id, Name: info.Name, Created: created})
+	}
+}
@@ -0,0 +1,119 @@
+package chatmaker_handler
+
+import (
+	"chat_go/internal/lib/api/models"
+	"chat_go/internal/lib/api/response"
+	"chat_go/internal/lib/chatrole"
+	"chat_go/internal/lib/logger/sl"
+	"chat_go/internal/storage"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// UpdateChatRequest changes only the fields that are present. An empty string
+// clears the description, topic or avatar.
+type UpdateChatRequest struct {
+	Name        *string `json:"Name" validate:"omitempty,min=1,max=100"`
+	Description *string `json:"Description" validate:"omitempty,max=1000"`
+	Topic       *string `json:"Topic" validate:"omitempty,max=200"`
+	Avatar      *string `json:"Avatar" validate:"omitempty,max=2048"`
+}
+
+type ChatUpdater interface {
+	ChatRoleGetter
+	SystemMessageSaver
+	UpdateChat(ctx context.Context, chatID int64, update models.ChatUpdate) error
+}
+
+func NewUpdateChatHandler(log *slog.Logger, updater ChatUpdater) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.chatmaker.UpdateChat"
+
+		log := log.With(slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		chatID, claims, ok := chatRequest(w, r)
+		if !ok {
+			return
+		}
+
+		var req UpdateChatRequest
+		if !decode(w, r, log, &req) {
+			return
+		}
+
+		if req.Name != nil && *req.Name == "" {
+			response.Error(w, r, http.StatusBadRequest, "Name cannot be empty")
+			return
+		}
+		if req.Avatar != nil && *req.Avatar != "" {
+			u, err := url.Parse(*req.Avatar)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				response.Error(w, r, http.StatusBadRequest, "Avatar must be an http or https URL")
+				return
+			}
+		}
+		if req.Name == nil && req.Description == nil && req.Topic == nil && req.Avatar == nil {
+			response.Error(w, r, http.StatusBadRequest, "Nothing to change")
+			return
+		}
+
+		if _, ok := RequireChatAction(w, r, log, updater, chatID, claims.Username, chatrole.EditInfo); !ok {
+			return
+		}
+
+		err := updater.UpdateChat(r.Context(), chatID, models.ChatUpdate{
+			Name:        req.Name,
+			Description: req.Description,
+			Topic:       req.Topic,
+			Avatar:      req.Avatar,
+		})
+		if errors.Is(err, storage.ErrChatNotFound) {
+			response.ErrorFor(w, r, err, "Chat not found")
+			return
+		}
+		if err != nil {
+			log.Error("failed to update chat", sl.Err(err))
+			response.FromError(w, r, err, "Failed to update chat")
+			return
+		}
+
+		log.Info("chat updated", slog.Int64("chat_id", chatID), slog.String("by", claims.Username))
+
+		by := claims.Username
+		if req.Name != nil {
+			systemMessage(r.Context(), log, updater, chatID, by+" renamed the chat to "+*req.Name)
+		}
+		if req.Description != nil {
+			systemMessage(r.Context(), log, updater, chatID, changeText(by, "description", *req.Description, false))
+		}
+		if req.Topic != nil {
+			systemMessage(r.Context(), log, updater, chatID, changeText(by, "topic", *req.Topic, true))
+		}
+		if req.Avatar != nil {
+			systemMessage(r.Context(), log, updater, chatID, changeText(by, "avatar", *req.Avatar, false))
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// changeText describes a change of a chat field. Long values like the
+// description aren't repeated in the history, unless quote is set.
+func changeText(by string, field string, value string, quote bool) string {
+	switch {
+	case value == "":
+		return by + " removed the " + field
+	case quote:
+		return by + " changed the " + field + " to " + value
+	default:
+		return by + " changed the " + field
+	}
+}
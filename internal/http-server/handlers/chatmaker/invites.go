@@ -0,0 +1,236 @@
+package chatmaker_handler
+
+import (
+	"chat_go/internal/lib/api/models"
+	"chat_go/internal/lib/api/response"
+	"chat_go/internal/lib/chatrole"
+	"chat_go/internal/lib/jwts"
+	"chat_go/internal/lib/logger/sl"
+	"chat_go/internal/storage"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+type CreateInviteRequest struct {
+	// ExpiresIn is a duration like "24h". Empty means the link never expires.
+	ExpiresIn string `json:"ExpiresIn"`
+	// MaxUses limits how many users can join with the link. 0 means no limit.
+	MaxUses int `json:"MaxUses" validate:"gte=0"`
+}
+
+type CreateInviteResponse struct {
+	ID        int64      `json:"id"`
+	Token     string     `json:"token"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	MaxUses   int        `json:"max_uses"`
+}
+
+type InviteCreator interface {
+	ChatRoleGetter
+	SaveChatInvite(ctx context.Context, chatID int64, token string, createdBy string, expiresAt *time.Time, maxUses int) (int64, error)
+}
+
+type InviteManager interface {
+	ChatRoleGetter
+	GetChatInvites(ctx context.Context, chatID int64) ([]models.ChatInvite, error)
+	RevokeChatInvite(ctx context.Context, chatID int64, inviteID int64) error
+}
+
+type InviteJoiner interface {
+	SystemMessageSaver
+	JoinChatByInvite(ctx context.Context, token string, username string) (int64, bool, error)
+}
+
+// NewCreateInviteHandler creates an invite link for the chat. The token is
+// returned only here, it can't be looked up later.
+func NewCreateInviteHandler(log *slog.Logger, creator InviteCreator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.chatmaker.CreateInvite"
+
+		log := log.With(slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		chatID, claims, ok := chatRequest(w, r)
+		if !ok {
+			return
+		}
+
+		var req CreateInviteRequest
+		if !decode(w, r, log, &req) {
+			return
+		}
+
+		var expiresAt *time.Time
+		if req.ExpiresIn != "" {
+			d, err := time.ParseDuration(req.ExpiresIn)
+			if err != nil || d <= 0 {
+				response.Error(w, r, http.StatusBadRequest, "Invalid ExpiresIn, use a duration like 24h")
+				return
+			}
+			t := time.Now().Add(d)
+			expiresAt = &t
+		}
+
+		if _, ok := RequireChatAction(w, r, log, creator, chatID, claims.Username, chatrole.ManageMembers); !ok {
+			return
+		}
+
+		token, err := generateInviteToken()
+		if err != nil {
+			log.Error("failed to generate invite token", sl.Err(err))
+			response.FromError(w, r, err, "Failed to create invite")
+			return
+		}
+
+		id, err := creator.SaveChatInvite(r.Context(), chatID, token, claims.Username, expiresAt, req.MaxUses)
+		if errors.Is(err, storage.ErrDirectChat) {
+			response.ErrorFor(w, r, err, "You can't invite people to a direct chat")
+			return
+		}
+		if err != nil {
+			log.Error("failed to save invite", sl.Err(err))
+			response.FromError(w, r, err, "Failed to create invite")
+			return
+		}
+
+		log.Info("invite created", slog.Int64("chat_id", chatID), slog.Int64("id", id), slog.String("by", claims.Username))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(CreateInviteResponse{
+			ID:        id,
+			Token:     token,
+			ExpiresAt: expiresAt,
+			MaxUses:   req.MaxUses,
+		})
+	}
+}
+
+func NewListInvitesHandler(log *slog.Logger, manager InviteManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.chatmaker.ListInvites"
+
+		log := log.With(slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		chatID, claims, ok := chatRequest(w, r)
+		if !ok {
+			return
+		}
+
+		if _, ok := RequireChatAction(w, r, log, manager, chatID, claims.Username, chatrole.ManageMembers); !ok {
+			return
+		}
+
+		invites, err := manager.GetChatInvites(r.Context(), chatID)
+		if err != nil {
+			log.Error("failed to get invites", sl.Err(err))
+			response.FromError(w, r, err, "Failed to get invites")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(invites)
+	}
+}
+
+func NewRevokeInviteHandler(log *slog.Logger, manager InviteManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.chatmaker.RevokeInvite"
+
+		log := log.With(slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		chatID, claims, ok := chatRequest(w, r)
+		if !ok {
+			return
+		}
+
+		inviteID, err := strconv.ParseInt(chi.URLParam(r, "inviteID"), 10, 64)
+		if err != nil {
+			response.Error(w, r, http.StatusBadRequest, "Invalid invite ID")
+			return
+		}
+
+		if _, ok := RequireChatAction(w, r, log, manager, chatID, claims.Username, chatrole.ManageMembers); !ok {
+			return
+		}
+
+		err = manager.RevokeChatInvite(r.Context(), chatID, inviteID)
+		if errors.Is(err, storage.ErrInviteNotFound) {
+			response.ErrorFor(w, r, err, "Invite not found")
+			return
+		}
+		if err != nil {
+			log.Error("failed to revoke invite", sl.Err(err))
+			response.FromError(w, r, err, "Failed to revoke invite")
+			return
+		}
+
+		log.Info("invite revoked", slog.Int64("chat_id", chatID), slog.Int64("id", inviteID), slog.String("by", claims.Username))
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// NewJoinHandler lets the logged in user join a chat with an invite token.
+func NewJoinHandler(log *slog.Logger, joiner InviteJoiner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.chatmaker.Join"
+
+		log := log.With(slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		claims, ok := r.Context().Value("claims").(jwts.Claims)
+		if !ok {
+			response.Error(w, r, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		chatID, joined, err := joiner.JoinChatByInvite(r.Context(), chi.URLParam(r, "token"), claims.Username)
+		if errors.Is(err, storage.ErrInvalidInvite) {
+			response.ErrorFor(w, r, err, "Invalid or expired invite")
+			return
+		}
+		if err != nil {
+			log.Error("failed to join chat", sl.Err(err))
+			response.FromError(w, r, err, "Failed to join chat")
+			return
+		}
+
+		if joined {
+			log.Info("chat joined by invite", slog.Int64("chat_id", chatID), slog.String("user", claims.Username))
+			systemMessage(r.Context(), log, joiner, chatID, claims.Username+" joined with an invite link")
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int64{"chat_id": chatID})
+	}
+}
+
+func generateInviteToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,163 @@
+package chatmaker_handler
+
+import (
+	user_client "chat_go/internal/clients/user"
+	"chat_go/internal/lib/api/response"
+	"chat_go/internal/lib/chatrole"
+	"chat_go/internal/lib/logger/sl"
+	"chat_go/internal/storage"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+type AddMembersRequest struct {
+	Usernames []string `json:"Usernames" validate:"required,min=1,dive,required,startswith=@"`
+}
+
+type SystemMessageSaver interface {
+	SaveSystemMessage(ctx context.Context, chatID int64, text string) error
+}
+
+type MemberAdder interface {
+	ChatRoleGetter
+	SystemMessageSaver
+	AddChatMembers(ctx context.Context, chatID int64, usernames []string) ([]string, error)
+}
+
+type MemberRemover interface {
+	ChatRoleGetter
+	SystemMessageSaver
+	LeaveChat(ctx context.Context, chatID int64, username string) (string, error)
+}
+
+// NewAddMembersHandler adds users to the chat. Every username is checked with
+// the user service first.
+func NewAddMembersHandler(log *slog.Logger, adder MemberAdder, directory user_client.UserDirectory) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.chatmaker.AddMembers"
+
+		log := log.With(slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		chatID, claims, ok := chatRequest(w, r)
+		if !ok {
+			return
+		}
+
+		var req AddMembersRequest
+		if !decode(w, r, log, &req) {
+			return
+		}
+
+		if _, ok := RequireChatAction(w, r, log, adder, chatID, claims.Username, chatrole.ManageMembers); !ok {
+			return
+		}
+
+		missing, ok := missingUsers(w, r, log, directory, req.Usernames)
+		if !ok {
+			return
+		}
+		if len(missing) > 0 {
+			unknownUsers(w, r, missing)
+			return
+		}
+
+		added, err := adder.AddChatMembers(r.Context(), chatID, req.Usernames)
+		if errors.Is(err, storage.ErrChatNotFound) {
+			response.ErrorFor(w, r, err, "Chat not found")
+			return
+		}
+		if errors.Is(err, storage.ErrDirectChat) {
+			response.ErrorFor(w, r, err, "You can't add members to a direct chat")
+			return
+		}
+		if err != nil {
+			log.Error("failed to add members", sl.Err(err))
+			response.FromError(w, r, err, "Failed to add members")
+			return
+		}
+
+		if len(added) > 0 {
+			log.Info("members added", slog.Int64("chat_id", chatID), slog.Any("users", added))
+			systemMessage(r.Context(), log, adder, chatID, claims.Username+" added "+strings.Join(added, ", "))
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// NewRemoveMemberHandler removes another member from the chat. Only members
+// with a lower role can be removed.
+func NewRemoveMemberHandler(log *slog.Logger, remover MemberRemover) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.chatmaker.RemoveMember"
+
+		log := log.With(slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		chatID, claims, ok := chatRequest(w, r)
+		if !ok {
+			return
+		}
+
+		username := chi.URLParam(r, "username")
+		if username == claims.Username {
+			response.Error(w, r, http.StatusBadRequest, "Use /leave to leave the chat")
+			return
+		}
+
+		role, ok := RequireChatAction(w, r, log, remover, chatID, claims.Username, chatrole.ManageMembers)
+		if !ok {
+			return
+		}
+
+		targetRole, err := remover.GetChatRole(r.Context(), chatID, username)
+		if errors.Is(err, storage.ErrNotChatMember) {
+			response.Error(w, r, http.StatusNotFound, "User is not in this chat")
+			return
+		}
+		if err != nil {
+			log.Error("failed to get chat role", sl.Err(err))
+			response.FromError(w, r, err, "Failed to remove member")
+			return
+		}
+		if !role.Outranks(chatrole.Role(targetRole)) {
+			response.Error(w, r, http.StatusForbidden, "Your role in this chat does not allow this")
+			return
+		}
+
+		_, err = remover.LeaveChat(r.Context(), chatID, username)
+		if errors.Is(err, storage.ErrNotChatMember) {
+			response.Error(w, r, http.StatusNotFound, "User is not in this chat")
+			return
+		}
+		if err != nil {
+			log.Error("failed to remove member", sl.Err(err))
+			response.FromError(w, r, err, "Failed to remove member")
+			return
+		}
+
+		log.Info("member removed", slog.Int64("chat_id", chatID), slog.String("user", username), slog.String("by", claims.Username))
+		systemMessage(r.Context(), log, remover, chatID, claims.Username+" removed "+username)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// systemMessage records a change in the chat history. A failure is only
+// logged, the change itself has already been made.
+func systemMessage(ctx context.Context, log *slog.Logger, saver SystemMessageSaver, chatID int64, text string) {
+	if err := saver.SaveSystemMessage(ctx, chatID, text); err != nil {
+		log.Error("failed to save system message", sl.Err(err))
+	}
+}
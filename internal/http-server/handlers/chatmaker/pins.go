@@ -0,0 +1,115 @@
+package chatmaker_handler
+
+import (
+	"chat_go/internal/lib/api/response"
+	"chat_go/internal/lib/chatrole"
+	"chat_go/internal/lib/logger/sl"
+	"chat_go/internal/storage"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+type MessagePinner interface {
+	ChatRoleGetter
+	SystemMessageSaver
+	PinMessage(ctx context.Context, chatID int64, messageID int64, pinnedBy string, limit int) (bool, error)
+	UnpinMessage(ctx context.Context, chatID int64, messageID int64) error
+}
+
+// NewPinHandler pins a message. At most limit messages can be pinned in a chat.
+func NewPinHandler(log *slog.Logger, pinner MessagePinner, limit int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.chatmaker.Pin"
+
+		log := log.With(slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		chatID, claims, ok := chatRequest(w, r)
+		if !ok {
+			return
+		}
+
+		messageID, err := strconv.ParseInt(chi.URLParam(r, "messageID"), 10, 64)
+		if err != nil {
+			response.Error(w, r, http.StatusBadRequest, "Invalid message ID")
+			return
+		}
+
+		if _, ok := RequireChatAction(w, r, log, pinner, chatID, claims.Username, chatrole.PinMessages); !ok {
+			return
+		}
+
+		pinned, err := pinner.PinMessage(r.Context(), chatID, messageID, claims.Username, limit)
+		if errors.Is(err, storage.ErrMessageNotFound) {
+			response.ErrorFor(w, r, err, "Message not found")
+			return
+		}
+		if errors.Is(err, storage.ErrTooManyPins) {
+			response.ErrorFor(w, r, err, fmt.Sprintf("At most %d messages can be pinned", limit))
+			return
+		}
+		if err != nil {
+			log.Error("failed to pin message", sl.Err(err))
+			response.FromError(w, r, err, "Failed to pin message")
+			return
+		}
+
+		if pinned {
+			log.Info("message pinned", slog.Int64("chat_id", chatID), slog.Int64("message_id", messageID), slog.String("by", claims.Username))
+			systemMessage(r.Context(), log, pinner, chatID, claims.Username+" pinned a message")
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func NewUnpinHandler(log *slog.Logger, pinner MessagePinner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.chatmaker.Unpin"
+
+		log := log.With(slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		chatID, claims, ok := chatRequest(w, r)
+		if !ok {
+			return
+		}
+
+		messageID, err := strconv.ParseInt(chi.URLParam(r, "messageID"), 10, 64)
+		if err != nil {
+			response.Error(w, r, http.StatusBadRequest, "Invalid message ID")
+			return
+		}
+
+		if _, ok := RequireChatAction(w, r, log, pinner, chatID, claims.Username, chatrole.PinMessages); !ok {
+			return
+		}
+
+		err = pinner.UnpinMessage(r.Context(), chatID, messageID)
+		if errors.Is(err, storage.ErrPinNotFound) {
+			response.ErrorFor(w, r, err, "Message is not pinned")
+			return
+		}
+		if err != nil {
+			log.Error("failed to unpin message", sl.Err(err))
+			response.FromError(w, r, err, "Failed to unpin message")
+			return
+		}
+
+		log.Info("message unpinned", slog.Int64("chat_id", chatID), slog.Int64("message_id", messageID), slog.String("by", claims.Username))
+		systemMessage(r.Context(), log, pinner, chatID, claims.Username+" unpinned a message")
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,313 @@
+package chatmaker_handler
+
+import (
+	"chat_go/internal/lib/api/models"
+	"chat_go/internal/lib/api/response"
+	"chat_go/internal/lib/chatrole"
+	"chat_go/internal/lib/jwts"
+	"chat_go/internal/lib/logger/sl"
+	"chat_go/internal/storage"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+)
+
+type SetRoleRequest struct {
+	Role string `json:"Role" validate:"required"`
+}
+
+type TransferRequest struct {
+	Username string `json:"Username" validate:"required"`
+}
+
+type ChatRoleGetter interface {
+	GetChatRole(ctx context.Context, chatID int64, username string) (string, error)
+}
+
+type ChatRoleSetter interface {
+	ChatRoleGetter
+	SystemMessageSaver
+	SetChatRole(ctx context.Context, chatID int64, username string, role string) error
+	TransferOwnership(ctx context.Context, chatID int64, from string, to string) error
+}
+
+type ChatLeaver interface {
+	SystemMessageSaver
+	GetChatInfo(ctx context.Context, chatID int64) (models.ChatInfo, error)
+	LeaveChat(ctx context.Context, chatID int64, username string) (string, error)
+}
+
+type ChatMembersGetter interface {
+	ChatRoleGetter
+	GetChatMembers(ctx context.Context, chatID int64) ([]models.ChatMember, error)
+}
+
+func NewGetMembersHandler(log *slog.Logger, getter ChatMembersGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.chatmaker.GetMembers"
+
+		log := log.With(slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		chatID, claims, ok := chatRequest(w, r)
+		if !ok {
+			return
+		}
+
+		if _, ok := RequireChatAction(w, r, log, getter, chatID, claims.Username, ""); !ok {
+			return
+		}
+
+		members, err := getter.GetChatMembers(r.Context(), chatID)
+		if err != nil {
+			log.Error("failed to get members", sl.Err(err))
+			response.FromError(w, r, err, "Failed to get members")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(members)
+	}
+}
+
+// NewSetMemberRoleHandler lets an owner make another member an owner, an admin
+// or a plain member.
+func NewSetMemberRoleHandler(log *slog.Logger, setter ChatRoleSetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.chatmaker.SetMemberRole"
+
+		log := log.With(slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		chatID, claims, ok := chatRequest(w, r)
+		if !ok {
+			return
+		}
+
+		var req SetRoleRequest
+		if !decode(w, r, log, &req) {
+			return
+		}
+
+		role, err := chatrole.Parse(req.Role)
+		if err != nil {
+			response.Error(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		username := chi.URLParam(r, "username")
+		if username == claims.Username {
+			response.Error(w, r, http.StatusBadRequest, "You cannot change your own role")
+			return
+		}
+
+		if _, ok := RequireChatAction(w, r, log, setter, chatID, claims.Username, chatrole.ChangeRoles); !ok {
+			return
+		}
+
+		err = setter.SetChatRole(r.Context(), chatID, username, string(role))
+		if errors.Is(err, storage.ErrNotChatMember) {
+			response.Error(w, r, http.StatusNotFound, "User is not in this chat")
+			return
+		}
+		if errors.Is(err, storage.ErrDirectChat) {
+			response.ErrorFor(w, r, err, "Roles can't be changed in a direct chat")
+			return
+		}
+		if err != nil {
+			log.Error("failed to set role", sl.Err(err))
+			response.FromError(w, r, err, "Failed to set role")
+			return
+		}
+
+		log.Info("chat role changed",
+			slog.Int64("chat_id", chatID), slog.String("user", username),
+			slog.String("role", string(role)), slog.String("by", claims.Username),
+		)
+		systemMessage(r.Context(), log, setter, chatID, claims.Username+" made "+username+" "+string(role))
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// NewTransferOwnershipHandler hands the chat over to another member. The old
+// owner stays in the chat as an admin.
+func NewTransferOwnershipHandler(log *slog.Logger, setter ChatRoleSetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.chatmaker.TransferOwnership"
+
+		log := log.With(slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		chatID, claims, ok := chatRequest(w, r)
+		if !ok {
+			return
+		}
+
+		var req TransferRequest
+		if !decode(w, r, log, &req) {
+			return
+		}
+
+		if req.Username == claims.Username {
+			response.Error(w, r, http.StatusBadRequest, "You already own this chat")
+			return
+		}
+
+		role, ok := RequireChatAction(w, r, log, setter, chatID, claims.Username, "")
+		if !ok {
+			return
+		}
+		if role != chatrole.Owner {
+			response.Error(w, r, http.StatusForbidden, "Only an owner can transfer the chat")
+			return
+		}
+
+		err := setter.TransferOwnership(r.Context(), chatID, claims.Username, req.Username)
+		if errors.Is(err, storage.ErrNotChatMember) {
+			response.Error(w, r, http.StatusNotFound, "User is not in this chat")
+			return
+		}
+		if errors.Is(err, storage.ErrDirectChat) {
+			response.ErrorFor(w, r, err, "A direct chat can't be transferred")
+			return
+		}
+		if err != nil {
+			log.Error("failed to transfer ownership", sl.Err(err))
+			response.FromError(w, r, err, "Failed to transfer ownership")
+			return
+		}
+
+		log.Info("chat ownership transferred",
+			slog.Int64("chat_id", chatID), slog.String("from", claims.Username), slog.String("to", req.Username),
+		)
+		systemMessage(r.Context(), log, setter, chatID, claims.Username+" transferred ownership to "+req.Username)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// NewLeaveHandler removes the logged in user from the chat. If the user was the
+// last owner, someone else is promoted.
+func NewLeaveHandler(log *slog.Logger, leaver ChatLeaver) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.chatmaker.Leave"
+
+		log := log.With(slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		chatID, claims, ok := chatRequest(w, r)
+		if !ok {
+			return
+		}
+
+		info, err := leaver.GetChatInfo(r.Context(), chatID)
+		if errors.Is(err, storage.ErrChatNotFound) {
+			response.Error(w, r, http.StatusForbidden, "You are not in this chat")
+			return
+		}
+		if err != nil {
+			log.Error("failed to get chat info", sl.Err(err))
+			response.FromError(w, r, err, "Failed to leave chat")
+			return
+		}
+
+		promoted, err := leaver.LeaveChat(r.Context(), chatID, claims.Username)
+		if errors.Is(err, storage.ErrNotChatMember) {
+			response.ErrorFor(w, r, err, "You are not in this chat")
+			return
+		}
+		if err != nil {
+			log.Error("failed to leave chat", sl.Err(err))
+			response.FromError(w, r, err, "Failed to leave chat")
+			return
+		}
+
+		log.Info("chat left", slog.Int64("chat_id", chatID), slog.String("user", claims.Username))
+		// Subscribers come and go all the time, only the other chats are told.
+		if info.Kind != models.ChatKindChannel {
+			systemMessage(r.Context(), log, leaver, chatID, claims.Username+" left the chat")
+		}
+		if promoted != "" {
+			log.Info("new chat owner", slog.Int64("chat_id", chatID), slog.String("user", promoted))
+			systemMessage(r.Context(), log, leaver, chatID, promoted+" is now the owner")
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// RequireChatAction checks that username is a member of the chat whose role
+// allows action. An empty action only checks membership. It returns the
+// member's role, or false after writing the error.
+func RequireChatAction(w http.ResponseWriter, r *http.Request, log *slog.Logger, roles ChatRoleGetter, chatID int64, username string, action chatrole.Action) (chatrole.Role, bool) {
+	s, err := roles.GetChatRole(r.Context(), chatID, username)
+	if errors.Is(err, storage.ErrNotChatMember) {
+		response.ErrorFor(w, r, err, "You are not in this chat")
+		return "", false
+	}
+	if err != nil {
+		log.Error("failed to get chat role", sl.Err(err))
+		response.FromError(w, r, err, "Failed to check your role in this chat")
+		return "", false
+	}
+
+	role := chatrole.Role(s)
+	if action != "" && !role.Can(action) {
+		log.Warn("chat action denied", slog.String("user", username), slog.String("action", string(action)))
+		response.Error(w, r, http.StatusForbidden, "Your role in this chat does not allow this")
+		return "", false
+	}
+
+	return role, true
+}
+
+// chatRequest reads the chat ID from the URL and the caller from the context.
+func chatRequest(w http.ResponseWriter, r *http.Request) (int64, jwts.Claims, bool) {
+	claims, ok := r.Context().Value("claims").(jwts.Claims)
+	if !ok {
+		response.Error(w, r, http.StatusUnauthorized, "Unauthorized")
+		return 0, jwts.Claims{}, false
+	}
+
+	chatID, err := strconv.ParseInt(chi.URLParam(r, "ID"), 10, 64)
+	if err != nil {
+		response.Error(w, r, http.StatusBadRequest, "Invalid chat ID")
+		return 0, jwts.Claims{}, false
+	}
+
+	return chatID, claims, true
+}
+
+func decode(w http.ResponseWriter, r *http.Request, log *slog.Logger, req interface{}) bool {
+	if err := render.DecodeJSON(r.Body, req); err != nil {
+		log.Error("failed to decode request body", sl.Err(err))
+		response.Error(w, r, http.StatusBadRequest, "Failed to decode request body")
+		return false
+	}
+
+	if err := validator.New().Struct(req); err != nil {
+		validateErr := err.(validator.ValidationErrors)
+		log.Error("invalid request", sl.Err(err))
+		response.ValidationError(w, r, validateErr)
+		return false
+	}
+
+	return true
+}
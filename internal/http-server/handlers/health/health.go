@@ -0,0 +1,135 @@
+package health
+
+import (
+	"chat_go/internal/lib/buildinfo"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+// checkTimeout bounds every readiness check, so a hanging dependency fails the
+// check instead of the probe.
+const checkTimeout = 2 * time.Second
+
+const (
+	statusOK   = "ok"
+	statusWarn = "warn"
+	statusFail = "fail"
+)
+
+// warning is a failed check that doesn't make the server unready.
+type warning struct {
+	err error
+}
+
+func (w *warning) Error() string { return w.err.Error() }
+
+func (w *warning) Unwrap() error { return w.err }
+
+// Warn wraps the error of a check that taking the server out of rotation
+// wouldn't fix, like a wrong service token that every instance shares. The
+// check is reported as "warn" and logged as an error, the server stays ready.
+func Warn(err error) error {
+	return &warning{err: err}
+}
+
+// Check is one thing the server needs to serve requests, like its database.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+type CheckResult struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+type Response struct {
+	Status string        `json:"status"`
+	Checks []CheckResult `json:"checks,omitempty"`
+}
+
+// NewLivenessHandler answers as long as the process can serve HTTP at all. It
+// checks nothing else: a broken dependency is for readiness to report.
+func NewLivenessHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		render.JSON(w, r, Response{Status: statusOK})
+	}
+}
+
+// NewReadinessHandler runs every check and answers 503 Service Unavailable
+// when one fails, or when ready is false because the server is shutting down.
+func NewReadinessHandler(log *slog.Logger, ready func() bool, checks ...Check) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.health.Readiness"
+
+		log := log.With(slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		results := make([]CheckResult, len(checks)+1)
+
+		results[0] = CheckResult{Name: "server", Status: statusOK, Duration: "0s"}
+		if !ready() {
+			results[0].Status, results[0].Error = statusFail, "shutting down"
+		}
+
+		var wg sync.WaitGroup
+		for i, check := range checks {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+				defer cancel()
+
+				start := time.Now()
+				err := check.Run(ctx)
+
+				results[i+1] = CheckResult{Name: check.Name, Status: statusOK, Duration: time.Since(start).Round(time.Microsecond).String()}
+				var warn *warning
+				switch {
+				case errors.As(err, &warn):
+					results[i+1].Status, results[i+1].Error = statusWarn, err.Error()
+				case err != nil:
+					results[i+1].Status, results[i+1].Error = statusFail, err.Error()
+				}
+			}()
+		}
+		wg.Wait()
+
+		resp := Response{Status: statusOK, Checks: results}
+		for _, res := range results {
+			if res.Status == statusWarn {
+				log.Error("check failed, staying ready", slog.String("check", res.Name), slog.String("error", res.Error))
+				continue
+			}
+			if res.Status != statusOK {
+				log.Warn("not ready", slog.String("check", res.Name), slog.String("error", res.Error))
+				resp.Status = statusFail
+			}
+		}
+
+		if resp.Status != statusOK {
+			render.Status(r, http.StatusServiceUnavailable)
+		}
+		render.JSON(w, r, resp)
+	}
+}
+
+// NewVersionHandler tells which build is running.
+func NewVersionHandler() http.HandlerFunc {
+	info := buildinfo.Get()
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		render.JSON(w, r, info)
+	}
+}
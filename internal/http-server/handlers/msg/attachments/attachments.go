@@ -0,0 +1,433 @@
+package attachments
+
+import (
+	"bytes"
+	chatmaker_handler "chat_go/internal/http-server/handlers/chatmaker"
+	"chat_go/internal/lib/api/models"
+	"chat_go/internal/lib/api/response"
+	"chat_go/internal/lib/blob"
+	"chat_go/internal/lib/chatrole"
+	"chat_go/internal/lib/jwts"
+	"chat_go/internal/lib/logger/sl"
+	"chat_go/internal/lib/media"
+	"chat_go/internal/storage"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// maxMemory is how much of a multipart form is kept in memory, the rest of the
+// file goes to a temporary file.
+const maxMemory = 1 << 20
+
+const maxFilenameLength = 255
+
+type UploadResponse struct {
+	MessageID    int64  `json:"message_id"`
+	AttachmentID int64  `json:"attachment_id"`
+	Filename     string `json:"filename"`
+	ContentType  string `json:"content_type"`
+	Size         int64  `json:"size"`
+	Width        int    `json:"width,omitempty"`
+	Height       int    `json:"height,omitempty"`
+	URL          string `json:"url"`
+}
+
+type Uploader interface {
+	GetChatRole(ctx context.Context, chatID int64, username string) (string, error)
+	GetChatInfo(ctx context.Context, chatID int64) (models.ChatInfo, error)
+	SaveAttachmentMessage(ctx context.Context, sender string, chatID int64, text string, att models.Attachment) (int64, int64, error)
+}
+
+type AttachmentGetter interface {
+	GetChatRole(ctx context.Context, chatID int64, username string) (string, error)
+	GetAttachment(ctx context.Context, chatID int64, attachmentID int64) (models.Attachment, error)
+	GetThumbnail(ctx context.Context, chatID int64, attachmentID int64, size int) (models.Thumbnail, error)
+}
+
+type ThumbnailQueue interface {
+	Submit(job media.Job) bool
+}
+
+// Limits are checked before an upload is stored.
+type Limits struct {
+	MaxSize int64
+	// AllowedTypes lists the accepted content types. "image/*" accepts every
+	// image, and an empty list accepts everything.
+	AllowedTypes []string
+}
+
+// NewUploadHandler sends a message with a file. The request is a multipart
+// form with the file in "File" and an optional caption in "Text". The content
+// type is detected from the file itself, the one sent by the client is ignored.
+// The GPS location is removed from images before they are stored, and their
+// thumbnails are queued.
+func NewUploadHandler(log *slog.Logger, uploader Uploader, blobs blob.BlobStore, thumbnails ThumbnailQueue, limits Limits, baseURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.msg.Upload"
+
+		log := log.With(slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		claims, ok := r.Context().Value("claims").(jwts.Claims)
+		if !ok {
+			response.Error(w, r, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		chatID, err := strconv.ParseInt(chi.URLParam(r, "ID"), 10, 64)
+		if err != nil {
+			response.Error(w, r, http.StatusBadRequest, "Invalid chat ID")
+			return
+		}
+
+		info, err := uploader.GetChatInfo(r.Context(), chatID)
+		if errors.Is(err, storage.ErrChatNotFound) {
+			response.Error(w, r, http.StatusForbidden, "You are not in this chat")
+			return
+		}
+		if err != nil {
+			log.Error("failed to get chat info", sl.Err(err))
+			response.FromError(w, r, err, "Failed to upload the file")
+			return
+		}
+
+		var action chatrole.Action
+		if info.Kind == models.ChatKindChannel {
+			action = chatrole.Broadcast
+		}
+		if _, ok := chatmaker_handler.RequireChatAction(w, r, log, uploader, chatID, claims.Username, action); !ok {
+			return
+		}
+
+		// Leave some room for the other fields and the multipart framing.
+		r.Body = http.MaxBytesReader(w, r.Body, limits.MaxSize+maxMemory)
+
+		if err := r.ParseMultipartForm(maxMemory); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				response.Error(w, r, http.StatusRequestEntityTooLarge, "File is too large")
+				return
+			}
+			response.Error(w, r, http.StatusBadRequest, "Invalid multipart form")
+			return
+		}
+		defer r.MultipartForm.RemoveAll()
+
+		file, header, err := r.FormFile("File")
+		if err != nil {
+			response.Error(w, r, http.StatusBadRequest, "File is required")
+			return
+		}
+		defer file.Close()
+
+		if header.Size > limits.MaxSize {
+			response.Error(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("File is too large, the limit is %d bytes", limits.MaxSize))
+			return
+		}
+
+		contentType, err := sniff(file)
+		if err != nil {
+			log.Error("failed to read upload", sl.Err(err))
+			response.FromError(w, r, err, "Failed to upload the file")
+			return
+		}
+		if !allowed(contentType, limits.AllowedTypes) {
+			response.Error(w, r, http.StatusUnsupportedMediaType, "Files of type "+contentType+" are not allowed")
+			return
+		}
+
+		key, err := newKey()
+		if err != nil {
+			log.Error("failed to generate blob key", sl.Err(err))
+			response.FromError(w, r, err, "Failed to upload the file")
+			return
+		}
+
+		att := models.Attachment{
+			ChatID:      chatID,
+			Key:         key,
+			Filename:    cleanFilename(header.Filename),
+			ContentType: contentType,
+			Size:        header.Size,
+		}
+
+		var content io.Reader = file
+		if strings.HasPrefix(contentType, "image/") {
+			data, err := io.ReadAll(file)
+			if err != nil {
+				log.Error("failed to read upload", sl.Err(err))
+				response.FromError(w, r, err, "Failed to upload the file")
+				return
+			}
+
+			data, err = media.StripGPS(data)
+			if errors.Is(err, media.ErrUnsupportedImage) {
+				// The location can't be removed, so the image isn't stored.
+				response.Error(w, r, http.StatusUnsupportedMediaType, "Images of type "+contentType+" are not supported")
+				return
+			}
+			if err != nil {
+				log.Warn("unreadable image metadata", sl.Err(err))
+				response.Error(w, r, http.StatusBadRequest, "Failed to read the metadata of the image")
+				return
+			}
+
+			// Images the standard library can't decode are kept without
+			// dimensions or thumbnails.
+			if info, err := media.DecodeInfo(bytes.NewReader(data)); err == nil {
+				info = info.Upright(media.Orientation(data))
+				att.Width, att.Height = info.Width, info.Height
+			}
+
+			content = bytes.NewReader(data)
+			att.Size = int64(len(data))
+		}
+
+		if err := blobs.Put(r.Context(), key, content, att.Size, contentType); err != nil {
+			log.Error("failed to store file", sl.Err(err))
+			response.FromError(w, r, err, "Failed to upload the file")
+			return
+		}
+
+		messageID, attachmentID, err := uploader.SaveAttachmentMessage(r.Context(), claims.Username, chatID, r.FormValue("Text"), att)
+		if err != nil {
+			log.Error("failed to save attachment", sl.Err(err))
+			if err := blobs.Delete(r.Context(), key); err != nil {
+				log.Error("failed to delete orphaned file", slog.String("key", key), sl.Err(err))
+			}
+			response.FromError(w, r, err, "Failed to upload the file")
+			return
+		}
+
+		log.Info("attachment uploaded",
+			slog.Int64("chat_id", chatID), slog.Int64("message_id", messageID), slog.Int64("id", attachmentID),
+			slog.String("content_type", contentType), slog.Int64("size", att.Size),
+		)
+
+		if att.Width > 0 && !thumbnails.Submit(media.Job{AttachmentID: attachmentID, Key: key}) {
+			log.Warn("thumbnail queue is full", slog.Int64("id", attachmentID))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(UploadResponse{
+			MessageID:    messageID,
+			AttachmentID: attachmentID,
+			Filename:     att.Filename,
+			ContentType:  contentType,
+			Size:         att.Size,
+			Width:        att.Width,
+			Height:       att.Height,
+			URL:          fmt.Sprintf("%s/chat/%d/attachments/%d", baseURL, chatID, attachmentID),
+		})
+	}
+}
+
+// NewDownloadHandler serves an attachment to the members of its chat.
+func NewDownloadHandler(log *slog.Logger, getter AttachmentGetter, blobs blob.BlobStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.msg.Download"
+
+		log := log.With(slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		claims, ok := r.Context().Value("claims").(jwts.Claims)
+		if !ok {
+			response.Error(w, r, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		chatID, err := strconv.ParseInt(chi.URLParam(r, "ID"), 10, 64)
+		if err != nil {
+			response.Error(w, r, http.StatusBadRequest, "Invalid chat ID")
+			return
+		}
+		attachmentID, err := strconv.ParseInt(chi.URLParam(r, "attachmentID"), 10, 64)
+		if err != nil {
+			response.Error(w, r, http.StatusBadRequest, "Invalid attachment ID")
+			return
+		}
+
+		if _, ok := chatmaker_handler.RequireChatAction(w, r, log, getter, chatID, claims.Username, ""); !ok {
+			return
+		}
+
+		att, err := getter.GetAttachment(r.Context(), chatID, attachmentID)
+		if errors.Is(err, storage.ErrAttachmentNotFound) {
+			response.ErrorFor(w, r, err, "Attachment not found")
+			return
+		}
+		if err != nil {
+			log.Error("failed to get attachment", sl.Err(err))
+			response.FromError(w, r, err, "Failed to get the attachment")
+			return
+		}
+
+		w.Header().Set("Content-Length", strconv.FormatInt(att.Size, 10))
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": att.Filename}))
+		send(w, r, log, blobs, att.Key, att.ContentType)
+	}
+}
+
+// NewThumbnailHandler serves a thumbnail of an image attachment to the members
+// of its chat.
+func NewThumbnailHandler(log *slog.Logger, getter AttachmentGetter, blobs blob.BlobStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.msg.Thumbnail"
+
+		log := log.With(slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		claims, ok := r.Context().Value("claims").(jwts.Claims)
+		if !ok {
+			response.Error(w, r, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		chatID, err := strconv.ParseInt(chi.URLParam(r, "ID"), 10, 64)
+		if err != nil {
+			response.Error(w, r, http.StatusBadRequest, "Invalid chat ID")
+			return
+		}
+		attachmentID, err := strconv.ParseInt(chi.URLParam(r, "attachmentID"), 10, 64)
+		if err != nil {
+			response.Error(w, r, http.StatusBadRequest, "Invalid attachment ID")
+			return
+		}
+		size, err := strconv.Atoi(chi.URLParam(r, "size"))
+		if err != nil {
+			response.Error(w, r, http.StatusBadRequest, "Invalid size")
+			return
+		}
+
+		if _, ok := chatmaker_handler.RequireChatAction(w, r, log, getter, chatID, claims.Username, ""); !ok {
+			return
+		}
+
+		thumb, err := getter.GetThumbnail(r.Context(), chatID, attachmentID, size)
+		if errors.Is(err, storage.ErrAttachmentNotFound) {
+			response.Error(w, r, http.StatusNotFound, "Thumbnail not found")
+			return
+		}
+		if err != nil {
+			log.Error("failed to get thumbnail", sl.Err(err))
+			response.FromError(w, r, err, "Failed to get the thumbnail")
+			return
+		}
+
+		send(w, r, log, blobs, thumb.Key, thumb.ContentType)
+	}
+}
+
+// send copies a blob to the response. Headers set before are kept.
+func send(w http.ResponseWriter, r *http.Request, log *slog.Logger, blobs blob.BlobStore, key string, contentType string) {
+	body, err := blobs.Get(r.Context(), key)
+	if errors.Is(err, blob.ErrNotFound) {
+		log.Error("blob is missing", slog.String("key", key))
+		response.Error(w, r, http.StatusNotFound, "Attachment not found")
+		return
+	}
+	if err != nil {
+		log.Error("failed to read blob", sl.Err(err))
+		response.FromError(w, r, err, "Failed to get the attachment")
+		return
+	}
+	defer body.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private")
+
+	if _, err := io.Copy(w, body); err != nil {
+		log.Error("failed to send blob", sl.Err(err))
+	}
+}
+
+// sniff detects the content type from the start of the file and rewinds it.
+func sniff(file io.ReadSeeker) (string, error) {
+	buf := make([]byte, 512)
+
+	n, err := io.ReadFull(file, buf)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	mediaType, _, err := mime.ParseMediaType(http.DetectContentType(buf[:n]))
+	if err != nil {
+		return "application/octet-stream", nil
+	}
+
+	return mediaType, nil
+}
+
+func allowed(contentType string, allowedTypes []string) bool {
+	if len(allowedTypes) == 0 {
+		return true
+	}
+
+	for _, t := range allowedTypes {
+		if t == contentType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(t, "*"); ok && strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func cleanFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+
+	if name == "." || name == "/" || name == "" {
+		return "file"
+	}
+
+	for len(name) > maxFilenameLength {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+
+	return name
+}
+
+func newKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
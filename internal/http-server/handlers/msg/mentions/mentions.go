@@ -0,0 +1,54 @@
+package mentions
+
+import (
+	"chat_go/internal/lib/api/models"
+	"chat_go/internal/lib/api/page"
+	"chat_go/internal/lib/api/response"
+	"chat_go/internal/lib/jwts"
+	"chat_go/internal/lib/logger/sl"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+type MentionsGetter interface {
+	GetMentions(ctx context.Context, username string, limit int, offset int) ([]models.Mention, error)
+}
+
+// NewGetMentionsHandler lists the messages that mention the logged in user,
+// newest first.
+func NewGetMentionsHandler(log *slog.Logger, getter MentionsGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.msg.GetMentions"
+
+		log := log.With(slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		claims, ok := r.Context().Value("claims").(jwts.Claims)
+		if !ok {
+			response.Error(w, r, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		limit, offset, err := page.FromQuery(r)
+		if err != nil {
+			response.Error(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		mentions, err := getter.GetMentions(r.Context(), claims.Username, limit, offset)
+		if err != nil {
+			log.Error("failed to get mentions", sl.Err(err))
+			response.FromError(w, r, err, "Failed to get mentions")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(mentions)
+	}
+}
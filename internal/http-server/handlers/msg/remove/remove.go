@@ -0,0 +1,99 @@
+package remove
+
+import (
+	chatmaker_handler "chat_go/internal/http-server/handlers/chatmaker"
+	"chat_go/internal/lib/api/response"
+	"chat_go/internal/lib/blob"
+	"chat_go/internal/lib/chatrole"
+	"chat_go/internal/lib/jwts"
+	"chat_go/internal/lib/logger/sl"
+	"chat_go/internal/storage"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+type MessageDeleter interface {
+	GetChatRole(ctx context.Context, chatID int64, username string) (string, error)
+	GetMessageSender(ctx context.Context, chatID int64, messageID int64) (string, error)
+	DeleteMessage(ctx context.Context, chatID int64, messageID int64) ([]string, error)
+}
+
+// NewDeleteMessageHandler deletes a message. Everyone can delete their own
+// messages, deleting someone else's needs a chat role that allows it. The files
+// attached to the message are removed from blobs.
+func NewDeleteMessageHandler(log *slog.Logger, deleter MessageDeleter, blobs blob.BlobStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.msg.Delete"
+
+		log := log.With(slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		claims, ok := r.Context().Value("claims").(jwts.Claims)
+		if !ok {
+			response.Error(w, r, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		chatID, err := strconv.ParseInt(chi.URLParam(r, "ID"), 10, 64)
+		if err != nil {
+			response.Error(w, r, http.StatusBadRequest, "Invalid chat ID")
+			return
+		}
+		messageID, err := strconv.ParseInt(chi.URLParam(r, "messageID"), 10, 64)
+		if err != nil {
+			response.Error(w, r, http.StatusBadRequest, "Invalid message ID")
+			return
+		}
+
+		sender, err := deleter.GetMessageSender(r.Context(), chatID, messageID)
+		if errors.Is(err, storage.ErrMessageNotFound) {
+			response.ErrorFor(w, r, err, "Message not found")
+			return
+		}
+		if err != nil {
+			log.Error("failed to get message", sl.Err(err))
+			response.FromError(w, r, err, "Failed to delete the message")
+			return
+		}
+
+		var action chatrole.Action
+		if sender != claims.Username {
+			action = chatrole.DeleteMessages
+		}
+
+		if _, ok := chatmaker_handler.RequireChatAction(w, r, log, deleter, chatID, claims.Username, action); !ok {
+			return
+		}
+
+		keys, err := deleter.DeleteMessage(r.Context(), chatID, messageID)
+		if errors.Is(err, storage.ErrMessageNotFound) {
+			response.ErrorFor(w, r, err, "Message not found")
+			return
+		}
+		if err != nil {
+			log.Error("failed to delete message", sl.Err(err))
+			response.FromError(w, r, err, "Failed to delete the message")
+			return
+		}
+
+		log.Info("message deleted",
+			slog.Int64("chat_id", chatID), slog.Int64("id", messageID), slog.String("by", claims.Username),
+		)
+
+		for _, key := range keys {
+			if err := blobs.Delete(r.Context(), key); err != nil {
+				log.Error("failed to delete attachment", slog.String("key", key), sl.Err(err))
+			}
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
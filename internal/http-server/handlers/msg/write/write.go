@@ -1,13 +1,22 @@
 package write
 
 import (
-	val "chat_go/internal/lib/api/validation"
+	chatmaker_handler "chat_go/internal/http-server/handlers/chatmaker"
+	"chat_go/internal/lib/api/models"
+	"chat_go/internal/lib/api/response"
+	"chat_go/internal/lib/chatrole"
+	"chat_go/internal/lib/events"
+	"chat_go/internal/lib/jwts"
 	"chat_go/internal/lib/logger/sl"
+	"chat_go/internal/lib/mention"
+	"chat_go/internal/lib/metrics"
+	"chat_go/internal/storage"
+	"context"
+	"errors"
 	"log/slog"
 	"net/http"
-	"strings"
 
-	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
 	"github.com/go-playground/validator/v10"
 )
@@ -19,28 +28,46 @@ type Request struct {
 }
 
 type MessagesInteractor interface {
-	SaveMessage(sender string, chatName string, chatID int64, text string) (int64, error)
-	GetParticipantsByChatNameAndID(chatName string, id int64) (string, error)
+	SaveMessage(ctx context.Context, sender string, chatName string, chatID int64, text string) (int64, error)
+	GetChatInfo(ctx context.Context, chatID int64) (models.ChatInfo, error)
+	GetChatRole(ctx context.Context, chatID int64, username string) (string, error)
+	SaveMentions(ctx context.Context, chatID int64, messageID int64, usernames []string) ([]string, error)
 }
 
-func NewWriteMessagesHandler(log *slog.Logger, messageInteractor MessagesInteractor) http.HandlerFunc {
+type MentionSaver interface {
+	SaveMentions(ctx context.Context, chatID int64, messageID int64, usernames []string) ([]string, error)
+}
+
+type EventPublisher interface {
+	Publish(ctx context.Context, e events.Event)
+}
+
+func NewWriteMessagesHandler(log *slog.Logger, messageInteractor MessagesInteractor, publisher EventPublisher) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handlers.msg.Write"
 
 		if r.Method != http.MethodPost {
-			http.Error(w, "Wrong method", http.StatusMethodNotAllowed)
+			response.Error(w, r, http.StatusMethodNotAllowed, "Wrong method")
+			return
 		}
 
-		log = log.With(slog.String("op", op),
+		log := log.With(slog.String("op", op),
 			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
 		)
 
+		claims, ok := r.Context().Value("claims").(jwts.Claims)
+		if !ok {
+			response.Error(w, r, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
 		var req Request
 
 		err := render.DecodeJSON(r.Body, &req)
 		if err != nil {
 			log.Error("failed to decode request body", sl.Err(err))
-			http.Error(w, "Failed to decode request body", http.StatusInternalServerError)
+			response.Error(w, r, http.StatusBadRequest, "Failed to decode request body")
 			return
 		}
 
@@ -49,41 +76,75 @@ func NewWriteMessagesHandler(log *slog.Logger, messageInteractor MessagesInterac
 		if err := validator.New().Struct(req); err != nil {
 			validateErr := err.(validator.ValidationErrors)
 			log.Error("invalid request", sl.Err(err))
-			http.Error(w, val.ValidationError(validateErr), http.StatusBadRequest)
+			response.ValidationError(w, r, validateErr)
 			return
 		}
 
-		cookie, err := r.Cookie("your_username")
-		if err != nil {
-			log.Error("failed checking cookie", sl.Err(err))
-			http.Error(w, "Failed checking your cookie", http.StatusInternalServerError)
+		sender := claims.Username
+
+		info, err := messageInteractor.GetChatInfo(r.Context(), req.ID)
+		if errors.Is(err, storage.ErrChatNotFound) || err == nil && info.Name != req.ChatName {
+			response.ErrorFor(w, r, storage.ErrChatNotFound, "Chat not found")
 			return
 		}
-
-		sender := cookie.Value
-
-		participants, err := messageInteractor.GetParticipantsByChatNameAndID(req.ChatName, req.ID)
 		if err != nil {
-			log.Error("failed validating your participation in this chat", sl.Err(err))
-			http.Error(w, "Failed validating your participation in this chat", http.StatusBadRequest)
+			log.Error("failed to get chat info", sl.Err(err))
+			response.FromError(w, r, err, "Failed to write a message")
 			return
 		}
 
-		if !strings.Contains(participants, sender) {
-			log.Warn("You are not in this chat")
-			http.Error(w, "You are not in this chat", http.StatusForbidden)
+		// Only admins can post in a channel, the subscribers read.
+		var action chatrole.Action
+		if info.Kind == models.ChatKindChannel {
+			action = chatrole.Broadcast
+		}
+		if _, ok := chatmaker_handler.RequireChatAction(w, r, log, messageInteractor, req.ID, sender, action); !ok {
 			return
 		}
 
-		id, err := messageInteractor.SaveMessage(sender, req.ChatName, req.ID, req.Text)
+		id, err := messageInteractor.SaveMessage(r.Context(), sender, req.ChatName, req.ID, req.Text)
 		if err != nil {
 			log.Error("failed to write a message", sl.Err(err))
-			http.Error(w, "Failed to write a message", http.StatusInternalServerError)
+			response.FromError(w, r, err, "Failed to write a message")
 			return
 		}
+		metrics.MessageWritten()
 		log.Info("message added", slog.Int64("id", id))
+
+		NotifyMentions(r.Context(), log, messageInteractor, publisher, req.ID, req.ChatName, id, sender, req.Text)
+
 		w.Write([]byte("You have successfully written a message!"))
-		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// NotifyMentions saves the chat members mentioned in the message and publishes
+// an event for each of them. sender must be the authenticated author, the
+// notifications go out in their name. Failing here doesn't undo the message.
+func NotifyMentions(ctx context.Context, log *slog.Logger, saver MentionSaver, publisher EventPublisher, chatID int64, chatName string, messageID int64, sender string, text string) {
+	var usernames []string
+	for _, username := range mention.Parse(text) {
+		if username != sender {
+			usernames = append(usernames, username)
+		}
+	}
+	if len(usernames) == 0 {
+		return
+	}
+
+	mentioned, err := saver.SaveMentions(ctx, chatID, messageID, usernames)
+	if err != nil {
+		log.Error("failed to save mentions", sl.Err(err))
+		return
+	}
 
+	for _, username := range mentioned {
+		publisher.Publish(ctx, events.Mention{
+			ChatID:    chatID,
+			ChatName:  chatName,
+			MessageID: messageID,
+			Sender:    sender,
+			Username:  username,
+			Text:      text,
+		})
 	}
 }
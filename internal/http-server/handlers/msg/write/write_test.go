@@ -0,0 +1,151 @@
+package write_test
+
+import (
+	"chat_go/internal/http-server/handlers/msg/write"
+	"chat_go/internal/lib/api/models"
+	"chat_go/internal/lib/events"
+	"chat_go/internal/lib/jwts"
+	"chat_go/internal/storage/sqlite"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// recorder keeps the events it is given.
+type recorder struct {
+	events []events.Event
+}
+
+func (p *recorder) Publish(ctx context.Context, e events.Event) {
+	p.events = append(p.events, e)
+}
+
+func newStorage(t *testing.T) *sqlite.Storage {
+	t.Helper()
+
+	st, err := sqlite.New(filepath.Join(t.TempDir(), "chat.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+
+	for _, username := range []string{"@alice", "@bob", "@bo"} {
+		if _, err := st.SaveUser(context.Background(), "bio", "Passw0rd!x", "n", username, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return st
+}
+
+// post writes text to the chat as username, who is logged in. cookie is the
+// your_username cookie the client sends, if any.
+func post(t *testing.T, st *sqlite.Storage, publisher write.EventPublisher, username string, cookie string, chatName string, chatID int64, text string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	body := fmt.Sprintf(`{"ChatName": %q, "ID": %d, "Text": %q}`, chatName, chatID, text)
+	r := httptest.NewRequest(http.MethodPost, "/chat/write", strings.NewReader(body))
+	if cookie != "" {
+		r.AddCookie(&http.Cookie{Name: "your_username", Value: cookie})
+	}
+	r = r.WithContext(context.WithValue(r.Context(), "claims", jwts.Claims{Username: username}))
+
+	w := httptest.NewRecorder()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	write.NewWriteMessagesHandler(log, st, publisher).ServeHTTP(w, r)
+	return w
+}
+
+func TestWriteIgnoresTheUsernameCookie(t *testing.T) {
+	st := newStorage(t)
+	ctx := context.Background()
+
+	id, err := st.MakeChat(ctx, "ann", models.ChatKindChannel, true, "@alice", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.JoinChannel(ctx, id, "@bob"); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := post(t, st, &recorder{}, "@bob", "@alice", "ann", id, "forged"); w.Code != http.StatusForbidden {
+		t.Fatalf("subscriber posting as the owner: got %d, want 403", w.Code)
+	}
+	if w := post(t, st, &recorder{}, "@alice", "@bob", "ann", id, "news"); w.Code != http.StatusOK {
+		t.Fatalf("owner posting: got %d, want 200", w.Code)
+	}
+
+	messages, err := st.GetAllMessagesByChatnameAndID(ctx, "ann", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || messages[0].Sender != "@alice" || messages[0].Text != "news" {
+		t.Fatalf("messages: %+v", messages)
+	}
+}
+
+func TestWriteNeedsMembership(t *testing.T) {
+	st := newStorage(t)
+
+	id, err := st.MakeChat(context.Background(), "group", models.ChatKindGroup, false, "@alice", []string{"@bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// @bo is part of "@bob", but not in the chat.
+	if w := post(t, st, &recorder{}, "@bo", "@bob", "group", id, "hi"); w.Code != http.StatusForbidden {
+		t.Fatalf("non-member: got %d, want 403", w.Code)
+	}
+	if w := post(t, st, &recorder{}, "@bob", "", "group", id, "hi"); w.Code != http.StatusOK {
+		t.Fatalf("member: got %d, want 200", w.Code)
+	}
+	if w := post(t, st, &recorder{}, "@bob", "", "other", id, "hi"); w.Code != http.StatusNotFound {
+		t.Fatalf("wrong chat name: got %d, want 404", w.Code)
+	}
+}
+
+func TestMentionsComeFromTheSender(t *testing.T) {
+	st := newStorage(t)
+	ctx := context.Background()
+
+	id, err := st.MakeChat(ctx, "group", models.ChatKindGroup, false, "@alice", []string{"@bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publisher := &recorder{}
+	if w := post(t, st, publisher, "@bob", "@alice", "group", id, "forged @alice"); w.Code != http.StatusOK {
+		t.Fatalf("got %d, want 200", w.Code)
+	}
+
+	mentions, err := st.GetMentions(ctx, "@alice", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mentions) != 1 || mentions[0].Sender != "@bob" {
+		t.Fatalf("mentions of @alice: %+v", mentions)
+	}
+	if len(publisher.events) != 1 || publisher.events[0].(events.Mention).Sender != "@bob" {
+		t.Fatalf("events: %+v", publisher.events)
+	}
+}
+
+func TestWriteNeedsLogin(t *testing.T) {
+	st := newStorage(t)
+
+	r := httptest.NewRequest(http.MethodPost, "/chat/write", strings.NewReader(`{"ChatName": "group", "ID": 1, "Text": "hi"}`))
+	r.AddCookie(&http.Cookie{Name: "your_username", Value: "@alice"})
+
+	w := httptest.NewRecorder()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	write.NewWriteMessagesHandler(log, st, &recorder{}).ServeHTTP(w, r)
+
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), `"code":"unauthorized"`) {
+		t.Fatalf("got %d %s, want 401", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,89 @@
+package admin_handler
+
+import (
+	"chat_go/internal/lib/api/response"
+	"chat_go/internal/lib/lockout"
+	"chat_go/internal/lib/logger/sl"
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+type UnlockIPRequest struct {
+	IP string `json:"IP"`
+}
+
+type Unlocker interface {
+	UnlockAccount(username string)
+	UnlockIP(ip string)
+}
+
+type Auditor interface {
+	SaveAuditEvent(ctx context.Context, kind, subject, ip, detail string) error
+}
+
+func NewUnlockAccountHandler(log *slog.Logger, unlocker Unlocker, auditor Auditor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.user.admin.UnlockAccount"
+
+		log := log.With(slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		username := chi.URLParam(r, "username")
+		if username == "" || username[0] != '@' {
+			response.Error(w, r, http.StatusBadRequest, "Username must start with @")
+			return
+		}
+
+		unlocker.UnlockAccount(username)
+
+		log.Info("account unlocked", slog.String("audit", "account_unlocked"), slog.String("user", username))
+		if err := auditor.SaveAuditEvent(r.Context(), "account_unlocked", username, lockout.ClientIP(r), "unlocked by admin"); err != nil {
+			log.Error("failed to save audit event", sl.Err(err))
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func NewUnlockIPHandler(log *slog.Logger, unlocker Unlocker, auditor Auditor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.user.admin.UnlockIP"
+
+		log := log.With(slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		var req UnlockIPRequest
+
+		err := render.DecodeJSON(r.Body, &req)
+		if err != nil {
+			log.Error("failed to decode request body", sl.Err(err))
+			response.Error(w, r, http.StatusBadRequest, "Failed to decode request body")
+			return
+		}
+
+		ip := req.IP
+		if net.ParseIP(ip) == nil {
+			response.Error(w, r, http.StatusBadRequest, "Invalid IP address")
+			return
+		}
+
+		unlocker.UnlockIP(ip)
+
+		log.Info("ip unlocked", slog.String("audit", "ip_unlocked"), slog.String("ip", ip))
+		if err := auditor.SaveAuditEvent(r.Context(), "ip_unlocked", ip, lockout.ClientIP(r), "unlocked by admin"); err != nil {
+			log.Error("failed to save audit event", sl.Err(err))
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
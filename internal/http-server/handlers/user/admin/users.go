@@ -0,0 +1,249 @@
+package admin_handler
+
+import (
+	"chat_go/internal/lib/api/models"
+	"chat_go/internal/lib/api/page"
+	"chat_go/internal/lib/api/response"
+	"chat_go/internal/lib/jwts"
+	"chat_go/internal/lib/lockout"
+	"chat_go/internal/lib/logger/sl"
+	"chat_go/internal/lib/rbac"
+	"chat_go/internal/storage"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+)
+
+type SetRoleRequest struct {
+	Role string `json:"Role" validate:"required"`
+}
+
+type UserLister interface {
+	ListUsers(ctx context.Context, limit int, offset int) ([]models.Account, error)
+}
+
+type UserManager interface {
+	GetUsernameByID(ctx context.Context, id int64) (string, error)
+	GetRole(ctx context.Context, username string) (string, error)
+}
+
+type UserSuspender interface {
+	UserManager
+	SetSuspended(ctx context.Context, username string, suspended bool) error
+}
+
+type UserDeleter interface {
+	UserManager
+	DeleteUser(ctx context.Context, username string) error
+}
+
+type RoleSetter interface {
+	UserManager
+	SetRole(ctx context.Context, username string, role string) error
+}
+
+func NewListUsersHandler(log *slog.Logger, lister UserLister) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.user.admin.ListUsers"
+
+		log := log.With(slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		limit, offset, err := page.FromQuery(r)
+		if err != nil {
+			response.Error(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		accounts, err := lister.ListUsers(r.Context(), limit, offset)
+		if err != nil {
+			log.Error("failed to list users", sl.Err(err))
+			response.FromError(w, r, err, "Failed to list users")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(accounts)
+	}
+}
+
+// NewSuspendHandler suspends the user, or reinstates the user when suspend is
+// false. Suspended users can't login and their sessions are revoked.
+func NewSuspendHandler(log *slog.Logger, suspender UserSuspender, auditor Auditor, suspend bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.user.admin.Suspend"
+
+		log := log.With(slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		username := chi.URLParam(r, "username")
+
+		actor, ok := checkTarget(w, r, log, suspender, username)
+		if !ok {
+			return
+		}
+
+		if err := suspender.SetSuspended(r.Context(), username, suspend); err != nil {
+			log.Error("failed to update user", sl.Err(err))
+			response.FromError(w, r, err, "Failed to update user")
+			return
+		}
+
+		kind := "user_suspended"
+		if !suspend {
+			kind = "user_reinstated"
+		}
+
+		audit(log, auditor, r, kind, username, actor)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func NewDeleteUserHandler(log *slog.Logger, deleter UserDeleter, auditor Auditor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.user.admin.DeleteUser"
+
+		log := log.With(slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		username := chi.URLParam(r, "username")
+
+		actor, ok := checkTarget(w, r, log, deleter, username)
+		if !ok {
+			return
+		}
+
+		err := deleter.DeleteUser(r.Context(), username)
+		if errors.Is(err, storage.ErrUserNotFound) {
+			response.ErrorFor(w, r, err, "User not found")
+			return
+		}
+		if err != nil {
+			log.Error("failed to delete user", sl.Err(err))
+			response.FromError(w, r, err, "Failed to delete user")
+			return
+		}
+
+		audit(log, auditor, r, "user_deleted", username, actor)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func NewSetRoleHandler(log *slog.Logger, setter RoleSetter, auditor Auditor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.user.admin.SetRole"
+
+		log := log.With(slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		var req SetRoleRequest
+
+		err := render.DecodeJSON(r.Body, &req)
+		if err != nil {
+			log.Error("failed to decode request body", sl.Err(err))
+			response.Error(w, r, http.StatusBadRequest, "Failed to decode request body")
+			return
+		}
+
+		if err := validator.New().Struct(req); err != nil {
+			validateErr := err.(validator.ValidationErrors)
+			log.Error("invalid request", sl.Err(err))
+			response.ValidationError(w, r, validateErr)
+			return
+		}
+
+		role, err := rbac.ParseRole(req.Role)
+		if err != nil {
+			response.Error(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		username := chi.URLParam(r, "username")
+
+		actor, ok := checkTarget(w, r, log, setter, username)
+		if !ok {
+			return
+		}
+
+		if err := setter.SetRole(r.Context(), username, string(role)); err != nil {
+			log.Error("failed to set role", sl.Err(err))
+			response.FromError(w, r, err, "Failed to set role")
+			return
+		}
+
+		audit(log, auditor, r, "role_changed", username, actor+", new role "+string(role))
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// checkTarget makes sure the logged in user may manage username: nobody can
+// manage themselves, and the target's role must be below the actor's. It
+// returns the actor's username, or false after writing the error.
+func checkTarget(w http.ResponseWriter, r *http.Request, log *slog.Logger, users UserManager, username string) (string, bool) {
+	if username == "" || username[0] != '@' {
+		response.Error(w, r, http.StatusBadRequest, "Username must start with @")
+		return "", false
+	}
+
+	claims, ok := r.Context().Value("claims").(jwts.Claims)
+	if !ok {
+		response.Error(w, r, http.StatusUnauthorized, "Unauthorized")
+		return "", false
+	}
+
+	actor, err := users.GetUsernameByID(r.Context(), claims.UserID)
+	if err != nil {
+		log.Error("failed to get user", sl.Err(err))
+		response.FromError(w, r, err, "Failed to update user")
+		return "", false
+	}
+
+	if actor == username {
+		response.Error(w, r, http.StatusBadRequest, "You cannot manage your own account")
+		return "", false
+	}
+
+	targetRole, err := users.GetRole(r.Context(), username)
+	if errors.Is(err, storage.ErrUserNotFound) {
+		response.ErrorFor(w, r, err, "User not found")
+		return "", false
+	}
+	if err != nil {
+		log.Error("failed to get role", sl.Err(err))
+		response.FromError(w, r, err, "Failed to update user")
+		return "", false
+	}
+
+	if !rbac.Role(claims.Role).Outranks(rbac.Role(targetRole)) {
+		log.Warn("target outranks actor", slog.String("actor", actor), slog.String("user", username))
+		response.Error(w, r, http.StatusForbidden, "Forbidden")
+		return "", false
+	}
+
+	return actor, true
+}
+
+func audit(log *slog.Logger, auditor Auditor, r *http.Request, kind string, username string, actor string) {
+	log.Info("user updated", slog.String("audit", kind), slog.String("user", username), slog.String("actor", actor))
+	if err := auditor.SaveAuditEvent(r.Context(), kind, username, lockout.ClientIP(r), "by "+actor); err != nil {
+		log.Error("failed to save audit event", sl.Err(err))
+	}
+}
@@ -1,11 +1,19 @@
 package login_handler
 
 import (
-	val "chat_go/internal/lib/api/validation"
+	"chat_go/internal/lib/api/response"
+	"chat_go/internal/lib/lockout"
 	"chat_go/internal/lib/logger/sl"
+	"chat_go/internal/lib/metrics"
+	"chat_go/internal/storage"
+	"context"
 	"encoding/json"
+	"errors"
 	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 )
@@ -16,16 +24,27 @@ type Request struct {
 }
 
 type UserLoginer interface {
-	LoginUser(username, password string) (string, error)
+	LoginUser(ctx context.Context, username, password string) (string, bool, error)
+	Auditor
 }
 
-func NewLoginHandler(log *slog.Logger, userInteractor UserLoginer) http.HandlerFunc {
+type Auditor interface {
+	SaveAuditEvent(ctx context.Context, kind, subject, ip, detail string) error
+}
+
+type LoginGuard interface {
+	Allow(username, ip string) (time.Duration, bool)
+	Fail(username, ip string) (bool, bool)
+	Succeed(username string)
+}
+
+func NewLoginHandler(log *slog.Logger, userInteractor UserLoginer, guard LoginGuard) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 
 		var req Request
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			response.Error(w, r, http.StatusBadRequest, "Failed to decode request body")
 			log.Error("error decoding request", sl.Err(err))
 			return
 		}
@@ -33,16 +52,49 @@ func NewLoginHandler(log *slog.Logger, userInteractor UserLoginer) http.HandlerF
 		if err := validator.New().Struct(req); err != nil {
 			validateErr := err.(validator.ValidationErrors)
 			log.Error("invalid request", sl.Err(err))
-			http.Error(w, val.ValidationError(validateErr), http.StatusBadRequest)
+			response.ValidationError(w, r, validateErr)
 			return
 		}
 
-		token, err := userInteractor.LoginUser(req.Username, req.Password)
-		if err != nil {
-			http.Error(w, "Invalid login or password", http.StatusUnauthorized)
+		ip := lockout.ClientIP(r)
+
+		if wait, ok := guard.Allow(req.Username, ip); !ok {
+			metrics.LoginFailed()
+			TooManyAttempts(w, r, wait)
+			log.Warn("login throttled", slog.String("user", req.Username), slog.String("ip", ip))
+			return
+		}
+
+		token, mfaPending, err := userInteractor.LoginUser(r.Context(), req.Username, req.Password)
+		if errors.Is(err, storage.ErrInvalidLoginOrPassword) {
+			accountLocked, ipLocked := guard.Fail(req.Username, ip)
+			AuditLockout(r.Context(), log, userInteractor, req.Username, ip, accountLocked, ipLocked)
+			metrics.LoginFailed()
+			response.Error(w, r, http.StatusUnauthorized, "Invalid login or password")
 			log.Error("invalid login or password", sl.Err(err))
 			return
 		}
+		if errors.Is(err, storage.ErrUserSuspended) {
+			metrics.LoginFailed()
+			response.ErrorFor(w, r, err, "Account is suspended")
+			log.Warn("suspended user tried to login", slog.String("user", req.Username))
+			return
+		}
+		if err != nil {
+			response.FromError(w, r, err, "Failed to login")
+			log.Error("failed to login", sl.Err(err))
+			return
+		}
+
+		if mfaPending {
+			resp := map[string]interface{}{"mfa_required": true, "mfa_token": token}
+			json.NewEncoder(w).Encode(resp)
+
+			log.Info("password accepted, waiting for second factor")
+			return
+		}
+
+		guard.Succeed(req.Username)
 
 		http.SetCookie(w, &http.Cookie{
 			Name:     "auth_token",
@@ -60,9 +112,32 @@ func NewLoginHandler(log *slog.Logger, userInteractor UserLoginer) http.HandlerF
 			Secure:   true,
 		})
 
-		response := map[string]string{"token": token}
-		json.NewEncoder(w).Encode(response)
+		resp := map[string]string{"token": token}
+		json.NewEncoder(w).Encode(resp)
 
+		metrics.LoginSucceeded()
 		log.Info("success Login")
 	}
 }
+
+// TooManyAttempts answers a throttled login attempt.
+func TooManyAttempts(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	response.Error(w, r, http.StatusTooManyRequests, "Too many failed login attempts, try again later")
+}
+
+// AuditLockout records the lockouts caused by a failed attempt.
+func AuditLockout(ctx context.Context, log *slog.Logger, auditor Auditor, username, ip string, accountLocked, ipLocked bool) {
+	if accountLocked {
+		log.Warn("account locked out", slog.String("audit", "account_locked"), slog.String("user", username), slog.String("ip", ip))
+		if err := auditor.SaveAuditEvent(ctx, "account_locked", username, ip, "too many failed login attempts"); err != nil {
+			log.Error("failed to save audit event", sl.Err(err))
+		}
+	}
+	if ipLocked {
+		log.Warn("ip locked out", slog.String("audit", "ip_locked"), slog.String("user", username), slog.String("ip", ip))
+		if err := auditor.SaveAuditEvent(ctx, "ip_locked", ip, ip, "too many failed login attempts"); err != nil {
+			log.Error("failed to save audit event", sl.Err(err))
+		}
+	}
+}
@@ -0,0 +1,321 @@
+package mfa_handler
+
+import (
+	login_handler "chat_go/internal/http-server/handlers/user/login"
+	"chat_go/internal/lib/api/response"
+	"chat_go/internal/lib/jwts"
+	"chat_go/internal/lib/lockout"
+	"chat_go/internal/lib/logger/sl"
+	"chat_go/internal/lib/metrics"
+	"chat_go/internal/lib/totp"
+	"chat_go/internal/storage"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+)
+
+type ConfirmRequest struct {
+	Code string `json:"Code" validate:"required"`
+}
+
+type LoginRequest struct {
+	MFAToken string `json:"MFAToken" validate:"required"`
+	Code     string `json:"Code" validate:"required"`
+}
+
+type EnrollResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type ConfirmResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type TOTPEnroller interface {
+	GetUsernameByID(ctx context.Context, id int64) (string, error)
+	SetTOTPSecret(ctx context.Context, userID int64, secret string) error
+}
+
+type TOTPConfirmer interface {
+	GetTOTP(ctx context.Context, userID int64) (string, bool, error)
+	UseTOTPCounter(ctx context.Context, userID int64, counter int64) error
+	EnableTOTP(ctx context.Context, userID int64, recoveryCodes []string) error
+}
+
+type MFAVerifier interface {
+	GetUsernameByID(ctx context.Context, id int64) (string, error)
+	GetTOTP(ctx context.Context, userID int64) (string, bool, error)
+	UseTOTPCounter(ctx context.Context, userID int64, counter int64) error
+	UseRecoveryCode(ctx context.Context, userID int64, code string) error
+	GetClaims(ctx context.Context, userID int64) (jwts.Claims, error)
+	login_handler.Auditor
+}
+
+// NewEnrollHandler generates a new authenticator secret for the logged in user.
+// The secret stays inactive until it is confirmed with NewConfirmHandler.
+func NewEnrollHandler(log *slog.Logger, enroller TOTPEnroller, issuer string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.user.mfa.Enroll"
+
+		log := log.With(slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		userID, ok := r.Context().Value("userid").(int64)
+		if !ok {
+			response.Error(w, r, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		username, err := enroller.GetUsernameByID(r.Context(), userID)
+		if err != nil {
+			log.Error("failed to get user", sl.Err(err))
+			response.FromError(w, r, err, "Failed to get user")
+			return
+		}
+
+		secret, err := totp.GenerateSecret()
+		if err != nil {
+			log.Error("failed to generate secret", sl.Err(err))
+			response.FromError(w, r, err, "Failed to generate secret")
+			return
+		}
+
+		err = enroller.SetTOTPSecret(r.Context(), userID, secret)
+		if errors.Is(err, storage.ErrMFAAlreadyEnabled) {
+			response.ErrorFor(w, r, err, "Two-factor authentication is already enabled")
+			return
+		}
+		if err != nil {
+			log.Error("failed to save secret", sl.Err(err))
+			response.FromError(w, r, err, "Failed to save secret")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(EnrollResponse{
+			Secret:          secret,
+			ProvisioningURI: totp.ProvisioningURI(issuer, username, secret),
+		})
+
+		log.Info("totp enrollment started", slog.Int64("user_id", userID))
+	}
+}
+
+// NewConfirmHandler activates the enrolled authenticator once the user proves
+// it works, and returns one-time recovery codes. The codes are shown only once.
+func NewConfirmHandler(log *slog.Logger, confirmer TOTPConfirmer, recoveryCodeCount int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.user.mfa.Confirm"
+
+		log := log.With(slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		userID, ok := r.Context().Value("userid").(int64)
+		if !ok {
+			response.Error(w, r, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		var req ConfirmRequest
+
+		err := render.DecodeJSON(r.Body, &req)
+		if err != nil {
+			log.Error("failed to decode request body", sl.Err(err))
+			response.Error(w, r, http.StatusBadRequest, "Failed to decode request body")
+			return
+		}
+
+		if err := validator.New().Struct(req); err != nil {
+			validateErr := err.(validator.ValidationErrors)
+			log.Error("invalid request", sl.Err(err))
+			response.ValidationError(w, r, validateErr)
+			return
+		}
+
+		secret, enabled, err := confirmer.GetTOTP(r.Context(), userID)
+		if errors.Is(err, storage.ErrMFANotEnrolled) {
+			response.ErrorFor(w, r, err, "Two-factor authentication is not enrolled")
+			return
+		}
+		if err != nil {
+			log.Error("failed to get totp secret", sl.Err(err))
+			response.FromError(w, r, err, "Failed to confirm two-factor authentication")
+			return
+		}
+		if enabled {
+			response.Error(w, r, http.StatusConflict, "Two-factor authentication is already enabled")
+			return
+		}
+
+		counter, ok := totp.Validate(req.Code, secret, time.Now())
+		if !ok {
+			response.Error(w, r, http.StatusBadRequest, "Invalid code")
+			return
+		}
+
+		// The code that confirms the authenticator can't be used to login.
+		err = confirmer.UseTOTPCounter(r.Context(), userID, counter)
+		if errors.Is(err, storage.ErrTOTPCodeUsed) {
+			response.Error(w, r, http.StatusBadRequest, "Invalid code")
+			return
+		}
+		if err != nil {
+			log.Error("failed to record totp code", sl.Err(err))
+			response.FromError(w, r, err, "Failed to confirm two-factor authentication")
+			return
+		}
+
+		codes, err := totp.GenerateRecoveryCodes(recoveryCodeCount)
+		if err != nil {
+			log.Error("failed to generate recovery codes", sl.Err(err))
+			response.FromError(w, r, err, "Failed to confirm two-factor authentication")
+			return
+		}
+
+		if err := confirmer.EnableTOTP(r.Context(), userID, codes); err != nil {
+			log.Error("failed to enable totp", sl.Err(err))
+			response.FromError(w, r, err, "Failed to confirm two-factor authentication")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ConfirmResponse{RecoveryCodes: codes})
+
+		log.Info("totp enabled", slog.Int64("user_id", userID))
+	}
+}
+
+// NewLoginMFAHandler exchanges an mfa pending token and a TOTP or recovery code
+// for the real auth token.
+func NewLoginMFAHandler(log *slog.Logger, verifier MFAVerifier, guard login_handler.LoginGuard) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.user.mfa.Login"
+
+		log := log.With(slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		w.Header().Set("Content-Type", "application/json")
+
+		var req LoginRequest
+
+		err := render.DecodeJSON(r.Body, &req)
+		if err != nil {
+			log.Error("failed to decode request body", sl.Err(err))
+			response.Error(w, r, http.StatusBadRequest, "Failed to decode request body")
+			return
+		}
+
+		if err := validator.New().Struct(req); err != nil {
+			validateErr := err.(validator.ValidationErrors)
+			log.Error("invalid request", sl.Err(err))
+			response.ValidationError(w, r, validateErr)
+			return
+		}
+
+		userID, err := jwts.VerifyMFAPendingToken(req.MFAToken)
+		if err != nil {
+			log.Error("invalid mfa token", sl.Err(err))
+			response.Error(w, r, http.StatusUnauthorized, "Invalid or expired mfa token")
+			return
+		}
+
+		username, err := verifier.GetUsernameByID(r.Context(), userID)
+		if err != nil {
+			log.Error("failed to get user", sl.Err(err))
+			response.FromError(w, r, err, "Failed to login")
+			return
+		}
+
+		ip := lockout.ClientIP(r)
+
+		if wait, ok := guard.Allow(username, ip); !ok {
+			metrics.LoginFailed()
+			login_handler.TooManyAttempts(w, r, wait)
+			log.Warn("mfa login throttled", slog.String("user", username), slog.String("ip", ip))
+			return
+		}
+
+		secret, enabled, err := verifier.GetTOTP(r.Context(), userID)
+		if err != nil || !enabled {
+			log.Error("failed to get totp secret", slog.Bool("enabled", enabled))
+			response.Error(w, r, http.StatusUnauthorized, "Invalid code")
+			return
+		}
+
+		counter, isTOTP := totp.Validate(req.Code, secret, time.Now())
+		if isTOTP {
+			err = verifier.UseTOTPCounter(r.Context(), userID, counter)
+		} else {
+			err = verifier.UseRecoveryCode(r.Context(), userID, req.Code)
+		}
+		if err != nil {
+			accountLocked, ipLocked := guard.Fail(username, ip)
+			login_handler.AuditLockout(r.Context(), log, verifier, username, ip, accountLocked, ipLocked)
+			metrics.LoginFailed()
+			log.Warn("invalid second factor", slog.Int64("user_id", userID), sl.Err(err))
+			response.Error(w, r, http.StatusUnauthorized, "Invalid code")
+			return
+		}
+		if !isTOTP {
+			log.Info("recovery code used", slog.Int64("user_id", userID))
+		}
+
+		guard.Succeed(username)
+
+		claims, err := verifier.GetClaims(r.Context(), userID)
+		if errors.Is(err, storage.ErrUserSuspended) {
+			metrics.LoginFailed()
+			log.Warn("suspended user tried to login", slog.Int64("user_id", userID))
+			response.ErrorFor(w, r, err, "Account is suspended")
+			return
+		}
+		if err != nil {
+			log.Error("failed to get claims", sl.Err(err))
+			response.FromError(w, r, err, "Failed to login")
+			return
+		}
+
+		token, err := jwts.GenerateJWTToken(claims)
+		if err != nil {
+			log.Error("failed to generate token", sl.Err(err))
+			response.FromError(w, r, err, "Failed to login")
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     "auth_token",
+			Value:    token,
+			Path:     "/",
+			SameSite: http.SameSiteNoneMode,
+			Secure:   true,
+		})
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     "your_username",
+			Value:    username,
+			Path:     "/",
+			SameSite: http.SameSiteNoneMode,
+			Secure:   true,
+		})
+
+		resp := map[string]string{"token": token}
+		json.NewEncoder(w).Encode(resp)
+
+		metrics.LoginSucceeded()
+		log.Info("success mfa Login")
+	}
+}
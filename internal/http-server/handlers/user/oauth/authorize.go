@@ -0,0 +1,344 @@
+package oauth_handler
+
+import (
+	"chat_go/internal/lib/api/models"
+	"chat_go/internal/lib/api/response"
+	"chat_go/internal/lib/jwts"
+	"chat_go/internal/lib/logger/sl"
+	"chat_go/internal/lib/oidc"
+	"chat_go/internal/storage"
+	"context"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	tokenTypeAccess  = "access"
+	tokenTypeConsent = "consent"
+
+	codeTTL    = 2 * time.Minute
+	consentTTL = 10 * time.Minute
+)
+
+type Authorizer interface {
+	GetOAuthClient(ctx context.Context, clientID string) (models.OAuthClient, error)
+	GetConsent(ctx context.Context, userID int64, clientID string) (string, error)
+	SaveConsent(ctx context.Context, userID int64, clientID string, scope string) error
+	SaveAuthorizationCode(ctx context.Context, code string, authCode models.AuthorizationCode) error
+}
+
+type ConsentResponse struct {
+	Client       string   `json:"client"`
+	Scopes       []string `json:"scopes"`
+	ConsentToken string   `json:"consent_token"`
+}
+
+// authorizeRequest is the part of an authorization request that survives the
+// consent screen, carried in the signed consent token.
+type authorizeRequest struct {
+	ClientID      string
+	RedirectURI   string
+	Scope         string
+	State         string
+	Nonce         string
+	CodeChallenge string
+}
+
+var consentPage = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Sign in with Chat</title></head>
+<body>
+<h1>{{.Client}} wants to use your Chat account</h1>
+<p>It will be able to see:</p>
+<ul>{{range .Scopes}}<li>{{.}}</li>{{end}}</ul>
+<form method="post" action="/oauth/authorize">
+<input type="hidden" name="consent_token" value="{{.ConsentToken}}">
+<button type="submit" name="decision" value="approve">Allow</button>
+<button type="submit" name="decision" value="deny">Deny</button>
+</form>
+</body>
+</html>
+`))
+
+var scopeDescriptions = map[string]string{
+	oidc.ScopeOpenID:  "your user ID",
+	oidc.ScopeProfile: "your username and nickname",
+}
+
+// RedirectToLogin sends a browser that isn't logged in from the authorization
+// endpoint to loginURL, with the URL it came for in return_to, so the login
+// page can send it back. issuer is the public URL of the server, return_to is
+// built on it. Only GET requests are redirected, and an empty loginURL turns
+// the redirect off.
+func RedirectToLogin(loginURL string, issuer string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if loginURL == "" || r.Method != http.MethodGet || loggedIn(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			params := url.Values{}
+			params.Set("return_to", strings.TrimSuffix(issuer, "/")+r.URL.RequestURI())
+
+			http.Redirect(w, r, withQuery(loginURL, params), http.StatusFound)
+		})
+	}
+}
+
+// loggedIn tells whether r carries a valid auth token. Whether its session was
+// revoked is left to the authorization middleware.
+func loggedIn(r *http.Request) bool {
+	cookie, err := r.Cookie("auth_token")
+	if err != nil {
+		return false
+	}
+
+	_, err = jwts.VerifyJWTToken(cookie.Value)
+	return err == nil
+}
+
+// NewAuthorizeHandler starts the authorization code flow for the logged in
+// user. When the user has already consented to the requested scope the code is
+// issued right away, otherwise a consent screen is shown.
+func NewAuthorizeHandler(log *slog.Logger, signer *oidc.Signer, authorizer Authorizer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.user.oauth.Authorize"
+
+		log := log.With(slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		userID, ok := r.Context().Value("userid").(int64)
+		if !ok {
+			response.Error(w, r, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		q := r.URL.Query()
+
+		client, err := authorizer.GetOAuthClient(r.Context(), q.Get("client_id"))
+		if errors.Is(err, storage.ErrClientNotFound) {
+			response.ErrorFor(w, r, err, "Unknown client")
+			return
+		}
+		if err != nil {
+			log.Error("failed to get client", sl.Err(err))
+			response.FromError(w, r, err, "Failed to authorize")
+			return
+		}
+
+		redirectURI := q.Get("redirect_uri")
+		if redirectURI == "" && len(client.RedirectURIs) == 1 {
+			redirectURI = client.RedirectURIs[0]
+		}
+		if !slices.Contains(client.RedirectURIs, redirectURI) {
+			// Never redirect to an unregistered URI, not even to report the error.
+			response.Error(w, r, http.StatusBadRequest, "Invalid redirect URI")
+			return
+		}
+
+		req := authorizeRequest{
+			ClientID:      client.ClientID,
+			RedirectURI:   redirectURI,
+			Scope:         q.Get("scope"),
+			State:         q.Get("state"),
+			Nonce:         q.Get("nonce"),
+			CodeChallenge: q.Get("code_challenge"),
+		}
+
+		if q.Get("response_type") != "code" {
+			redirectError(w, r, req, "unsupported_response_type", "only the code response type is supported")
+			return
+		}
+
+		scopes, err := oidc.ParseScope(req.Scope)
+		if err != nil {
+			redirectError(w, r, req, "invalid_scope", err.Error())
+			return
+		}
+		req.Scope = strings.Join(scopes, " ")
+
+		if req.CodeChallenge == "" || q.Get("code_challenge_method") != oidc.CodeChallengeS256 {
+			redirectError(w, r, req, "invalid_request", "PKCE with the S256 method is required")
+			return
+		}
+
+		granted, err := authorizer.GetConsent(r.Context(), userID, client.ClientID)
+		if err != nil {
+			log.Error("failed to get consent", sl.Err(err))
+			response.FromError(w, r, err, "Failed to authorize")
+			return
+		}
+
+		if granted != "" && oidc.CoversScope(granted, req.Scope) {
+			issueCode(w, r, log, authorizer, userID, req)
+			return
+		}
+
+		consentToken, err := signer.Sign(jwt.MapClaims{
+			"typ":            tokenTypeConsent,
+			"sub":            strconv.FormatInt(userID, 10),
+			"client_id":      req.ClientID,
+			"redirect_uri":   req.RedirectURI,
+			"scope":          req.Scope,
+			"state":          req.State,
+			"nonce":          req.Nonce,
+			"code_challenge": req.CodeChallenge,
+		}, consentTTL)
+		if err != nil {
+			log.Error("failed to sign consent token", sl.Err(err))
+			response.FromError(w, r, err, "Failed to authorize")
+			return
+		}
+
+		page := ConsentResponse{
+			Client:       client.Name,
+			ConsentToken: consentToken,
+		}
+		for _, s := range scopes {
+			page.Scopes = append(page.Scopes, scopeDescriptions[s])
+		}
+
+		if strings.Contains(r.Header.Get("Accept"), "application/json") {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(page)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("X-Frame-Options", "DENY")
+		if err := consentPage.Execute(w, page); err != nil {
+			log.Error("failed to render consent page", sl.Err(err))
+		}
+	}
+}
+
+// NewConsentHandler takes the user's answer from the consent screen. The
+// signed consent token binds the answer to the user and to the original request.
+func NewConsentHandler(log *slog.Logger, signer *oidc.Signer, authorizer Authorizer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.user.oauth.Consent"
+
+		log := log.With(slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		userID, ok := r.Context().Value("userid").(int64)
+		if !ok {
+			response.Error(w, r, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			response.Error(w, r, http.StatusBadRequest, "Invalid form")
+			return
+		}
+
+		claims, err := signer.Verify(r.PostForm.Get("consent_token"))
+		if err != nil || claims["typ"] != tokenTypeConsent || claims["sub"] != strconv.FormatInt(userID, 10) {
+			log.Warn("invalid consent token", slog.Int64("user_id", userID))
+			response.Error(w, r, http.StatusBadRequest, "Invalid or expired consent token")
+			return
+		}
+
+		str := func(key string) string {
+			v, _ := claims[key].(string)
+			return v
+		}
+		req := authorizeRequest{
+			ClientID:      str("client_id"),
+			RedirectURI:   str("redirect_uri"),
+			Scope:         str("scope"),
+			State:         str("state"),
+			Nonce:         str("nonce"),
+			CodeChallenge: str("code_challenge"),
+		}
+
+		if r.PostForm.Get("decision") != "approve" {
+			log.Info("consent denied", slog.Int64("user_id", userID), slog.String("client_id", req.ClientID))
+			redirectError(w, r, req, "access_denied", "the user denied the request")
+			return
+		}
+
+		if err := authorizer.SaveConsent(r.Context(), userID, req.ClientID, req.Scope); err != nil {
+			log.Error("failed to save consent", sl.Err(err))
+			response.FromError(w, r, err, "Failed to authorize")
+			return
+		}
+
+		log.Info("consent granted", slog.Int64("user_id", userID), slog.String("client_id", req.ClientID))
+		issueCode(w, r, log, authorizer, userID, req)
+	}
+}
+
+func issueCode(w http.ResponseWriter, r *http.Request, log *slog.Logger, authorizer Authorizer, userID int64, req authorizeRequest) {
+	code, err := oidc.RandomToken(32)
+	if err != nil {
+		log.Error("failed to generate code", sl.Err(err))
+		response.FromError(w, r, err, "Failed to authorize")
+		return
+	}
+
+	err = authorizer.SaveAuthorizationCode(r.Context(), code, models.AuthorizationCode{
+		ClientID:      req.ClientID,
+		UserID:        userID,
+		RedirectURI:   req.RedirectURI,
+		Scope:         req.Scope,
+		Nonce:         req.Nonce,
+		CodeChallenge: req.CodeChallenge,
+		ExpiresAt:     time.Now().Add(codeTTL),
+	})
+	if err != nil {
+		log.Error("failed to save code", sl.Err(err))
+		response.FromError(w, r, err, "Failed to authorize")
+		return
+	}
+
+	params := url.Values{}
+	params.Set("code", code)
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+
+	http.Redirect(w, r, withQuery(req.RedirectURI, params), http.StatusFound)
+}
+
+func redirectError(w http.ResponseWriter, r *http.Request, req authorizeRequest, code string, description string) {
+	params := url.Values{}
+	params.Set("error", code)
+	params.Set("error_description", description)
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+
+	http.Redirect(w, r, withQuery(req.RedirectURI, params), http.StatusFound)
+}
+
+func withQuery(uri string, params url.Values) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+
+	q := u.Query()
+	for k, v := range params {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
@@ -0,0 +1,199 @@
+package oauth_handler
+
+import (
+	"chat_go/internal/lib/api/models"
+	"chat_go/internal/lib/api/response"
+	"chat_go/internal/lib/logger/sl"
+	"chat_go/internal/lib/oidc"
+	"chat_go/internal/storage"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+)
+
+type RegisterClientRequest struct {
+	Name         string   `json:"Name" validate:"required"`
+	RedirectURIs []string `json:"RedirectURIs" validate:"required,min=1"`
+	Confidential bool     `json:"Confidential"`
+}
+
+type RegisterClientResponse struct {
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret,omitempty"`
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+}
+
+type ClientSaver interface {
+	SaveOAuthClient(ctx context.Context, client models.OAuthClient, secret string) error
+}
+
+type UserInfoGetter interface {
+	GetUserByID(ctx context.Context, id int64) (models.User, error)
+}
+
+func NewDiscoveryHandler(signer *oidc.Signer) http.HandlerFunc {
+	discovery := oidc.NewDiscovery(signer.Issuer())
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(discovery)
+	}
+}
+
+func NewJWKSHandler(signer *oidc.Signer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(signer.JWKS())
+	}
+}
+
+// NewRegisterClientHandler registers a relying party. Confidential clients get
+// a secret, which is shown only once. Public clients rely on PKCE alone.
+func NewRegisterClientHandler(log *slog.Logger, saver ClientSaver) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.user.oauth.RegisterClient"
+
+		log := log.With(slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		var req RegisterClientRequest
+
+		err := render.DecodeJSON(r.Body, &req)
+		if err != nil {
+			log.Error("failed to decode request body", sl.Err(err))
+			response.Error(w, r, http.StatusBadRequest, "Failed to decode request body")
+			return
+		}
+
+		if err := validator.New().Struct(req); err != nil {
+			validateErr := err.(validator.ValidationErrors)
+			log.Error("invalid request", sl.Err(err))
+			response.ValidationError(w, r, validateErr)
+			return
+		}
+
+		for _, uri := range req.RedirectURIs {
+			u, err := url.Parse(uri)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Fragment != "" {
+				response.Error(w, r, http.StatusBadRequest, "Invalid redirect URI: "+uri)
+				return
+			}
+		}
+
+		clientID, err := oidc.RandomToken(16)
+		if err != nil {
+			log.Error("failed to generate client id", sl.Err(err))
+			response.FromError(w, r, err, "Failed to register client")
+			return
+		}
+
+		var secret string
+		if req.Confidential {
+			secret, err = oidc.RandomToken(32)
+			if err != nil {
+				log.Error("failed to generate client secret", sl.Err(err))
+				response.FromError(w, r, err, "Failed to register client")
+				return
+			}
+		}
+
+		client := models.OAuthClient{
+			ClientID:     clientID,
+			Name:         req.Name,
+			RedirectURIs: req.RedirectURIs,
+			Confidential: req.Confidential,
+		}
+
+		if err := saver.SaveOAuthClient(r.Context(), client, secret); err != nil {
+			log.Error("failed to save client", sl.Err(err))
+			response.FromError(w, r, err, "Failed to register client")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(RegisterClientResponse{
+			ClientID:     clientID,
+			ClientSecret: secret,
+			Name:         req.Name,
+			RedirectURIs: req.RedirectURIs,
+		})
+
+		log.Info("oauth client registered", slog.String("client_id", clientID), slog.String("name", req.Name))
+	}
+}
+
+// NewUserInfoHandler returns the claims about the user an access token was issued for.
+func NewUserInfoHandler(log *slog.Logger, signer *oidc.Signer, users UserInfoGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.user.oauth.UserInfo"
+
+		log := log.With(slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		tokenString, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_request"`)
+			response.Error(w, r, http.StatusUnauthorized, "Missing bearer token")
+			return
+		}
+
+		claims, err := signer.Verify(tokenString)
+		if err != nil || claims["typ"] != tokenTypeAccess {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			response.Error(w, r, http.StatusUnauthorized, "Invalid access token")
+			return
+		}
+
+		sub, _ := claims["sub"].(string)
+		userID, err := strconv.ParseInt(sub, 10, 64)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			response.Error(w, r, http.StatusUnauthorized, "Invalid access token")
+			return
+		}
+
+		user, err := users.GetUserByID(r.Context(), userID)
+		if errors.Is(err, storage.ErrUserNotFound) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			response.Error(w, r, http.StatusUnauthorized, "Invalid access token")
+			return
+		}
+		if err != nil {
+			log.Error("failed to get user", sl.Err(err))
+			response.FromError(w, r, err, "Failed to get user info")
+			return
+		}
+
+		scope, _ := claims["scope"].(string)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(userClaims(sub, user, scope))
+	}
+}
+
+// userClaims returns the standard claims about user allowed by scope.
+func userClaims(sub string, user models.User, scope string) map[string]interface{} {
+	claims := map[string]interface{}{"sub": sub}
+
+	if oidc.CoversScope(scope, oidc.ScopeProfile) {
+		claims["preferred_username"] = user.Username
+		claims["name"] = user.Nickname
+	}
+
+	return claims
+}
@@ -0,0 +1,426 @@
+package oauth_handler_test
+
+import (
+	oauth_handler "chat_go/internal/http-server/handlers/user/oauth"
+	"chat_go/internal/lib/api/models"
+	"chat_go/internal/lib/jwts"
+	"chat_go/internal/lib/oidc"
+	"chat_go/internal/storage/sqlite"
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	clientID     = "test-client"
+	clientSecret = "test-secret"
+	redirectURI  = "http://rp.example/callback"
+)
+
+// provider runs the OAuth endpoints of userServer over a real storage. The
+// user with userID counts as logged in for /oauth/authorize.
+type provider struct {
+	srv    *httptest.Server
+	userID int64
+}
+
+func newProvider(t *testing.T) *provider {
+	t.Helper()
+
+	p := &provider{}
+	var handler http.Handler
+	p.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(p.srv.Close)
+
+	st, err := sqlite.New(filepath.Join(t.TempDir(), "chat.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+
+	ctx := context.Background()
+	p.userID, err = st.SaveUser(ctx, "bio", "Passw0rd!x", "Alice", "@alice", "alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.SaveOAuthClient(ctx, models.OAuthClient{
+		ClientID:     clientID,
+		Name:         "Test RP",
+		RedirectURIs: []string{redirectURI},
+		Confidential: true,
+	}, clientSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := oidc.NewSigner(p.srv.URL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	router := chi.NewRouter()
+	router.Get("/.well-known/openid-configuration", oauth_handler.NewDiscoveryHandler(signer))
+	router.Get("/.well-known/jwks", oauth_handler.NewJWKSHandler(signer))
+	router.Post("/oauth/token", oauth_handler.NewTokenHandler(log, signer, st, time.Minute, time.Minute))
+	router.Get("/userinfo", oauth_handler.NewUserInfoHandler(log, signer, st))
+	router.Group(func(r chi.Router) {
+		// Stands in for the login cookie.
+		r.Use(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), "userid", p.userID)))
+			})
+		})
+		r.Get("/oauth/authorize", oauth_handler.NewAuthorizeHandler(log, signer, st))
+		r.Post("/oauth/authorize", oauth_handler.NewConsentHandler(log, signer, st))
+	})
+	handler = router
+
+	return p
+}
+
+// relyingParty is a client of the provider that knows only its issuer URL,
+// like a real one, and checks what it gets back.
+type relyingParty struct {
+	t         *testing.T
+	http      *http.Client
+	discovery oidc.Discovery
+	keys      map[string]*rsa.PublicKey
+}
+
+func newRelyingParty(t *testing.T, issuer string) *relyingParty {
+	t.Helper()
+
+	rp := &relyingParty{
+		t: t,
+		http: &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}},
+		keys: map[string]*rsa.PublicKey{},
+	}
+
+	rp.getJSON(issuer+"/.well-known/openid-configuration", &rp.discovery)
+	if rp.discovery.Issuer != issuer {
+		t.Fatalf("discovery issuer = %q, want %q", rp.discovery.Issuer, issuer)
+	}
+
+	var jwks oidc.JWKS
+	rp.getJSON(rp.discovery.JWKSURI, &jwks)
+	for _, k := range jwks.Keys {
+		n, _ := base64.RawURLEncoding.DecodeString(k.N)
+		e, _ := base64.RawURLEncoding.DecodeString(k.E)
+		rp.keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+
+	return rp
+}
+
+func (rp *relyingParty) getJSON(u string, v any) {
+	rp.t.Helper()
+
+	resp, err := rp.http.Get(u)
+	if err != nil {
+		rp.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		rp.t.Fatalf("GET %s: %s", u, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		rp.t.Fatal(err)
+	}
+}
+
+// authorize runs the authorization request, approving the consent screen if
+// there is one, and returns the code sent to the redirect URI.
+func (rp *relyingParty) authorize(challenge, state, nonce string) string {
+	rp.t.Helper()
+
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {clientID},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {"openid profile"},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {oidc.CodeChallengeS256},
+	}
+	req, _ := http.NewRequest(http.MethodGet, rp.discovery.AuthorizationEndpoint+"?"+q.Encode(), nil)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := rp.http.Do(req)
+	if err != nil {
+		rp.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		var consent oauth_handler.ConsentResponse
+		if err := json.NewDecoder(resp.Body).Decode(&consent); err != nil {
+			rp.t.Fatal(err)
+		}
+
+		resp, err = rp.http.PostForm(rp.discovery.AuthorizationEndpoint, url.Values{
+			"consent_token": {consent.ConsentToken},
+			"decision":      {"approve"},
+		})
+		if err != nil {
+			rp.t.Fatal(err)
+		}
+		defer resp.Body.Close()
+	}
+
+	if resp.StatusCode != http.StatusFound {
+		body, _ := io.ReadAll(resp.Body)
+		rp.t.Fatalf("authorize: %s %s", resp.Status, body)
+	}
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		rp.t.Fatal(err)
+	}
+	if got := location.Scheme + "://" + location.Host + location.Path; got != redirectURI {
+		rp.t.Fatalf("redirected to %q, want %q", got, redirectURI)
+	}
+	if got := location.Query().Get("state"); got != state {
+		rp.t.Fatalf("state = %q, want %q", got, state)
+	}
+	code := location.Query().Get("code")
+	if code == "" {
+		rp.t.Fatalf("no code in %s", location)
+	}
+
+	return code
+}
+
+// exchange redeems code at the token endpoint and returns the status and the
+// decoded answer.
+func (rp *relyingParty) exchange(code, verifier string) (int, map[string]any) {
+	rp.t.Helper()
+
+	req, _ := http.NewRequest(http.MethodPost, rp.discovery.TokenEndpoint, strings.NewReader(url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {verifier},
+	}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(clientID, clientSecret)
+
+	resp, err := rp.http.Do(req)
+	if err != nil {
+		rp.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var body map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		rp.t.Fatal(err)
+	}
+
+	return resp.StatusCode, body
+}
+
+// verifyIDToken checks the ID token with the published keys, as OpenID
+// Connect Core section 3.1.3.7 asks of a relying party.
+func (rp *relyingParty) verifyIDToken(idToken, nonce string) jwt.MapClaims {
+	rp.t.Helper()
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, ok := rp.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key %q", kid)
+		}
+		return key, nil
+	},
+		jwt.WithValidMethods(rp.discovery.IDTokenSigningAlgValuesSupported),
+		jwt.WithIssuer(rp.discovery.Issuer),
+		jwt.WithAudience(clientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		rp.t.Fatalf("id token: %v", err)
+	}
+	if claims["nonce"] != nonce {
+		rp.t.Fatalf("nonce = %v, want %q", claims["nonce"], nonce)
+	}
+
+	return claims
+}
+
+func pkce(t *testing.T) (verifier, challenge string) {
+	t.Helper()
+
+	verifier, err := oidc.RandomToken(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte(verifier))
+
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	p := newProvider(t)
+	rp := newRelyingParty(t, p.srv.URL)
+
+	verifier, challenge := pkce(t)
+	code := rp.authorize(challenge, "state-1", "nonce-1")
+
+	status, tokens := rp.exchange(code, verifier)
+	if status != http.StatusOK {
+		t.Fatalf("token: %d %v", status, tokens)
+	}
+	if tokens["token_type"] != "Bearer" || tokens["scope"] != "openid profile" {
+		t.Fatalf("token response: %v", tokens)
+	}
+
+	idToken, _ := tokens["id_token"].(string)
+	claims := rp.verifyIDToken(idToken, "nonce-1")
+	if claims["sub"] != strconv.FormatInt(p.userID, 10) || claims["preferred_username"] != "@alice" {
+		t.Fatalf("id token claims: %v", claims)
+	}
+
+	accessToken, _ := tokens["access_token"].(string)
+	req, _ := http.NewRequest(http.MethodGet, rp.discovery.UserinfoEndpoint, nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	resp, err := rp.http.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var info map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || info["sub"] != claims["sub"] || info["name"] != "Alice" {
+		t.Fatalf("userinfo: %s %v", resp.Status, info)
+	}
+
+	// The ID token is not an access token.
+	req.Header.Set("Authorization", "Bearer "+idToken)
+	resp, err = rp.http.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("userinfo with the id token: %s", resp.Status)
+	}
+}
+
+func TestCodeCanBeUsedOnce(t *testing.T) {
+	p := newProvider(t)
+	rp := newRelyingParty(t, p.srv.URL)
+
+	verifier, challenge := pkce(t)
+	code := rp.authorize(challenge, "state-1", "nonce-1")
+
+	if status, body := rp.exchange(code, verifier); status != http.StatusOK {
+		t.Fatalf("first exchange: %d %v", status, body)
+	}
+	status, body := rp.exchange(code, verifier)
+	if status != http.StatusBadRequest || body["error"] != "invalid_grant" {
+		t.Fatalf("second exchange: %d %v", status, body)
+	}
+}
+
+func TestPKCEMismatch(t *testing.T) {
+	p := newProvider(t)
+	rp := newRelyingParty(t, p.srv.URL)
+
+	verifier, challenge := pkce(t)
+	code := rp.authorize(challenge, "state-1", "nonce-1")
+
+	other, _ := pkce(t)
+	status, body := rp.exchange(code, other)
+	if status != http.StatusBadRequest || body["error"] != "invalid_grant" {
+		t.Fatalf("exchange with another verifier: %d %v", status, body)
+	}
+
+	// The failed attempt used the code up.
+	status, body = rp.exchange(code, verifier)
+	if status != http.StatusBadRequest || body["error"] != "invalid_grant" {
+		t.Fatalf("exchange after the mismatch: %d %v", status, body)
+	}
+
+	// The consent is remembered, the second authorization skips the screen.
+	verifier, challenge = pkce(t)
+	code = rp.authorize(challenge, "state-2", "nonce-2")
+	if status, body := rp.exchange(code, verifier); status != http.StatusOK {
+		t.Fatalf("exchange with the right verifier: %d %v", status, body)
+	}
+}
+
+func TestRedirectToLogin(t *testing.T) {
+	const issuer = "https://chat.example"
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	serve := func(loginURL string, method string, cookie string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/oauth/authorize?client_id=test-client&state=s", nil)
+		if cookie != "" {
+			r.AddCookie(&http.Cookie{Name: "auth_token", Value: cookie})
+		}
+		w := httptest.NewRecorder()
+		oauth_handler.RedirectToLogin(loginURL, issuer)(next).ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve("https://app.example/login", http.MethodGet, "")
+	if w.Code != http.StatusFound {
+		t.Fatalf("not logged in: got %d, want 302", w.Code)
+	}
+	loc, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := issuer + "/oauth/authorize?client_id=test-client&state=s"
+	if loc.Host != "app.example" || loc.Path != "/login" || loc.Query().Get("return_to") != want {
+		t.Fatalf("redirected to %s", loc)
+	}
+
+	if w := serve("https://app.example/login", http.MethodGet, "not a token"); w.Code != http.StatusFound {
+		t.Fatalf("invalid token: got %d, want 302", w.Code)
+	}
+	token, err := jwts.GenerateJWTToken(jwts.Claims{UserID: 1, Username: "@alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := serve("https://app.example/login", http.MethodGet, token); w.Code != http.StatusTeapot {
+		t.Fatalf("logged in: got %d, want it passed on", w.Code)
+	}
+	// The consent form is posted by a logged in browser, and without a login
+	// page there is nowhere to go.
+	if w := serve("https://app.example/login", http.MethodPost, ""); w.Code != http.StatusTeapot {
+		t.Fatalf("POST: got %d, want it passed on", w.Code)
+	}
+	if w := serve("", http.MethodGet, ""); w.Code != http.StatusTeapot {
+		t.Fatalf("no login URL: got %d, want it passed on", w.Code)
+	}
+}
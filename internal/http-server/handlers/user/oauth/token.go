@@ -0,0 +1,180 @@
+package oauth_handler
+
+import (
+	"chat_go/internal/lib/api/models"
+	"chat_go/internal/lib/logger/sl"
+	"chat_go/internal/lib/oidc"
+	"chat_go/internal/storage"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type TokenIssuer interface {
+	GetOAuthClient(ctx context.Context, clientID string) (models.OAuthClient, error)
+	CheckOAuthClientSecret(ctx context.Context, clientID string, secret string) (bool, error)
+	UseAuthorizationCode(ctx context.Context, code string) (models.AuthorizationCode, error)
+	GetUserByID(ctx context.Context, id int64) (models.User, error)
+}
+
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	IDToken     string `json:"id_token"`
+	Scope       string `json:"scope"`
+}
+
+type tokenError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// NewTokenHandler exchanges an authorization code for an access token and an
+// ID token, as described in RFC 6749 section 4.1.3 and RFC 7636.
+func NewTokenHandler(log *slog.Logger, signer *oidc.Signer, issuer TokenIssuer, accessTokenTTL time.Duration, idTokenTTL time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.user.oauth.Token"
+
+		log := log.With(slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Pragma", "no-cache")
+
+		if err := r.ParseForm(); err != nil {
+			writeTokenError(w, http.StatusBadRequest, "invalid_request", "invalid form body")
+			return
+		}
+
+		if r.PostForm.Get("grant_type") != "authorization_code" {
+			writeTokenError(w, http.StatusBadRequest, "unsupported_grant_type", "")
+			return
+		}
+
+		clientID, secret, hasBasic := r.BasicAuth()
+		if !hasBasic {
+			clientID = r.PostForm.Get("client_id")
+			secret = r.PostForm.Get("client_secret")
+		}
+
+		client, err := issuer.GetOAuthClient(r.Context(), clientID)
+		if errors.Is(err, storage.ErrClientNotFound) {
+			writeTokenError(w, http.StatusUnauthorized, "invalid_client", "")
+			return
+		}
+		if err != nil {
+			log.Error("failed to get client", sl.Err(err))
+			writeTokenError(w, http.StatusInternalServerError, "server_error", "")
+			return
+		}
+
+		if client.Confidential {
+			ok, err := issuer.CheckOAuthClientSecret(r.Context(), clientID, secret)
+			if err != nil {
+				log.Error("failed to check client secret", sl.Err(err))
+				writeTokenError(w, http.StatusInternalServerError, "server_error", "")
+				return
+			}
+			if !ok {
+				log.Warn("invalid client secret", slog.String("client_id", clientID))
+				writeTokenError(w, http.StatusUnauthorized, "invalid_client", "")
+				return
+			}
+		}
+
+		authCode, err := issuer.UseAuthorizationCode(r.Context(), r.PostForm.Get("code"))
+		if errors.Is(err, storage.ErrInvalidAuthorizationCode) {
+			writeTokenError(w, http.StatusBadRequest, "invalid_grant", "invalid or expired code")
+			return
+		}
+		if err != nil {
+			log.Error("failed to redeem code", sl.Err(err))
+			writeTokenError(w, http.StatusInternalServerError, "server_error", "")
+			return
+		}
+
+		if authCode.ClientID != clientID || authCode.RedirectURI != r.PostForm.Get("redirect_uri") {
+			writeTokenError(w, http.StatusBadRequest, "invalid_grant", "code was issued to another client or redirect URI")
+			return
+		}
+
+		if !oidc.VerifyPKCE(r.PostForm.Get("code_verifier"), authCode.CodeChallenge) {
+			writeTokenError(w, http.StatusBadRequest, "invalid_grant", "code_verifier does not match")
+			return
+		}
+
+		user, err := issuer.GetUserByID(r.Context(), authCode.UserID)
+		if errors.Is(err, storage.ErrUserNotFound) {
+			writeTokenError(w, http.StatusBadRequest, "invalid_grant", "user no longer exists")
+			return
+		}
+		if err != nil {
+			log.Error("failed to get user", sl.Err(err))
+			writeTokenError(w, http.StatusInternalServerError, "server_error", "")
+			return
+		}
+
+		sub := strconv.FormatInt(authCode.UserID, 10)
+
+		accessToken, err := signer.Sign(jwt.MapClaims{
+			"typ":       tokenTypeAccess,
+			"sub":       sub,
+			"aud":       clientID,
+			"client_id": clientID,
+			"scope":     authCode.Scope,
+		}, accessTokenTTL)
+		if err != nil {
+			log.Error("failed to sign access token", sl.Err(err))
+			writeTokenError(w, http.StatusInternalServerError, "server_error", "")
+			return
+		}
+
+		idClaims := jwt.MapClaims{
+			"aud":       clientID,
+			"auth_time": time.Now().Unix(),
+		}
+		for k, v := range userClaims(sub, user, authCode.Scope) {
+			idClaims[k] = v
+		}
+		if authCode.Nonce != "" {
+			idClaims["nonce"] = authCode.Nonce
+		}
+
+		idToken, err := signer.Sign(idClaims, idTokenTTL)
+		if err != nil {
+			log.Error("failed to sign id token", sl.Err(err))
+			writeTokenError(w, http.StatusInternalServerError, "server_error", "")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(TokenResponse{
+			AccessToken: accessToken,
+			TokenType:   "Bearer",
+			ExpiresIn:   int64(accessTokenTTL.Seconds()),
+			IDToken:     idToken,
+			Scope:       authCode.Scope,
+		})
+
+		log.Info("tokens issued", slog.String("client_id", clientID), slog.Int64("user_id", authCode.UserID))
+	}
+}
+
+func writeTokenError(w http.ResponseWriter, status int, code string, description string) {
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(tokenError{Error: code, ErrorDescription: description})
+}
@@ -0,0 +1,299 @@
+package password_handler
+
+import (
+	"chat_go/internal/lib/api/response"
+	"chat_go/internal/lib/events"
+	"chat_go/internal/lib/jwts"
+	"chat_go/internal/lib/logger/sl"
+	"chat_go/internal/lib/notify"
+	"chat_go/internal/storage"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+)
+
+type ChangeRequest struct {
+	OldPassword string `json:"OldPassword" validate:"required"`
+	NewPassword string `json:"NewPassword" validate:"required"`
+}
+
+type ResetRequest struct {
+	Username string `json:"Username" validate:"required"`
+}
+
+type ResetConfirmRequest struct {
+	Token       string `json:"Token" validate:"required"`
+	NewPassword string `json:"NewPassword" validate:"required"`
+}
+
+type PasswordValidator interface {
+	Validate(username, password string) error
+}
+
+type PasswordChanger interface {
+	ChangePassword(ctx context.Context, userID int64, oldPassword string, newPassword string) (int64, error)
+	GetUsernameByID(ctx context.Context, id int64) (string, error)
+}
+
+type ResetTokenSaver interface {
+	SavePasswordResetToken(ctx context.Context, username string, token string, expiresAt time.Time) (string, error)
+}
+
+type EventPublisher interface {
+	Publish(ctx context.Context, e events.Event)
+}
+
+type PasswordResetter interface {
+	ResetPassword(ctx context.Context, token string, newPassword string) error
+	GetUsernameByResetToken(ctx context.Context, token string) (string, error)
+}
+
+// NewChangeHandler changes the password of the logged in user. All other
+// sessions are revoked, and the caller gets a fresh token.
+func NewChangeHandler(log *slog.Logger, changer PasswordChanger, policy PasswordValidator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.user.password.Change"
+
+		log := log.With(slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		userID, ok := r.Context().Value("userid").(int64)
+		if !ok {
+			response.Error(w, r, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		var req ChangeRequest
+
+		err := render.DecodeJSON(r.Body, &req)
+		if err != nil {
+			log.Error("failed to decode request body", sl.Err(err))
+			response.Error(w, r, http.StatusBadRequest, "Failed to decode request body")
+			return
+		}
+
+		if err := validator.New().Struct(req); err != nil {
+			validateErr := err.(validator.ValidationErrors)
+			log.Error("invalid request", sl.Err(err))
+			response.ValidationError(w, r, validateErr)
+			return
+		}
+
+		username, err := changer.GetUsernameByID(r.Context(), userID)
+		if err != nil {
+			log.Error("failed to get user", sl.Err(err))
+			response.FromError(w, r, err, "Failed to change password")
+			return
+		}
+
+		if err := policy.Validate(username, req.NewPassword); err != nil {
+			response.Error(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		sessionVersion, err := changer.ChangePassword(r.Context(), userID, req.OldPassword, req.NewPassword)
+		if errors.Is(err, storage.ErrInvalidLoginOrPassword) {
+			log.Warn("wrong old password", slog.Int64("user_id", userID))
+			response.Error(w, r, http.StatusForbidden, "Invalid old password")
+			return
+		}
+		if err != nil {
+			log.Error("failed to change password", sl.Err(err))
+			response.FromError(w, r, err, "Failed to change password")
+			return
+		}
+
+		claims, _ := r.Context().Value("claims").(jwts.Claims)
+		claims.SessionVersion = sessionVersion
+
+		token, err := jwts.GenerateJWTToken(claims)
+		if err != nil {
+			log.Error("failed to generate token", sl.Err(err))
+			response.FromError(w, r, err, "Password changed, please login again")
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     "auth_token",
+			Value:    token,
+			Path:     "/",
+			SameSite: http.SameSiteNoneMode,
+			Secure:   true,
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"token": token})
+
+		log.Info("password changed", slog.Int64("user_id", userID))
+	}
+}
+
+// NewResetRequestHandler hands the request to the events, which issue and send
+// the reset token. It answers at once and the same way whether the user exists
+// or not, so neither the answer nor its timing tells which accounts exist.
+func NewResetRequestHandler(log *slog.Logger, publisher EventPublisher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.user.password.ResetRequest"
+
+		log := log.With(slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		var req ResetRequest
+
+		err := render.DecodeJSON(r.Body, &req)
+		if err != nil {
+			log.Error("failed to decode request body", sl.Err(err))
+			response.Error(w, r, http.StatusBadRequest, "Failed to decode request body")
+			return
+		}
+
+		if err := validator.New().Struct(req); err != nil {
+			validateErr := err.(validator.ValidationErrors)
+			log.Error("invalid request", sl.Err(err))
+			response.ValidationError(w, r, validateErr)
+			return
+		}
+
+		publisher.Publish(r.Context(), events.PasswordResetRequested{Username: req.Username})
+
+		log.Info("password reset requested", slog.String("user", req.Username))
+
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode("If the account exists, a reset token has been sent")
+	}
+}
+
+// NewSendResetTokenHandler issues a reset token for every
+// events.PasswordResetRequested of an existing user and sends it with notifier.
+func NewSendResetTokenHandler(log *slog.Logger, saver ResetTokenSaver, notifier notify.Notifier, tokenTTL time.Duration) events.Handler {
+	return func(ctx context.Context, e events.Event) {
+		const op = "handlers.user.password.SendResetToken"
+
+		req, ok := e.(events.PasswordResetRequested)
+		if !ok {
+			return
+		}
+
+		log := log.With(slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(ctx)),
+			sl.TraceID(ctx),
+			slog.String("user", req.Username),
+		)
+
+		token, err := generateResetToken()
+		if err != nil {
+			log.Error("failed to generate reset token", sl.Err(err))
+			return
+		}
+
+		email, err := saver.SavePasswordResetToken(ctx, req.Username, token, time.Now().Add(tokenTTL))
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Info("password reset for unknown user")
+			return
+		}
+		if err != nil {
+			log.Error("failed to save reset token", sl.Err(err))
+			return
+		}
+
+		err = notifier.Notify(ctx, notify.Message{
+			To:       email,
+			Username: req.Username,
+			Subject:  "Password reset",
+			Body: fmt.Sprintf(
+				"Someone asked to reset the password of %s.\n\nYour reset token: %s\n\nIt can be used once and expires in %s. If it wasn't you, just ignore this message.",
+				req.Username, token, tokenTTL,
+			),
+		})
+		if err != nil {
+			log.Error("failed to deliver reset token", sl.Err(err))
+			return
+		}
+
+		log.Info("reset token sent")
+	}
+}
+
+// NewResetConfirmHandler sets a new password using a reset token.
+func NewResetConfirmHandler(log *slog.Logger, resetter PasswordResetter, policy PasswordValidator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.user.password.ResetConfirm"
+
+		log := log.With(slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		var req ResetConfirmRequest
+
+		err := render.DecodeJSON(r.Body, &req)
+		if err != nil {
+			log.Error("failed to decode request body", sl.Err(err))
+			response.Error(w, r, http.StatusBadRequest, "Failed to decode request body")
+			return
+		}
+
+		if err := validator.New().Struct(req); err != nil {
+			validateErr := err.(validator.ValidationErrors)
+			log.Error("invalid request", sl.Err(err))
+			response.ValidationError(w, r, validateErr)
+			return
+		}
+
+		username, err := resetter.GetUsernameByResetToken(r.Context(), req.Token)
+		if errors.Is(err, storage.ErrInvalidResetToken) {
+			log.Warn("invalid reset token")
+			response.ErrorFor(w, r, err, "Invalid or expired reset token")
+			return
+		}
+		if err != nil {
+			log.Error("failed to check reset token", sl.Err(err))
+			response.FromError(w, r, err, "Failed to reset password")
+			return
+		}
+
+		if err := policy.Validate(username, req.NewPassword); err != nil {
+			response.Error(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		err = resetter.ResetPassword(r.Context(), req.Token, req.NewPassword)
+		if errors.Is(err, storage.ErrInvalidResetToken) {
+			log.Warn("invalid reset token")
+			response.ErrorFor(w, r, err, "Invalid or expired reset token")
+			return
+		}
+		if err != nil {
+			log.Error("failed to reset password", sl.Err(err))
+			response.FromError(w, r, err, "Failed to reset password")
+			return
+		}
+
+		json.NewEncoder(w).Encode("Your password has been reset, please login again")
+
+		log.Info("password reset")
+	}
+}
+
+func generateResetToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,68 @@
+package profile_handler
+
+import (
+	"chat_go/internal/lib/api/response"
+	"chat_go/internal/lib/logger/sl"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+)
+
+type ExistUsersRequest struct {
+	Usernames []string `json:"Usernames" validate:"max=200,dive,required"`
+}
+
+type ExistUsersResponse struct {
+	Missing []string `json:"missing"`
+}
+
+type UserChecker interface {
+	MissingUsers(ctx context.Context, usernames []string) ([]string, error)
+}
+
+// NewExistUsersHandler tells the other services which of the usernames have no
+// account, so that a whole list is checked in one request.
+func NewExistUsersHandler(log *slog.Logger, checker UserChecker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.user.profile.ExistUsers"
+
+		log := log.With(slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		var req ExistUsersRequest
+
+		err := render.DecodeJSON(r.Body, &req)
+		if err != nil {
+			log.Error("failed to decode request body", sl.Err(err))
+			response.Error(w, r, http.StatusBadRequest, "Failed to decode request body")
+			return
+		}
+
+		if err := validator.New().Struct(req); err != nil {
+			validateErr := err.(validator.ValidationErrors)
+			log.Error("invalid request", sl.Err(err))
+			response.ValidationError(w, r, validateErr)
+			return
+		}
+
+		missing, err := checker.MissingUsers(r.Context(), req.Usernames)
+		if err != nil {
+			log.Error("failed to check users", sl.Err(err))
+			response.FromError(w, r, err, "Failed to check users")
+			return
+		}
+		if missing == nil {
+			missing = []string{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ExistUsersResponse{Missing: missing})
+	}
+}
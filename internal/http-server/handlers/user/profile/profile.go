@@ -2,8 +2,12 @@ package profile_handler
 
 import (
 	"chat_go/internal/lib/api/models"
+	"chat_go/internal/lib/api/response"
 	"chat_go/internal/lib/logger/sl"
+	"chat_go/internal/storage"
+	"context"
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
 	"strings"
@@ -15,32 +19,37 @@ type Response struct {
 }
 
 type UserGetter interface {
-	GetUser(username string) (models.User, error)
+	GetUser(ctx context.Context, username string) (models.User, error)
 }
 
 func NewGetUserHandler(log *slog.Logger, userGetter UserGetter) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		pathValues := strings.Split(r.URL.Path, "/")
 		if len(pathValues) < 3 || pathValues[2] == "" {
-			http.Error(w, "Invalid URL format", http.StatusBadRequest)
+			response.Error(w, r, http.StatusBadRequest, "Invalid URL format")
 			return
 		}
 		username := pathValues[2]
 		firstLetter := []rune(username)[0]
 		letter := string(firstLetter)
 		if letter != "@" {
-			http.Error(w, "Username must start with @", http.StatusBadRequest)
+			response.Error(w, r, http.StatusBadRequest, "Username must start with @")
+			return
 		}
 
-		user, err := userGetter.GetUser(username)
+		user, err := userGetter.GetUser(r.Context(), username)
+		if errors.Is(err, storage.ErrUserNotFound) {
+			response.ErrorFor(w, r, err, "User not found")
+			return
+		}
 		if err != nil {
-			http.Error(w, "Invalid username", http.StatusBadRequest)
-			log.Error("invalid username", sl.Err(err))
+			log.Error("failed to get user", sl.Err(err))
+			response.FromError(w, r, err, "Failed to get user")
 			return
 		}
 
-		response := map[string]interface{}{"user": user}
-		json.NewEncoder(w).Encode(response)
+		resp := map[string]interface{}{"user": user}
+		json.NewEncoder(w).Encode(resp)
 
 		log.Info("success GetUser")
 	}
@@ -1,9 +1,11 @@
 package save_handler
 
 import (
-	val "chat_go/internal/lib/api/validation"
+	"chat_go/internal/lib/api/response"
 	"chat_go/internal/lib/logger/sl"
+	"chat_go/internal/lib/metrics"
 	"chat_go/internal/storage"
+	"context"
 	"encoding/json"
 	"errors"
 	"log/slog"
@@ -19,22 +21,29 @@ type Request struct {
 	Nickname string `json:"Nickname" validate:"required"`
 	Username string `json:"Username" validate:"required"`
 	Bio      string `json:"Bio" validate:"required"`
+	Email    string `json:"Email,omitempty" validate:"omitempty,email"`
+}
+
+type PasswordValidator interface {
+	Validate(username, password string) error
 }
 
 type UserSaver interface {
-	SaveUser(bio string, password string, nickname string, username string) (int64, error)
+	SaveUser(ctx context.Context, bio string, password string, nickname string, username string, email string) (int64, error)
 }
 
-func NewSaveHandler(log *slog.Logger, userSaver UserSaver) http.HandlerFunc {
+func NewSaveHandler(log *slog.Logger, userSaver UserSaver, policy PasswordValidator) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handlers.user.save.New"
 
 		if r.Method != http.MethodPost {
-			http.Error(w, "Wrong method", http.StatusMethodNotAllowed)
+			response.Error(w, r, http.StatusMethodNotAllowed, "Wrong method")
+			return
 		}
 
-		log = log.With(slog.String("op", op),
+		log := log.With(slog.String("op", op),
 			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
 		)
 
 		var req Request
@@ -42,16 +51,16 @@ func NewSaveHandler(log *slog.Logger, userSaver UserSaver) http.HandlerFunc {
 		err := render.DecodeJSON(r.Body, &req)
 		if err != nil {
 			log.Error("failed to decode request body", sl.Err(err))
-			http.Error(w, "Failed to decode request body", http.StatusInternalServerError)
+			response.Error(w, r, http.StatusBadRequest, "Failed to decode request body")
 			return
 		}
 
-		log.Info("request bosy decoded", slog.Any("request", req))
+		log.Info("request bosy decoded", slog.String("username", req.Username))
 
 		if err := validator.New().Struct(req); err != nil {
 			validateErr := err.(validator.ValidationErrors)
 			log.Error("invalid request", sl.Err(err))
-			http.Error(w, val.ValidationError(validateErr), http.StatusBadRequest)
+			response.ValidationError(w, r, validateErr)
 			return
 		}
 
@@ -60,24 +69,31 @@ func NewSaveHandler(log *slog.Logger, userSaver UserSaver) http.HandlerFunc {
 		letter := string(firstLetter)
 
 		if letter != "@" {
-			http.Error(w, "Username must start with @", http.StatusBadRequest)
+			response.Error(w, r, http.StatusBadRequest, "Username must start with @")
+			return
+		}
+
+		if err := policy.Validate(username, req.Password); err != nil {
+			log.Info("password rejected by policy", sl.Err(err))
+			response.Error(w, r, http.StatusBadRequest, err.Error())
 			return
 		}
 
-		id, err := userSaver.SaveUser(req.Bio, req.Password, req.Nickname, username)
+		id, err := userSaver.SaveUser(r.Context(), req.Bio, req.Password, req.Nickname, username, req.Email)
 		if errors.Is(err, storage.ErrUserAlreadyExists) {
 			log.Info("user already exists", slog.String("user", req.Nickname))
-			http.Error(w, "User already exists", http.StatusBadRequest)
+			response.ErrorFor(w, r, err, "User already exists")
 			return
 		}
 		if err != nil {
 			log.Error("failed to add user", sl.Err(err))
-			http.Error(w, "Failed to add user", http.StatusInternalServerError)
+			response.FromError(w, r, err, "Failed to add user")
 			return
 		}
 
+		metrics.UserRegistered()
 		log.Info("user added", slog.Int64("id", id))
-		json.NewEncoder(w).Encode("You have successfully created a profile!")
 		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode("You have successfully created a profile!")
 	}
 }
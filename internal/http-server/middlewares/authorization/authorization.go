@@ -1,40 +1,107 @@
 package authorization_middleware
 
 import (
+	"chat_go/internal/lib/api/response"
 	"chat_go/internal/lib/jwts"
+	"chat_go/internal/lib/rbac"
 	"context"
+	"crypto/subtle"
 	"log"
 	"net/http"
-	"strconv"
+	"strings"
 )
 
+type SessionVersionGetter interface {
+	GetSessionVersion(ctx context.Context, userID int64) (int64, error)
+}
+
 func AuthorizeJWTToken(next http.Handler) http.Handler {
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		cookie, err := r.Cookie("auth_token")
 		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			response.Error(w, r, http.StatusUnauthorized, "Unauthorized")
 			log.Printf("no cookie found")
 			return
 		}
-						
+
 		tokenString := cookie.Value
-						
-		tokenValue, err := jwts.VerifyJWTToken(tokenString)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusForbidden)
-			log.Printf("error: %v", err)
-			return
-		}
-						
-		userID, err := strconv.ParseInt(tokenValue, 10, 64)
+
+		claims, err := jwts.VerifyJWTToken(tokenString)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			response.Error(w, r, http.StatusUnauthorized, "Invalid token")
 			log.Printf("error: %v", err)
 			return
 		}
-			
-		ctx := context.WithValue(r.Context(), "userid", userID)
+
+		ctx := context.WithValue(r.Context(), "userid", claims.UserID)
+		ctx = context.WithValue(ctx, "claims", claims)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
-}
\ No newline at end of file
+}
+
+// RequireValidSession rejects tokens issued before the user's sessions were
+// revoked. It must run after AuthorizeJWTToken.
+func RequireValidSession(sessions SessionVersionGetter) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value("claims").(jwts.Claims)
+			if !ok {
+				response.Error(w, r, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+
+			version, err := sessions.GetSessionVersion(r.Context(), claims.UserID)
+			if err != nil {
+				response.Error(w, r, http.StatusUnauthorized, "Unauthorized")
+				log.Printf("error: %v", err)
+				return
+			}
+
+			if version != claims.SessionVersion {
+				response.Error(w, r, http.StatusUnauthorized, "Session has been revoked")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequirePermission lets a request through only when the role in its token
+// grants perm. It must run after AuthorizeJWTToken and RequireValidSession.
+func RequirePermission(perm rbac.Permission) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value("claims").(jwts.Claims)
+			if !ok {
+				response.Error(w, r, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+
+			if !rbac.Role(claims.Role).Can(perm) {
+				response.Error(w, r, http.StatusForbidden, "Forbidden")
+				log.Printf("user %d with role %q lacks permission %s", claims.UserID, claims.Role, perm)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireServiceToken guards the endpoints that only the other services call.
+// They send token as a bearer token. An empty token turns the endpoints off.
+func RequireServiceToken(token string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if token == "" || !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				response.Error(w, r, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
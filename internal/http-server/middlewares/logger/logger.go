@@ -1,16 +1,21 @@
 package mwLogger
 
 import (
+	"chat_go/internal/lib/logger/sl"
+	"chat_go/internal/lib/metrics"
 	"log/slog"
 	"net/http"
 	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func New(log *slog.Logger) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
-		log = log.With(
+		log := log.With(
 			slog.String("component", "middleware/logger"),
 		)
 
@@ -21,15 +26,27 @@ func New(log *slog.Logger) func(next http.Handler) http.Handler {
 				slog.String("remote_addr", r.RemoteAddr),
 				slog.String("user_agent", r.UserAgent()),
 				slog.String("request_id", middleware.GetReqID(r.Context())),
+				sl.TraceID(r.Context()),
 			)
 			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
 
 			t1 := time.Now()
 			defer func() {
+				duration := time.Since(t1)
+				route := routePattern(r)
+				metrics.ObserveRequest(r.Method, route, ww.Status(), duration)
+
+				// The route is only known now, after the span was started.
+				if route != "" {
+					span := trace.SpanFromContext(r.Context())
+					span.SetName(r.Method + " " + route)
+					span.SetAttributes(attribute.String("http.route", route))
+				}
+
 				entry.Info("request completed",
 			    slog.Int("status", ww.Status()),
 			    slog.Int("bytes", ww.BytesWritten()),
-		        slog.String("duration", time.Since(t1).String()),
+		        slog.String("duration", duration.String()),
 	            )
 			}()
 
@@ -38,4 +55,15 @@ func New(log *slog.Logger) func(next http.Handler) http.Handler {
 
 		return http.HandlerFunc(fn)
 	}
-}
\ No newline at end of file
+}
+
+// routePattern is the chi pattern the request matched, known once it has been
+// routed.
+func routePattern(r *http.Request) string {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil {
+		return ""
+	}
+
+	return rctx.RoutePattern()
+}
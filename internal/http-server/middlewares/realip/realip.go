@@ -0,0 +1,66 @@
+package realip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// New returns a middleware that puts the client's address in r.RemoteAddr when
+// the request came through one of the trusted proxies, such as the gateway.
+// The address is the rightmost untrusted one in X-Forwarded-For, so clients
+// can't pick their own by sending the header themselves. Requests from other
+// peers are left alone.
+func New(trusted []string) (func(next http.Handler) http.Handler, error) {
+	const op = "middlewares.realip.New"
+
+	prefixes := make([]netip.Prefix, 0, len(trusted))
+	for _, s := range trusted {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+
+	isTrusted := func(s string) bool {
+		addr, err := netip.ParseAddr(strings.TrimSpace(s))
+		if err != nil {
+			return false
+		}
+		for _, prefix := range prefixes {
+			if prefix.Contains(addr.Unmap()) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			peer, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil || !isTrusted(peer) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+			for i := len(hops) - 1; i >= 0; i-- {
+				hop := strings.TrimSpace(hops[i])
+				if hop == "" || isTrusted(hop) {
+					continue
+				}
+				if _, err := netip.ParseAddr(hop); err != nil {
+					break
+				}
+
+				r.RemoteAddr = net.JoinHostPort(hop, "0")
+				break
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}, nil
+}
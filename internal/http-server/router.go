@@ -0,0 +1,60 @@
+package http_server
+
+import (
+	"chat_go/internal/http-server/handlers/health"
+	mwLogger "chat_go/internal/http-server/middlewares/logger"
+	"chat_go/internal/http-server/middlewares/realip"
+	"chat_go/internal/lib/api/response"
+	"chat_go/internal/lib/metrics"
+	"chat_go/internal/lib/tracing"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// NewRouter returns a router with the middlewares every service uses. The
+// services mount their routes on it.
+func NewRouter(log *slog.Logger, trustedProxies []string) (*chi.Mux, error) {
+	const op = "http-server.NewRouter"
+
+	realIP, err := realip.New(trustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	router := chi.NewRouter()
+
+	router.Use(middleware.RequestID)
+	router.Use(realIP)
+	router.Use(tracing.Middleware())
+	router.Use(middleware.Logger)
+	router.Use(mwLogger.New(log))
+	router.Use(middleware.Recoverer)
+	router.Use(middleware.URLFormat)
+
+	router.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		response.Error(w, r, http.StatusNotFound, "Route not found")
+	})
+	router.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		response.Error(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	})
+
+	return router, nil
+}
+
+// HealthRoutes mounts /healthz, /readyz and /version. They need no login, so
+// probes and load balancers can call them.
+func HealthRoutes(router chi.Router, log *slog.Logger, ready func() bool, checks ...health.Check) {
+	router.Get("/healthz", health.NewLivenessHandler())
+	router.Get("/readyz", health.NewReadinessHandler(log, ready, checks...))
+	router.Get("/version", health.NewVersionHandler())
+}
+
+// MetricsRoute mounts /metrics for Prometheus. The gateway doesn't route it,
+// so it is only reachable on the server's own address.
+func MetricsRoute(router chi.Router) {
+	router.Handle("/metrics", metrics.Handler())
+}
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type User struct {
 	Bio string
 	Nickname string
@@ -10,10 +12,142 @@ type Message struct {
 	ID int64
 	Sender string
 	Text string
+	Kind string
 }
 
+const (
+	MessageKindUser   = "user"
+	MessageKindSystem = "system"
+)
+
 type Chat struct {
 	Name string
 	Participants string
 	Messages []Message
-}
\ No newline at end of file
+}
+const (
+	ChatKindDirect  = "direct"
+	ChatKindGroup   = "group"
+	ChatKindChannel = "channel"
+)
+
+type ChatInfo struct {
+	ID          int64
+	Name        string
+	Kind        string
+	Public      bool
+	Description string
+	Topic       string
+	Avatar      string
+	CreatedBy   string
+	CreatedAt   *time.Time
+	MemberCount int
+}
+
+// Channel is a public channel as shown in search results.
+type Channel struct {
+	ID          int64
+	Name        string
+	Description string
+	Topic       string
+	Avatar      string
+	Subscribers int
+}
+
+// ChatUpdate holds the chat fields to change. Nil fields are left alone.
+type ChatUpdate struct {
+	Name        *string
+	Description *string
+	Topic       *string
+	Avatar      *string
+}
+
+// Pin is a pinned message.
+type Pin struct {
+	MessageID int64
+	Sender    string
+	Text      string
+	PinnedBy  string
+	PinnedAt  time.Time
+}
+
+// Attachment is a file sent with a message. Its contents are kept in a blob
+// store under Key.
+type Attachment struct {
+	ID          int64
+	MessageID   int64
+	ChatID      int64
+	Key         string
+	Filename    string
+	ContentType string
+	Size        int64
+	// Width and Height are only set for images.
+	Width      int
+	Height     int
+	Thumbnails []Thumbnail
+	CreatedAt  time.Time
+}
+
+// Thumbnail is a scaled down copy of an image attachment that fits in a
+// Size x Size square.
+type Thumbnail struct {
+	Size        int
+	Width       int
+	Height      int
+	Key         string
+	ContentType string
+}
+
+// Mention is a message that mentions the user.
+type Mention struct {
+	MessageID int64
+	ChatID    int64
+	ChatName  string
+	Sender    string
+	Text      string
+	CreatedAt time.Time
+}
+
+type ChatMember struct {
+	Username string
+	Role     string
+}
+
+// ChatInvite describes an invite link. The token itself is only known to
+// whoever created it.
+type ChatInvite struct {
+	ID        int64
+	ChatID    int64
+	CreatedBy string
+	ExpiresAt *time.Time
+	MaxUses   int
+	Uses      int
+	Revoked   bool
+	CreatedAt time.Time
+}
+
+// Account is a user as seen by an administrator.
+type Account struct {
+	ID        int64
+	Username  string
+	Nickname  string
+	Role      string
+	Suspended bool
+}
+
+type OAuthClient struct {
+	ClientID     string
+	Name         string
+	RedirectURIs []string
+	Confidential bool
+}
+
+type AuthorizationCode struct {
+	ClientID      string
+	UserID        int64
+	RedirectURI   string
+	Scope         string
+	Nonce         string
+	CodeChallenge string
+	ExpiresAt     time.Time
+}
@@ -0,0 +1,39 @@
+// Package page reads the paging parameters of the list endpoints.
+package page
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 200
+)
+
+// FromQuery returns the limit and offset query parameters of r. A missing
+// limit is DefaultLimit and a missing offset is 0. The error is meant for the
+// client.
+func FromQuery(r *http.Request) (limit int, offset int, err error) {
+	limit, err = queryInt(r, "limit", DefaultLimit)
+	if err != nil || limit < 1 || limit > MaxLimit {
+		return 0, 0, fmt.Errorf("Invalid limit, it must be between 1 and %d", MaxLimit)
+	}
+
+	offset, err = queryInt(r, "offset", 0)
+	if err != nil || offset < 0 {
+		return 0, 0, fmt.Errorf("Invalid offset, it must be 0 or more")
+	}
+
+	return limit, offset, nil
+}
+
+func queryInt(r *http.Request, key string, def int) (int, error) {
+	s := r.URL.Query().Get(key)
+	if s == "" {
+		return def, nil
+	}
+
+	return strconv.Atoi(s)
+}
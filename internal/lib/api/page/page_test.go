@@ -0,0 +1,34 @@
+package page
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFromQuery(t *testing.T) {
+	tests := []struct {
+		query         string
+		limit, offset int
+		wantErr       bool
+	}{
+		{"", DefaultLimit, 0, false},
+		{"?limit=10&offset=20", 10, 20, false},
+		{"?limit=200", 200, 0, false},
+		{"?limit=0", 0, 0, true},
+		{"?limit=201", 0, 0, true},
+		{"?limit=ten", 0, 0, true},
+		{"?offset=-1", 0, 0, true},
+		{"?offset=x", 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			limit, offset, err := FromQuery(httptest.NewRequest("GET", "/list"+tt.query, nil))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if limit != tt.limit || offset != tt.offset {
+				t.Fatalf("got limit %d offset %d, want %d %d", limit, offset, tt.limit, tt.offset)
+			}
+		})
+	}
+}
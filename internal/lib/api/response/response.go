@@ -0,0 +1,127 @@
+package response
+
+import (
+	val "chat_go/internal/lib/api/validation"
+	"chat_go/internal/storage"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+)
+
+// CodeValidation is the code of a request body that failed validation, its
+// details list the fields.
+const CodeValidation = "validation_failed"
+
+// ErrorResponse is the body of every error answer:
+//
+//	{"error": {"code": "not_found", "message": "Chat not found", "request_id": "..."}}
+type ErrorResponse struct {
+	Error ErrorBody `json:"error"`
+}
+
+type ErrorBody struct {
+	// Code is for programs, it doesn't change when Message is reworded.
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Details says more about some errors, like the invalid fields.
+	Details   any    `json:"details,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// answer is the status and code of a storage error.
+type answer struct {
+	status int
+	code   string
+}
+
+// statuses are the answers to the storage errors. Each error has its own code,
+// so programs can tell apart errors with the same status.
+var statuses = map[error]answer{
+	storage.ErrUserNotFound:             {http.StatusNotFound, "user_not_found"},
+	storage.ErrInvalidLoginOrPassword:   {http.StatusUnauthorized, "invalid_credentials"},
+	storage.ErrUserAlreadyExists:        {http.StatusConflict, "user_exists"},
+	storage.ErrMessageNotFound:          {http.StatusNotFound, "message_not_found"},
+	storage.ErrChatNotFound:             {http.StatusNotFound, "chat_not_found"},
+	storage.ErrChatAlreadyExists:        {http.StatusConflict, "chat_exists"},
+	storage.ErrMFANotEnrolled:           {http.StatusBadRequest, "mfa_not_enrolled"},
+	storage.ErrMFAAlreadyEnabled:        {http.StatusConflict, "mfa_already_enabled"},
+	storage.ErrInvalidRecoveryCode:      {http.StatusUnauthorized, "invalid_recovery_code"},
+	storage.ErrTOTPCodeUsed:             {http.StatusUnauthorized, "totp_code_used"},
+	storage.ErrInvalidResetToken:        {http.StatusBadRequest, "invalid_reset_token"},
+	storage.ErrClientNotFound:           {http.StatusBadRequest, "unknown_client"},
+	storage.ErrInvalidAuthorizationCode: {http.StatusBadRequest, "invalid_authorization_code"},
+	storage.ErrUserSuspended:            {http.StatusForbidden, "user_suspended"},
+	storage.ErrNotChatMember:            {http.StatusForbidden, "not_chat_member"},
+	storage.ErrInviteNotFound:           {http.StatusNotFound, "invite_not_found"},
+	storage.ErrInvalidInvite:            {http.StatusNotFound, "invalid_invite"},
+	storage.ErrDirectChat:               {http.StatusBadRequest, "direct_chat"},
+	storage.ErrTooManyPins:              {http.StatusConflict, "too_many_pins"},
+	storage.ErrPinNotFound:              {http.StatusNotFound, "pin_not_found"},
+	storage.ErrAttachmentNotFound:       {http.StatusNotFound, "attachment_not_found"},
+}
+
+// Write answers status with body, filling in the request ID.
+func Write(w http.ResponseWriter, r *http.Request, status int, body ErrorBody) {
+	body.RequestID = middleware.GetReqID(r.Context())
+
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	render.Status(r, status)
+	render.JSON(w, r, ErrorResponse{Error: body})
+}
+
+// Error answers status with message. The code is the status text, like
+// "not_found" for 404 Not Found.
+func Error(w http.ResponseWriter, r *http.Request, status int, message string) {
+	Write(w, r, status, ErrorBody{Code: Code(status), Message: message})
+}
+
+// FromError answers err. A storage error gets its status and code, with message
+// and the error; anything else is a 500 Internal Server Error with only
+// message, so the internals of the server don't leak.
+func FromError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	for target, a := range statuses {
+		if errors.Is(err, target) {
+			Write(w, r, a.status, ErrorBody{Code: a.code, Message: message + ": " + target.Error()})
+			return
+		}
+	}
+
+	Error(w, r, http.StatusInternalServerError, message)
+}
+
+// ErrorFor answers the storage error err with its status and code, like
+// FromError, but with only message. Handlers use it for the errors they
+// expect, to word the message themselves.
+func ErrorFor(w http.ResponseWriter, r *http.Request, err error, message string) {
+	for target, a := range statuses {
+		if errors.Is(err, target) {
+			Write(w, r, a.status, ErrorBody{Code: a.code, Message: message})
+			return
+		}
+	}
+
+	Error(w, r, http.StatusInternalServerError, message)
+}
+
+// ValidationError answers 400 Bad Request with one detail per invalid field.
+func ValidationError(w http.ResponseWriter, r *http.Request, errs validator.ValidationErrors) {
+	Write(w, r, http.StatusBadRequest, ErrorBody{
+		Code:    CodeValidation,
+		Message: val.ValidationError(errs),
+		Details: val.FieldErrors(errs),
+	})
+}
+
+// Code returns the code of status: its text in snake case.
+func Code(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return "error"
+	}
+
+	return strings.ReplaceAll(strings.ToLower(text), " ", "_")
+}
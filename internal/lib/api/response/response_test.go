@@ -0,0 +1,64 @@
+package response
+
+import (
+	"chat_go/internal/storage"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func decode(t *testing.T, rec *httptest.ResponseRecorder) ErrorBody {
+	t.Helper()
+
+	var resp ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Error
+}
+
+func TestFromError(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{fmt.Errorf("storage.sqlite.GetChat: %w", storage.ErrChatNotFound), http.StatusNotFound, "chat_not_found"},
+		{storage.ErrInvalidInvite, http.StatusNotFound, "invalid_invite"},
+		{storage.ErrTOTPCodeUsed, http.StatusUnauthorized, "totp_code_used"},
+		{errors.New("disk I/O error"), http.StatusInternalServerError, "internal_server_error"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		FromError(rec, httptest.NewRequest(http.MethodGet, "/", nil), tt.err, "Failed")
+
+		body := decode(t, rec)
+		if rec.Code != tt.status || body.Code != tt.code {
+			t.Fatalf("%v: got %d %q, want %d %q", tt.err, rec.Code, body.Code, tt.status, tt.code)
+		}
+	}
+}
+
+func TestErrorFor(t *testing.T) {
+	rec := httptest.NewRecorder()
+	ErrorFor(rec, httptest.NewRequest(http.MethodGet, "/", nil), storage.ErrUserAlreadyExists, "User already exists")
+
+	body := decode(t, rec)
+	if rec.Code != http.StatusConflict || body.Code != "user_exists" || body.Message != "User already exists" {
+		t.Fatalf("got %d %+v", rec.Code, body)
+	}
+}
+
+// Every storage error has its own code.
+func TestCodesAreUnique(t *testing.T) {
+	seen := make(map[string]error)
+	for err, a := range statuses {
+		if other, ok := seen[a.code]; ok {
+			t.Fatalf("%q is the code of both %v and %v", a.code, err, other)
+		}
+		seen[a.code] = err
+	}
+}
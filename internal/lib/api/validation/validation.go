@@ -7,23 +7,47 @@ import (
 	"github.com/go-playground/validator/v10"
 )
 
+// FieldError is what is wrong with one field of a request.
+type FieldError struct {
+	Field string `json:"field"`
+	// Rule is the validation tag the field broke, like "required" or "max".
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
 func ValidationError(errs validator.ValidationErrors) string {
 	var errMsgs []string
 
+	for _, err := range FieldErrors(errs) {
+		errMsgs = append(errMsgs, err.Message)
+	}
+
+	errText := strings.Join(errMsgs, ", ")
+
+	return errText
+}
+
+// FieldErrors describes every invalid field.
+func FieldErrors(errs validator.ValidationErrors) []FieldError {
+	fields := make([]FieldError, 0, len(errs))
+
 	for _, err := range errs {
+		var msg string
 		switch err.ActualTag() {
 		case "required":
-			errMsgs = append(errMsgs, fmt.Sprintf("field %s is a required field", err.Field()))
+			msg = fmt.Sprintf("field %s is a required field", err.Field())
 		case "username":
-			errMsgs = append(errMsgs, fmt.Sprintf("field %s is not a valid username", err.Field()))
+			msg = fmt.Sprintf("field %s is not a valid username", err.Field())
+		case "email":
+			msg = fmt.Sprintf("field %s is not a valid email", err.Field())
 		case "password":
-			errMsgs = append(errMsgs, fmt.Sprintf("field %s is not a valid password", err.Field()))
+			msg = fmt.Sprintf("field %s is not a valid password", err.Field())
 		default:
-			errMsgs = append(errMsgs, fmt.Sprintf("field %s is not valid", err.Field()))
+			msg = fmt.Sprintf("field %s is not valid", err.Field())
 		}
-	}
 
-	errText := strings.Join(errMsgs, ", ")
+		fields = append(fields, FieldError{Field: err.Field(), Rule: err.ActualTag(), Message: msg})
+	}
 
-	return errText
+	return fields
 }
\ No newline at end of file
@@ -0,0 +1,42 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	KindLocal = "local"
+	KindS3    = "s3"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore keeps the contents of uploaded files. Keys are chosen by the
+// caller and only contain characters that are safe in paths and URLs.
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get returns the blob's contents, which the caller must close.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+type Config struct {
+	Kind string
+	Dir  string
+	S3   S3Config
+}
+
+// New builds the store selected by cfg.Kind.
+func New(cfg Config) (BlobStore, error) {
+	switch cfg.Kind {
+	case KindLocal, "":
+		return NewLocalStore(cfg.Dir)
+	case KindS3:
+		return NewS3Store(cfg.S3)
+	default:
+		return nil, fmt.Errorf("blob: unknown store kind %q", cfg.Kind)
+	}
+}
@@ -0,0 +1,44 @@
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Version is the release of the build. Set it when building:
+//
+//	go build -ldflags "-X chat_go/internal/lib/buildinfo.Version=v1.2.0" ./cmd/...
+var Version = "dev"
+
+type Info struct {
+	Version    string `json:"version"`
+	Commit     string `json:"commit,omitempty"`
+	CommitTime string `json:"commit_time,omitempty"`
+	// Modified is true when the build had uncommitted changes.
+	Modified  bool   `json:"modified"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the build info. The commit is stamped by go build in a git
+// checkout, go run leaves it empty.
+func Get() Info {
+	info := Info{Version: Version, GoVersion: runtime.Version()}
+
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			info.Commit = s.Value
+		case "vcs.time":
+			info.CommitTime = s.Value
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+
+	return info
+}
@@ -0,0 +1,64 @@
+package chatrole
+
+import "fmt"
+
+// Role is what a member may do in one chat. It is unrelated to the global
+// roles in the rbac package.
+type Role string
+
+const (
+	Owner  Role = "owner"
+	Admin  Role = "admin"
+	Member Role = "member"
+)
+
+// Action is something that only some members of a chat may do.
+type Action string
+
+const (
+	EditInfo       Action = "edit_info"
+	ManageMembers  Action = "manage_members"
+	DeleteMessages Action = "delete_messages"
+	PinMessages    Action = "pin_messages"
+	ChangeRoles    Action = "change_roles"
+	// Broadcast is posting in a channel. Anyone can post in other chats.
+	Broadcast Action = "broadcast"
+)
+
+var actions = map[Role][]Action{
+	Owner:  {EditInfo, ManageMembers, DeleteMessages, PinMessages, ChangeRoles, Broadcast},
+	Admin:  {EditInfo, ManageMembers, DeleteMessages, PinMessages, Broadcast},
+	Member: {},
+}
+
+var ranks = map[Role]int{
+	Member: 0,
+	Admin:  1,
+	Owner:  2,
+}
+
+func Parse(s string) (Role, error) {
+	role := Role(s)
+	if _, ok := actions[role]; !ok {
+		return "", fmt.Errorf("unknown chat role %q", s)
+	}
+
+	return role, nil
+}
+
+// Can reports whether the role allows action. Unknown roles allow nothing.
+func (r Role) Can(action Action) bool {
+	for _, a := range actions[r] {
+		if a == action {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Outranks reports whether r is strictly above other, so that an admin can
+// remove a member but not another admin or an owner.
+func (r Role) Outranks(other Role) bool {
+	return ranks[r] > ranks[other]
+}
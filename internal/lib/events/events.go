@@ -0,0 +1,155 @@
+package events
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Event is something that happened which other parts of the service may want
+// to react to, like sending a notification.
+type Event interface {
+	EventName() string
+}
+
+// Mention is published for every chat member mentioned in a new message.
+type Mention struct {
+	ChatID    int64
+	ChatName  string
+	MessageID int64
+	Sender    string
+	Username  string
+	Text      string
+}
+
+func (Mention) EventName() string { return "mention" }
+
+// PasswordResetRequested is published when someone asks to reset the password
+// of Username. The account may not exist.
+type PasswordResetRequested struct {
+	Username string
+}
+
+func (PasswordResetRequested) EventName() string { return "password_reset_requested" }
+
+type Handler func(ctx context.Context, e Event)
+
+type Config struct {
+	// Workers is how many handlers run at once.
+	Workers int
+	// QueueSize is how many deliveries wait for a worker. Once it is full,
+	// new events are dropped.
+	QueueSize int
+	// Timeout bounds each handler call. Zero means no limit.
+	Timeout time.Duration
+}
+
+// Bus delivers published events to every subscribed handler. A fixed number of
+// workers run the handlers, so a slow one never holds up the publisher, and a
+// burst of events can't start an unbounded number of goroutines.
+type Bus struct {
+	log     *slog.Logger
+	timeout time.Duration
+	queue   chan delivery
+	wg      sync.WaitGroup
+
+	mu       sync.RWMutex
+	handlers []Handler
+	closed   bool
+}
+
+type delivery struct {
+	ctx     context.Context
+	handler Handler
+	event   Event
+}
+
+func NewBus(log *slog.Logger, cfg Config) *Bus {
+	b := &Bus{
+		log:     log.With(slog.String("op", "events.Bus")),
+		timeout: cfg.Timeout,
+		queue:   make(chan delivery, cfg.QueueSize),
+	}
+
+	for i := 0; i < max(cfg.Workers, 1); i++ {
+		b.wg.Add(1)
+		go b.work()
+	}
+
+	return b
+}
+
+func (b *Bus) Subscribe(h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.handlers = append(b.handlers, h)
+}
+
+// Publish queues e for every handler and never blocks. The handlers keep
+// running after ctx is cancelled, but see its values. When the queue is full,
+// or the bus is closed, the event is dropped for the handlers left.
+func (b *Bus) Publish(ctx context.Context, e Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.closed {
+		b.log.Warn("bus is closed, event dropped", slog.String("event", e.EventName()))
+		return
+	}
+
+	ctx = context.WithoutCancel(ctx)
+
+	for _, h := range b.handlers {
+		select {
+		case b.queue <- delivery{ctx: ctx, handler: h, event: e}:
+		default:
+			b.log.Warn("event queue is full, event dropped", slog.String("event", e.EventName()))
+			return
+		}
+	}
+}
+
+// Close stops taking events and waits for the queued ones to be handled, or
+// for ctx to be done, then it returns ctx.Err() and the workers carry on alone.
+func (b *Bus) Close(ctx context.Context) error {
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.queue)
+	}
+	b.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *Bus) work() {
+	defer b.wg.Done()
+
+	for d := range b.queue {
+		b.deliver(d)
+	}
+}
+
+func (b *Bus) deliver(d delivery) {
+	ctx := d.ctx
+	if b.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.timeout)
+		defer cancel()
+	}
+
+	d.handler(ctx, d.event)
+}
@@ -0,0 +1,107 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var discard = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func TestBusBoundsTheHandlers(t *testing.T) {
+	b := NewBus(discard, Config{Workers: 2, QueueSize: 3})
+
+	release := make(chan struct{})
+	var running, peak, handled atomic.Int32
+	b.Subscribe(func(ctx context.Context, e Event) {
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		<-release
+		running.Add(-1)
+		handled.Add(1)
+	})
+
+	// Two are taken by the workers, three wait and the rest are dropped.
+	for i := 0; i < 5; i++ {
+		b.Publish(context.Background(), Mention{MessageID: int64(i)})
+		time.Sleep(10 * time.Millisecond)
+	}
+	for i := 0; i < 5; i++ {
+		b.Publish(context.Background(), Mention{MessageID: int64(5 + i)})
+	}
+
+	close(release)
+	if err := b.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := peak.Load(); got != 2 {
+		t.Fatalf("%d handlers ran at once, want 2", got)
+	}
+	if got := handled.Load(); got != 5 {
+		t.Fatalf("handled %d events, want 5", got)
+	}
+}
+
+func TestBusTimesOutHandlers(t *testing.T) {
+	b := NewBus(discard, Config{Workers: 1, QueueSize: 1, Timeout: 20 * time.Millisecond})
+
+	errs := make(chan error, 1)
+	b.Subscribe(func(ctx context.Context, e Event) {
+		<-ctx.Done()
+		errs <- ctx.Err()
+	})
+
+	// The publisher's context is cancelled at once, the handler's isn't.
+	ctx, cancel := context.WithCancel(context.Background())
+	b.Publish(ctx, Mention{})
+	cancel()
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("handler context ended with %v, want DeadlineExceeded", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("handler context never ended")
+	}
+
+	if err := b.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBusClose(t *testing.T) {
+	b := NewBus(discard, Config{Workers: 1, QueueSize: 1})
+
+	release := make(chan struct{})
+	defer close(release)
+
+	var handled atomic.Int32
+	b.Subscribe(func(ctx context.Context, e Event) {
+		handled.Add(1)
+		<-release
+	})
+	b.Publish(context.Background(), Mention{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := b.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Close with a stuck handler: got %v, want DeadlineExceeded", err)
+	}
+
+	// Publishing to a closed bus drops the event instead of panicking.
+	b.Publish(context.Background(), Mention{})
+	if got := handled.Load(); got != 1 {
+		t.Fatalf("handled %d events, want 1", got)
+	}
+}
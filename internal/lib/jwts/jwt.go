@@ -3,26 +3,95 @@ package jwts
 import (
 	"fmt"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+const purposeMFAPending = "mfa_pending"
+
 var (
 	secretKey = os.Getenv("JWT_SECRET_KEY")
-	tokenExpire = 20 * time.Minute 
+	tokenExpire = 20 * time.Minute
+	mfaTokenExpire = 5 * time.Minute
 )
 
-func GenerateJWTToken(userID int64) (string, error) {
+// Claims is what an auth token says about its holder. SessionVersion must match
+// the user's current session version, which changes whenever all of the user's
+// sessions are revoked. Role is the user's global role at login time; changing
+// it revokes the sessions too, so it can't go stale.
+type Claims struct {
+	UserID         int64
+	Username       string
+	SessionVersion int64
+	Role           string
+}
+
+func GenerateJWTToken(claims Claims) (string, error) {
+	return generate(jwt.MapClaims{
+		"userid":   fmt.Sprintf("%d", claims.UserID),
+		"username": claims.Username,
+		"sv":       claims.SessionVersion,
+		"role":     claims.Role,
+	}, tokenExpire)
+}
+
+// GenerateMFAPendingToken issues a short-lived token proving that the password
+// step succeeded. It is only accepted by VerifyMFAPendingToken.
+func GenerateMFAPendingToken(userID int64) (string, error) {
+	return generate(jwt.MapClaims{
+		"userid":  fmt.Sprintf("%d", userID),
+		"purpose": purposeMFAPending,
+	}, mfaTokenExpire)
+}
+
+func VerifyJWTToken(tokenString string) (Claims, error) {
+	claims, err := verify(tokenString, "")
+	if err != nil {
+		return Claims{}, err
+	}
+
+	userID, err := userIDFromClaims(claims)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	sessionVersion, ok := claims["sv"].(float64)
+	if !ok {
+		return Claims{}, fmt.Errorf("invalid session version type")
+	}
+
+	role, ok := claims["role"].(string)
+	if !ok {
+		return Claims{}, fmt.Errorf("invalid role type")
+	}
+
+	username, ok := claims["username"].(string)
+	if !ok {
+		return Claims{}, fmt.Errorf("invalid username type")
+	}
+
+	return Claims{UserID: userID, Username: username, SessionVersion: int64(sessionVersion), Role: role}, nil
+}
+
+func VerifyMFAPendingToken(tokenString string) (int64, error) {
+	claims, err := verify(tokenString, purposeMFAPending)
+	if err != nil {
+		return 0, err
+	}
+
+	return userIDFromClaims(claims)
+}
+
+func generate(claims jwt.MapClaims, expire time.Duration) (string, error) {
 
 	now := time.Now()
-	userIDStr := fmt.Sprintf("%d", userID)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"userid": userIDStr,
-		"iat": now.Unix(),
-		"nbf": now.Unix(),
-		"exp": now.Add(tokenExpire).Unix(),
-	})
+	claims["iat"] = now.Unix()
+	claims["nbf"] = now.Unix()
+	claims["exp"] = now.Add(expire).Unix()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	tokenString, err := token.SignedString([]byte(secretKey))
 	if err != nil {
@@ -32,7 +101,7 @@ func GenerateJWTToken(userID int64) (string, error) {
 	return tokenString, nil
 }
 
-func VerifyJWTToken(tokenString string) (string, error) {
+func verify(tokenString string, purpose string) (jwt.MapClaims, error) {
 
 	token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
 		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
@@ -42,16 +111,25 @@ func VerifyJWTToken(tokenString string) (string, error) {
 		return []byte(secretKey), nil
 	})
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		userID, ok := claims["userid"].(string)
-		if !ok {
-			return "", fmt.Errorf("invalid userID type")
+		tokenPurpose, _ := claims["purpose"].(string)
+		if tokenPurpose != purpose {
+			return nil, fmt.Errorf("invalid token purpose")
 		}
-		return userID, nil
-	} 
+		return claims, nil
+	}
+
+	return nil, fmt.Errorf("invalid token")
+}
+
+func userIDFromClaims(claims jwt.MapClaims) (int64, error) {
+	userIDStr, ok := claims["userid"].(string)
+	if !ok {
+		return 0, fmt.Errorf("invalid userID type")
+	}
 
-	return "", fmt.Errorf("invalid token")
-}
\ No newline at end of file
+	return strconv.ParseInt(userIDStr, 10, 64)
+}
@@ -0,0 +1,159 @@
+package lockout
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	AccountMaxFailures int
+	IPMaxFailures      int
+	BaseDelay          time.Duration
+	MaxDelay           time.Duration
+	Duration           time.Duration
+}
+
+// Guard counts failed logins per account and per client IP. Every failure
+// delays the next attempt on the account a bit longer, and reaching the limit
+// locks the account or the IP out for Config.Duration. IPs get no delay before
+// the limit, since many users may share one address.
+type Guard struct {
+	cfg Config
+
+	mu        sync.Mutex
+	accounts  map[string]*counter
+	ips       map[string]*counter
+	lastSweep time.Time
+}
+
+type counter struct {
+	failures    int
+	nextAttempt time.Time
+	lockedUntil time.Time
+	lastFailure time.Time
+}
+
+func New(cfg Config) *Guard {
+	return &Guard{
+		cfg:      cfg,
+		accounts: make(map[string]*counter),
+		ips:      make(map[string]*counter),
+	}
+}
+
+// Allow reports whether a login attempt for username from ip may proceed.
+// When it may not, the returned duration tells the client when to retry.
+func (g *Guard) Allow(username, ip string) (time.Duration, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+
+	wait := max(retryAfter(g.accounts[username], now), retryAfter(g.ips[ip], now))
+
+	return wait, wait == 0
+}
+
+// Fail records a failed attempt and reports whether it locked the account or the IP.
+func (g *Guard) Fail(username, ip string) (accountLocked bool, ipLocked bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	g.sweep(now)
+
+	accountLocked = g.fail(g.accounts, username, g.cfg.AccountMaxFailures, true, now)
+	ipLocked = g.fail(g.ips, ip, g.cfg.IPMaxFailures, false, now)
+
+	return accountLocked, ipLocked
+}
+
+// Succeed clears the failures of an account after a successful login. The IP
+// counter is kept, so one valid account can't be used to reset it.
+func (g *Guard) Succeed(username string) {
+	g.UnlockAccount(username)
+}
+
+func (g *Guard) UnlockAccount(username string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delete(g.accounts, username)
+}
+
+func (g *Guard) UnlockIP(ip string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delete(g.ips, ip)
+}
+
+func (g *Guard) fail(counters map[string]*counter, key string, maxFailures int, progressive bool, now time.Time) bool {
+	c, ok := counters[key]
+	if !ok || (!c.lockedUntil.IsZero() && now.After(c.lockedUntil)) {
+		c = &counter{}
+		counters[key] = c
+	}
+
+	c.failures++
+	c.lastFailure = now
+
+	if maxFailures > 0 && c.failures >= maxFailures {
+		c.lockedUntil = now.Add(g.cfg.Duration)
+		return true
+	}
+	if !progressive {
+		return false
+	}
+
+	delay := g.cfg.BaseDelay << (c.failures - 1)
+	if delay > g.cfg.MaxDelay || delay <= 0 {
+		delay = g.cfg.MaxDelay
+	}
+	c.nextAttempt = now.Add(delay)
+
+	return false
+}
+
+// sweep drops counters that have not failed for a while, so the maps don't
+// grow forever under a spray of random usernames.
+func (g *Guard) sweep(now time.Time) {
+	if now.Sub(g.lastSweep) < time.Minute {
+		return
+	}
+	g.lastSweep = now
+
+	for _, counters := range []map[string]*counter{g.accounts, g.ips} {
+		for key, c := range counters {
+			if now.After(c.lockedUntil) && now.Sub(c.lastFailure) > g.cfg.Duration {
+				delete(counters, key)
+			}
+		}
+	}
+}
+
+func retryAfter(c *counter, now time.Time) time.Duration {
+	if c == nil {
+		return 0
+	}
+	if now.Before(c.lockedUntil) {
+		return c.lockedUntil.Sub(now)
+	}
+	if c.lockedUntil.IsZero() && now.Before(c.nextAttempt) {
+		return c.nextAttempt.Sub(now)
+	}
+
+	return 0
+}
+
+// ClientIP returns the address used as the per-IP key for a request.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -0,0 +1,20 @@
+package sl
+
+import (
+	"context"
+	"log/slog"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceID is the ID of the trace ctx belongs to, so log records of one request
+// can be found in every service it went through. It is empty, and dropped by
+// slog, outside a trace.
+func TraceID(ctx context.Context) slog.Attr {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return slog.Attr{}
+	}
+
+	return slog.String("trace_id", sc.TraceID().String())
+}
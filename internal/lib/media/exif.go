@@ -0,0 +1,300 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+const (
+	gpsIFDTag      = 0x8825
+	orientationTag = 0x0112
+)
+
+var (
+	errBadExif = errors.New("malformed exif data")
+
+	// ErrUnsupportedImage is returned for images that may carry EXIF data in a
+	// container StripGPS can't read, like HEIC or TIFF.
+	ErrUnsupportedImage = errors.New("unsupported image format")
+)
+
+// StripGPS removes the GPS location from the EXIF data of a JPEG, PNG or WebP
+// image. The rest of the metadata and the image itself are left as they are.
+// GIF, BMP and ICO images can't hold EXIF data and are returned unchanged.
+// Other formats give ErrUnsupportedImage.
+func StripGPS(data []byte) ([]byte, error) {
+	if noExif(data) {
+		return data, nil
+	}
+
+	out := bytes.Clone(data)
+	if err := walkExif(out, stripTIFF); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// Orientation returns the EXIF orientation of an image, from 1 to 8, which
+// says how to turn the stored pixels to show them upright. Images without
+// one, or with a malformed one, give 1.
+func Orientation(data []byte) int {
+	orientation := 1
+
+	walkExif(data, func(tiff []byte) error {
+		if o, ok := readOrientation(tiff); ok {
+			orientation = o
+		}
+		return nil
+	})
+
+	return orientation
+}
+
+// noExif tells whether data is in a format that can't hold EXIF data.
+func noExif(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("GIF8")) ||
+		bytes.HasPrefix(data, []byte("BM")) ||
+		bytes.HasPrefix(data, []byte("\x00\x00\x01\x00"))
+}
+
+// walkExif calls fn with the TIFF structure of every EXIF block of a JPEG,
+// PNG or WebP image. fn may change the structure in place, but not its size.
+func walkExif(data []byte, fn func(tiff []byte) error) error {
+	switch {
+	case bytes.HasPrefix(data, []byte("\xff\xd8")):
+		return walkJPEG(data, fn)
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return walkPNG(data, fn)
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return walkWebP(data, fn)
+	default:
+		return ErrUnsupportedImage
+	}
+}
+
+// walkJPEG walks the segments before the image data, looking for the APP1
+// segments that hold EXIF data.
+func walkJPEG(data []byte, fn func(tiff []byte) error) error {
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xff {
+			return errBadExif
+		}
+		marker := data[i+1]
+		// Start of scan: the image data follows, there is no metadata after it.
+		if marker == 0xda || marker == 0xd9 {
+			break
+		}
+		// Markers without a length.
+		if marker == 0x01 || marker >= 0xd0 && marker <= 0xd7 || marker == 0xff {
+			i += 2
+			continue
+		}
+
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			return errBadExif
+		}
+
+		payload := data[i+4 : end]
+		if marker == 0xe1 && bytes.HasPrefix(payload, []byte("Exif\x00\x00")) {
+			if err := fn(payload[6:]); err != nil {
+				return err
+			}
+		}
+
+		i = end
+	}
+
+	return nil
+}
+
+// walkPNG looks for the eXIf chunk, and fixes its checksum if fn changed it.
+func walkPNG(data []byte, fn func(tiff []byte) error) error {
+	for i := 8; i+12 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		end := i + 12 + length
+		if length < 0 || end > len(data) {
+			return errBadExif
+		}
+
+		kind := string(data[i+4 : i+8])
+		if kind == "eXIf" {
+			if err := fn(data[i+8 : i+8+length]); err != nil {
+				return err
+			}
+			if sum := crc32.ChecksumIEEE(data[i+4 : i+8+length]); sum != binary.BigEndian.Uint32(data[end-4:]) {
+				binary.BigEndian.PutUint32(data[end-4:], sum)
+			}
+		}
+		if kind == "IEND" {
+			break
+		}
+
+		i = end
+	}
+
+	return nil
+}
+
+// walkWebP looks for the EXIF chunk of the RIFF container. WebP chunks have no
+// checksum.
+func walkWebP(data []byte, fn func(tiff []byte) error) error {
+	for i := 12; i+8 <= len(data); {
+		length := int(binary.LittleEndian.Uint32(data[i+4:]))
+		end := i + 8 + length
+		if length < 0 || end > len(data) {
+			return errBadExif
+		}
+
+		if string(data[i:i+4]) == "EXIF" {
+			// Some writers keep the JPEG style prefix.
+			payload := bytes.TrimPrefix(data[i+8:end], []byte("Exif\x00\x00"))
+			if err := fn(payload); err != nil {
+				return err
+			}
+		}
+
+		// Chunks are padded to an even size.
+		i = end + length%2
+	}
+
+	return nil
+}
+
+// readOrientation reads the orientation entry of the first IFD.
+func readOrientation(tiff []byte) (int, bool) {
+	order, err := byteOrder(tiff)
+	if err != nil {
+		return 0, false
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	count, err := ifdCount(tiff, order, ifd)
+	if err != nil {
+		return 0, false
+	}
+
+	for n := 0; n < count; n++ {
+		entry := ifd + 2 + n*12
+		// The orientation is a single SHORT, stored in the entry itself.
+		if order.Uint16(tiff[entry:]) != orientationTag || order.Uint16(tiff[entry+2:]) != 3 {
+			continue
+		}
+
+		o := int(order.Uint16(tiff[entry+8:]))
+		return o, o >= 1 && o <= 8
+	}
+
+	return 0, false
+}
+
+func byteOrder(tiff []byte) (binary.ByteOrder, error) {
+	if len(tiff) < 8 {
+		return nil, errBadExif
+	}
+
+	switch string(tiff[:2]) {
+	case "II":
+		return binary.LittleEndian, nil
+	case "MM":
+		return binary.BigEndian, nil
+	default:
+		return nil, errBadExif
+	}
+}
+
+// stripTIFF zeroes the GPS IFD of the TIFF structure that EXIF data is stored
+// in, and removes the entry of the first IFD that points to it. It works in
+// place, so none of the other offsets change.
+func stripTIFF(tiff []byte) error {
+	order, err := byteOrder(tiff)
+	if err != nil {
+		return err
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	count, err := ifdCount(tiff, order, ifd)
+	if err != nil {
+		return err
+	}
+
+	for n := 0; n < count; n++ {
+		entry := ifd + 2 + n*12
+		if order.Uint16(tiff[entry:]) != gpsIFDTag {
+			continue
+		}
+
+		if err := zeroIFD(tiff, order, int(order.Uint32(tiff[entry+8:]))); err != nil {
+			return err
+		}
+
+		// Move the following entries and the next IFD offset up over this one.
+		tail := ifd + 2 + count*12 + 4
+		copy(tiff[entry:], tiff[entry+12:tail])
+		clear(tiff[tail-12 : tail])
+		order.PutUint16(tiff[ifd:], uint16(count-1))
+
+		return nil
+	}
+
+	return nil
+}
+
+// zeroIFD overwrites an IFD and the values its entries point to.
+func zeroIFD(tiff []byte, order binary.ByteOrder, ifd int) error {
+	count, err := ifdCount(tiff, order, ifd)
+	if err != nil {
+		return err
+	}
+
+	for n := 0; n < count; n++ {
+		entry := ifd + 2 + n*12
+		size := typeSize(order.Uint16(tiff[entry+2:])) * int(order.Uint32(tiff[entry+4:]))
+		if size <= 4 {
+			continue
+		}
+
+		offset := int(order.Uint32(tiff[entry+8:]))
+		if offset < 0 || offset+size > len(tiff) || size < 0 {
+			return errBadExif
+		}
+		clear(tiff[offset : offset+size])
+	}
+
+	clear(tiff[ifd : ifd+2+count*12+4])
+
+	return nil
+}
+
+func ifdCount(tiff []byte, order binary.ByteOrder, ifd int) (int, error) {
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0, errBadExif
+	}
+
+	count := int(order.Uint16(tiff[ifd:]))
+	if ifd+2+count*12+4 > len(tiff) {
+		return 0, errBadExif
+	}
+
+	return count, nil
+}
+
+// typeSize returns the size in bytes of one value of a TIFF field type.
+func typeSize(t uint16) int {
+	switch t {
+	case 1, 2, 6, 7: // BYTE, ASCII, SBYTE, UNDEFINED
+		return 1
+	case 3, 8: // SHORT, SSHORT
+		return 2
+	case 4, 9, 11: // LONG, SLONG, FLOAT
+		return 4
+	case 5, 10, 12: // RATIONAL, SRATIONAL, DOUBLE
+		return 8
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,311 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// latitude is the GPS value the test EXIF data holds. It must not survive
+// StripGPS.
+var latitude = []byte("\x00\x00\x00\x30\x00\x00\x00\x01\x00\x00\x00\x0c\x00\x00\x00\x01\x00\x00\x13\x88\x00\x00\x00\x64")
+
+// buildTIFF makes EXIF data with an orientation and a GPS IFD holding
+// latitude.
+func buildTIFF(order binary.AppendByteOrder, orientation uint16) []byte {
+	var b []byte
+	if order == binary.LittleEndian {
+		b = append(b, "II"...)
+	} else {
+		b = append(b, "MM"...)
+	}
+	b = order.AppendUint16(b, 42)
+	b = order.AppendUint32(b, 8)
+
+	// IFD0 at 8: orientation and the GPS IFD pointer.
+	const gpsIFD = 8 + 2 + 2*12 + 4
+	b = order.AppendUint16(b, 2)
+	b = order.AppendUint16(b, orientationTag)
+	b = order.AppendUint16(b, 3)
+	b = order.AppendUint32(b, 1)
+	b = order.AppendUint16(b, orientation)
+	b = order.AppendUint16(b, 0)
+	b = order.AppendUint16(b, gpsIFDTag)
+	b = order.AppendUint16(b, 4)
+	b = order.AppendUint32(b, 1)
+	b = order.AppendUint32(b, gpsIFD)
+	b = order.AppendUint32(b, 0)
+
+	// GPS IFD: the latitude, three RATIONALs stored after it.
+	const latOffset = gpsIFD + 2 + 12 + 4
+	b = order.AppendUint16(b, 1)
+	b = order.AppendUint16(b, 2)
+	b = order.AppendUint16(b, 5)
+	b = order.AppendUint32(b, 3)
+	b = order.AppendUint32(b, latOffset)
+	b = order.AppendUint32(b, 0)
+
+	return append(b, latitude...)
+}
+
+func testImage(w, h int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 255 / w), uint8(y * 255 / h), 0, 255})
+		}
+	}
+	// The top left corner is white, to tell where it ends up.
+	for y := 0; y < h/4; y++ {
+		for x := 0; x < w/4; x++ {
+			img.Set(x, y, color.White)
+		}
+	}
+	return img
+}
+
+func jpegWithExif(t *testing.T, tiff []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(40, 20), &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	app1 := []byte{0xff, 0xe1}
+	app1 = binary.BigEndian.AppendUint16(app1, uint16(2+6+len(tiff)))
+	app1 = append(app1, "Exif\x00\x00"...)
+	app1 = append(app1, tiff...)
+
+	return append(append(bytes.Clone(data[:2]), app1...), data[2:]...)
+}
+
+func pngWithExif(t *testing.T, tiff []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage(40, 20)); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	// The signature and IHDR come first.
+	const ihdrEnd = 8 + 12 + 13
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(tiff)))
+	chunk = append(chunk, "eXIf"...)
+	chunk = append(chunk, tiff...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+
+	return append(append(bytes.Clone(data[:ihdrEnd]), chunk...), data[ihdrEnd:]...)
+}
+
+func webpWithExif(tiff []byte) []byte {
+	chunk := func(b []byte, kind string, payload []byte) []byte {
+		b = append(b, kind...)
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(payload)))
+		b = append(b, payload...)
+		if len(payload)%2 == 1 {
+			b = append(b, 0)
+		}
+		return b
+	}
+
+	var body []byte
+	body = append(body, "WEBP"...)
+	body = chunk(body, "VP8X", make([]byte, 10))
+	// An odd sized chunk, to check the padding is skipped.
+	body = chunk(body, "ICCP", []byte{1, 2, 3})
+	body = chunk(body, "EXIF", tiff)
+
+	data := append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...)
+	return append(data, body...)
+}
+
+// checkStripped checks the GPS IFD is gone and the rest of the EXIF data is
+// still readable.
+func checkStripped(t *testing.T, out []byte, orientation int) {
+	t.Helper()
+
+	if bytes.Contains(out, latitude) {
+		t.Fatal("the latitude is still there")
+	}
+
+	var entries int
+	err := walkExif(out, func(tiff []byte) error {
+		order, err := byteOrder(tiff)
+		if err != nil {
+			return err
+		}
+		entries, err = ifdCount(tiff, order, int(order.Uint32(tiff[4:])))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("stripped data doesn't parse: %v", err)
+	}
+	if entries != 1 {
+		t.Fatalf("IFD0 has %d entries, want 1", entries)
+	}
+	if got := Orientation(out); got != orientation {
+		t.Fatalf("orientation = %d, want %d", got, orientation)
+	}
+}
+
+func TestStripGPS(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  []byte
+		check func(t *testing.T, out []byte)
+	}{
+		{"jpeg big endian", jpegWithExif(t, buildTIFF(binary.BigEndian, 6)), func(t *testing.T, out []byte) {
+			if _, err := jpeg.Decode(bytes.NewReader(out)); err != nil {
+				t.Fatalf("stripped JPEG doesn't decode: %v", err)
+			}
+		}},
+		{"jpeg little endian", jpegWithExif(t, buildTIFF(binary.LittleEndian, 6)), nil},
+		{"png", pngWithExif(t, buildTIFF(binary.LittleEndian, 6)), func(t *testing.T, out []byte) {
+			// png.Decode checks the CRC of every chunk.
+			if _, err := png.Decode(bytes.NewReader(out)); err != nil {
+				t.Fatalf("stripped PNG doesn't decode: %v", err)
+			}
+		}},
+		{"webp", webpWithExif(buildTIFF(binary.BigEndian, 6)), nil},
+		{"webp with exif prefix", webpWithExif(append([]byte("Exif\x00\x00"), buildTIFF(binary.LittleEndian, 6)...)), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := bytes.Clone(tt.data)
+
+			out, err := StripGPS(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(tt.data, in) {
+				t.Fatal("StripGPS changed its input")
+			}
+			if len(out) != len(in) {
+				t.Fatalf("size changed from %d to %d", len(in), len(out))
+			}
+
+			checkStripped(t, out, 6)
+			if tt.check != nil {
+				tt.check(t, out)
+			}
+		})
+	}
+}
+
+func TestStripGPSFormats(t *testing.T) {
+	var gif bytes.Buffer
+	gif.WriteString("GIF89a")
+
+	if out, err := StripGPS(gif.Bytes()); err != nil || !bytes.Equal(out, gif.Bytes()) {
+		t.Fatalf("GIF: got %v, want it unchanged", err)
+	}
+
+	// HEIC starts with an ftyp box.
+	heic := []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic")
+	if _, err := StripGPS(heic); !errors.Is(err, ErrUnsupportedImage) {
+		t.Fatalf("HEIC: got %v, want ErrUnsupportedImage", err)
+	}
+	tiff := buildTIFF(binary.LittleEndian, 1)
+	if _, err := StripGPS(tiff); !errors.Is(err, ErrUnsupportedImage) {
+		t.Fatalf("TIFF: got %v, want ErrUnsupportedImage", err)
+	}
+}
+
+func TestStripGPSMalformed(t *testing.T) {
+	good := jpegWithExif(t, buildTIFF(binary.BigEndian, 1))
+
+	tests := map[string][]byte{
+		// The APP1 length runs past the end.
+		"segment too long": append(bytes.Clone(good[:4]), 0xff, 0xff),
+		// The GPS IFD pointer goes past the EXIF data.
+		"bad gps offset": func() []byte {
+			tiff := buildTIFF(binary.BigEndian, 1)
+			binary.BigEndian.PutUint32(tiff[8+2+12+8:], 5000)
+			return jpegWithExif(t, tiff)
+		}(),
+		"bad byte order": jpegWithExif(t, append([]byte("XX"), buildTIFF(binary.BigEndian, 1)[2:]...)),
+		"png chunk too long": func() []byte {
+			data := pngWithExif(t, buildTIFF(binary.BigEndian, 1))
+			binary.BigEndian.PutUint32(data[33:], 1<<30)
+			return data
+		}(),
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := StripGPS(data); !errors.Is(err, errBadExif) {
+				t.Fatalf("got %v, want errBadExif", err)
+			}
+		})
+	}
+}
+
+func TestOrientation(t *testing.T) {
+	for o := 1; o <= 8; o++ {
+		if got := Orientation(jpegWithExif(t, buildTIFF(binary.LittleEndian, uint16(o)))); got != o {
+			t.Fatalf("orientation %d read as %d", o, got)
+		}
+	}
+
+	if got := Orientation(jpegWithExif(t, buildTIFF(binary.LittleEndian, 9))); got != 1 {
+		t.Fatalf("invalid orientation read as %d, want 1", got)
+	}
+
+	var plain bytes.Buffer
+	jpeg.Encode(&plain, testImage(4, 4), nil)
+	if got := Orientation(plain.Bytes()); got != 1 {
+		t.Fatalf("no exif read as %d, want 1", got)
+	}
+}
+
+func TestThumbnailsAreUpright(t *testing.T) {
+	tests := []struct {
+		orientation int
+		w, h        int
+		// corner is where the white top left corner of the stored image
+		// should be in the thumbnail: 0 top left, 1 top right, 2 bottom
+		// right, 3 bottom left.
+		corner int
+	}{
+		{1, 20, 10, 0},
+		{2, 20, 10, 1},
+		{3, 20, 10, 2},
+		{4, 20, 10, 3},
+		{5, 10, 20, 0},
+		{6, 10, 20, 1},
+		{7, 10, 20, 2},
+		{8, 10, 20, 3},
+	}
+	for _, tt := range tests {
+		data := pngWithExif(t, buildTIFF(binary.BigEndian, uint16(tt.orientation)))
+
+		thumbs, err := Thumbnails(bytes.NewReader(data), []int{20})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(thumbs) != 1 || thumbs[0].Width != tt.w || thumbs[0].Height != tt.h {
+			t.Fatalf("orientation %d: got %+v, want %dx%d", tt.orientation, thumbs, tt.w, tt.h)
+		}
+
+		img, err := png.Decode(bytes.NewReader(thumbs[0].Data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		corners := []image.Point{{0, 0}, {tt.w - 1, 0}, {tt.w - 1, tt.h - 1}, {0, tt.h - 1}}
+		for i, p := range corners {
+			r, g, b, _ := img.At(p.X, p.Y).RGBA()
+			white := r > 0xf000 && g > 0xf000 && b > 0xf000
+			if white != (i == tt.corner) {
+				t.Fatalf("orientation %d: corner %d white = %v", tt.orientation, i, white)
+			}
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package media
+
+import (
+	"bytes"
+	"chat_go/internal/lib/blob"
+	"chat_go/internal/lib/logger/sl"
+	"chat_go/internal/storage"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+// Job asks for thumbnails of an image that is already in the blob store.
+type Job struct {
+	AttachmentID int64
+	Key          string
+}
+
+type ThumbnailSaver interface {
+	// SaveThumbnail fails with storage.ErrAttachmentNotFound if the
+	// attachment was deleted in the meantime.
+	SaveThumbnail(ctx context.Context, attachmentID int64, size int, width int, height int, key string, contentType string) error
+}
+
+// Processor makes thumbnails in the background with a fixed number of
+// workers, so that decoding big images never holds up a request.
+type Processor struct {
+	log   *slog.Logger
+	blobs blob.BlobStore
+	saver ThumbnailSaver
+	sizes []int
+	jobs  chan Job
+	wg    sync.WaitGroup
+
+	// mu keeps Submit from sending on jobs once Close has closed it.
+	mu     sync.RWMutex
+	closed bool
+}
+
+func NewProcessor(log *slog.Logger, blobs blob.BlobStore, saver ThumbnailSaver, sizes []int, workers int, queueSize int) *Processor {
+	p := &Processor{
+		log:   log.With(slog.String("op", "media.Processor")),
+		blobs: blobs,
+		saver: saver,
+		sizes: sizes,
+		jobs:  make(chan Job, queueSize),
+	}
+
+	for i := 0; i < max(workers, 1); i++ {
+		p.wg.Add(1)
+		go p.work()
+	}
+
+	return p
+}
+
+// Submit queues a job. It never blocks: when the queue is full, or the
+// processor is closed, the job is dropped and false is returned, the image is
+// then shown without thumbnails.
+func (p *Processor) Submit(job Job) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		return false
+	}
+
+	select {
+	case p.jobs <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close stops accepting jobs and waits for the queued ones to finish, or for
+// ctx to be done, then it returns ctx.Err() and the workers carry on alone.
+func (p *Processor) Close(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.jobs)
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *Processor) work() {
+	defer p.wg.Done()
+
+	for job := range p.jobs {
+		if err := p.process(context.Background(), job); err != nil {
+			p.log.Error("failed to make thumbnails", slog.Int64("attachment_id", job.AttachmentID), sl.Err(err))
+		}
+	}
+}
+
+func (p *Processor) process(ctx context.Context, job Job) error {
+	r, err := p.blobs.Get(ctx, job.Key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	thumbs, err := Thumbnails(r, p.sizes)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range thumbs {
+		key := fmt.Sprintf("%s_%d", job.Key, t.Size)
+
+		if err := p.blobs.Put(ctx, key, bytes.NewReader(t.Data), int64(len(t.Data)), t.ContentType); err != nil {
+			return err
+		}
+
+		err := p.saver.SaveThumbnail(ctx, job.AttachmentID, t.Size, t.Width, t.Height, key, t.ContentType)
+		if err != nil {
+			if err := p.blobs.Delete(ctx, key); err != nil {
+				p.log.Error("failed to delete thumbnail", slog.String("key", key), sl.Err(err))
+			}
+			// The message was deleted while the thumbnails were being made.
+			if errors.Is(err, storage.ErrAttachmentNotFound) {
+				return nil
+			}
+			return err
+		}
+	}
+
+	p.log.Info("thumbnails made", slog.Int64("attachment_id", job.AttachmentID), slog.Int("count", len(thumbs)))
+
+	return nil
+}
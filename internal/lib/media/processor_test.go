@@ -0,0 +1,76 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+// blockingStore holds every Get until release is closed.
+type blockingStore struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	return nil
+}
+
+func (s *blockingStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	s.started <- struct{}{}
+	<-s.release
+	return nil, errors.New("gone")
+}
+
+func (s *blockingStore) Delete(ctx context.Context, key string) error {
+	return nil
+}
+
+type noSaver struct{}
+
+func (noSaver) SaveThumbnail(ctx context.Context, attachmentID int64, size int, width int, height int, key string, contentType string) error {
+	return nil
+}
+
+func newTestProcessor(t *testing.T) (*Processor, *blockingStore) {
+	t.Helper()
+
+	store := &blockingStore{started: make(chan struct{}, 1), release: make(chan struct{})}
+	t.Cleanup(func() { close(store.release) })
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return NewProcessor(log, store, noSaver{}, []int{64}, 1, 4), store
+}
+
+func TestSubmitAfterClose(t *testing.T) {
+	p, _ := newTestProcessor(t)
+
+	if err := p.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if p.Submit(Job{AttachmentID: 1, Key: "a"}) {
+		t.Fatal("a closed processor took a job")
+	}
+	if err := p.Close(context.Background()); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+}
+
+func TestCloseGivesUpWithContext(t *testing.T) {
+	p, store := newTestProcessor(t)
+
+	if !p.Submit(Job{AttachmentID: 1, Key: "a"}) {
+		t.Fatal("job was dropped")
+	}
+	<-store.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := p.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Close with a stuck job: got %v, want DeadlineExceeded", err)
+	}
+}
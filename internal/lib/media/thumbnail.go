@@ -0,0 +1,208 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+// MaxPixels guards against images that are small files but decode into huge
+// bitmaps.
+const MaxPixels = 50_000_000
+
+var ErrTooManyPixels = errors.New("image is too large to process")
+
+// Info describes an image without decoding all of it.
+type Info struct {
+	Format string
+	Width  int
+	Height int
+}
+
+// DecodeInfo reads the format and the dimensions of an image. It fails for
+// formats the standard library can't decode.
+func DecodeInfo(r io.Reader) (Info, error) {
+	cfg, format, err := image.DecodeConfig(r)
+	if err != nil {
+		return Info{}, err
+	}
+
+	return Info{Format: format, Width: cfg.Width, Height: cfg.Height}, nil
+}
+
+// Upright returns the info of the image once turned the way the EXIF
+// orientation says: orientations 5 to 8 swap the width and the height.
+func (i Info) Upright(orientation int) Info {
+	if orientation >= 5 && orientation <= 8 {
+		i.Width, i.Height = i.Height, i.Width
+	}
+
+	return i
+}
+
+// Thumbnail is one encoded size of an image.
+type Thumbnail struct {
+	// Size is the longest side the thumbnail was made to fit in.
+	Size        int
+	Width       int
+	Height      int
+	ContentType string
+	Data        []byte
+}
+
+// Thumbnails decodes an image, turns it upright as its EXIF orientation says,
+// and scales it down to fit each of sizes. Sizes that aren't smaller than the
+// image are skipped. JPEGs stay JPEGs, other images become PNGs so that
+// transparency is kept. The thumbnails have no metadata.
+func Thumbnails(r io.Reader, sizes []int) ([]Thumbnail, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := DecodeInfo(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if info.Width*info.Height > MaxPixels {
+		return nil, ErrTooManyPixels
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	src := image.NewRGBA(image.Rect(0, 0, info.Width, info.Height))
+	draw.Draw(src, src.Bounds(), img, img.Bounds().Min, draw.Src)
+
+	orientation := Orientation(data)
+	src = orient(src, orientation)
+	info = info.Upright(orientation)
+
+	var thumbs []Thumbnail
+
+	for _, size := range sizes {
+		if size <= 0 || size >= info.Width && size >= info.Height {
+			continue
+		}
+
+		w, h := fit(info.Width, info.Height, size)
+		dst := shrink(src, w, h)
+
+		var buf bytes.Buffer
+		contentType := "image/png"
+		if info.Format == "jpeg" {
+			contentType = "image/jpeg"
+			err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85})
+		} else {
+			err = png.Encode(&buf, dst)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("encode %dpx thumbnail: %w", size, err)
+		}
+
+		thumbs = append(thumbs, Thumbnail{
+			Size:        size,
+			Width:       w,
+			Height:      h,
+			ContentType: contentType,
+			Data:        buf.Bytes(),
+		})
+	}
+
+	return thumbs, nil
+}
+
+// fit scales width and height down, keeping the aspect ratio, so that the
+// longer side is size.
+func fit(width, height, size int) (int, int) {
+	if width >= height {
+		return size, max(1, height*size/width)
+	}
+
+	return max(1, width*size/height), size
+}
+
+// orient turns src upright according to an EXIF orientation: 2 and 4 are
+// mirrored, 3 is upside down, 6 and 8 are turned a quarter, 5 and 7 are both.
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			// (sx, sy) is the source pixel that ends up at (x, y).
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[y*dst.Stride+x*4:y*dst.Stride+x*4+4], src.Pix[sy*src.Stride+sx*4:])
+		}
+	}
+
+	return dst
+}
+
+// shrink scales src down to w x h by averaging the source pixels that fall in
+// each destination pixel.
+func shrink(src *image.RGBA, w, h int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+
+	for y := 0; y < h; y++ {
+		y0, y1 := y*sh/h, max((y+1)*sh/h, y*sh/h+1)
+
+		for x := 0; x < w; x++ {
+			x0, x1 := x*sw/w, max((x+1)*sw/w, x*sw/w+1)
+
+			var r, g, b, a, n int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += int(p[0])
+					g += int(p[1])
+					b += int(p[2])
+					a += int(p[3])
+					n++
+				}
+			}
+
+			d := dst.Pix[y*dst.Stride+x*4 : y*dst.Stride+x*4+4]
+			d[0] = uint8(r / n)
+			d[1] = uint8(g / n)
+			d[2] = uint8(b / n)
+			d[3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
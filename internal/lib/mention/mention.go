@@ -0,0 +1,81 @@
+package mention
+
+import (
+	"chat_go/internal/lib/events"
+	"chat_go/internal/lib/logger/sl"
+	"chat_go/internal/lib/notify"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+)
+
+// pattern matches @username. Dots and dashes are allowed inside a username but
+// not at its end, so "thanks @bob." mentions @bob.
+var pattern = regexp.MustCompile(`@[\p{L}\p{N}_]+(?:[.-][\p{L}\p{N}_]+)*`)
+
+// Parse returns the usernames mentioned in text, each once, in the order they
+// first appear.
+func Parse(text string) []string {
+	var usernames []string
+	seen := map[string]bool{}
+
+	for _, m := range pattern.FindAllStringIndex(text, -1) {
+		// An @ right after a letter is part of an email address, not a mention.
+		if m[0] > 0 && isWordByte(text[m[0]-1]) {
+			continue
+		}
+
+		username := text[m[0]:m[1]]
+		if !seen[username] {
+			seen[username] = true
+			usernames = append(usernames, username)
+		}
+	}
+
+	return usernames
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+}
+
+type EmailGetter interface {
+	GetEmailByUsername(ctx context.Context, username string) (string, error)
+}
+
+// NewNotifyHandler sends a notification to every mentioned user. Users without
+// an email address are still passed on, for notifiers that don't need one.
+func NewNotifyHandler(log *slog.Logger, notifier notify.Notifier, emails EmailGetter) events.Handler {
+	return func(ctx context.Context, e events.Event) {
+		const op = "mention.Notify"
+
+		m, ok := e.(events.Mention)
+		if !ok {
+			return
+		}
+
+		log := log.With(slog.String("op", op), sl.TraceID(ctx))
+
+		email, err := emails.GetEmailByUsername(ctx, m.Username)
+		if err != nil {
+			log.Error("failed to get email", slog.String("user", m.Username), sl.Err(err))
+			return
+		}
+
+		err = notifier.Notify(ctx, notify.Message{
+			To:       email,
+			Username: m.Username,
+			Subject:  fmt.Sprintf("%s mentioned you in %s", m.Sender, m.ChatName),
+			Body:     m.Sender + ": " + m.Text,
+		})
+		if errors.Is(err, notify.ErrNoRecipient) {
+			log.Debug("user has no email address", slog.String("user", m.Username))
+			return
+		}
+		if err != nil {
+			log.Error("failed to send mention notification", slog.String("user", m.Username), sl.Err(err))
+		}
+	}
+}
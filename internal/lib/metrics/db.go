@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// dbCollector reads the pool stats of the database on every scrape.
+type dbCollector struct {
+	db DBStatser
+}
+
+var (
+	dbMaxOpen = prometheus.NewDesc(prometheus.BuildFQName(namespace, "db", "max_open_connections"),
+		"Maximum number of open connections to the database.", nil, nil)
+	dbOpen = prometheus.NewDesc(prometheus.BuildFQName(namespace, "db", "open_connections"),
+		"Established connections, in use and idle.", nil, nil)
+	dbInUse = prometheus.NewDesc(prometheus.BuildFQName(namespace, "db", "in_use_connections"),
+		"Connections currently in use.", nil, nil)
+	dbIdle = prometheus.NewDesc(prometheus.BuildFQName(namespace, "db", "idle_connections"),
+		"Idle connections.", nil, nil)
+	dbWaitCount = prometheus.NewDesc(prometheus.BuildFQName(namespace, "db", "wait_count_total"),
+		"Times a connection had to be waited for.", nil, nil)
+	dbWaitDuration = prometheus.NewDesc(prometheus.BuildFQName(namespace, "db", "wait_duration_seconds_total"),
+		"Time spent waiting for a connection.", nil, nil)
+)
+
+func (c *dbCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- dbMaxOpen
+	ch <- dbOpen
+	ch <- dbInUse
+	ch <- dbIdle
+	ch <- dbWaitCount
+	ch <- dbWaitDuration
+}
+
+func (c *dbCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.db.Stats()
+
+	ch <- prometheus.MustNewConstMetric(dbMaxOpen, prometheus.GaugeValue, float64(stats.MaxOpenConnections))
+	ch <- prometheus.MustNewConstMetric(dbOpen, prometheus.GaugeValue, float64(stats.OpenConnections))
+	ch <- prometheus.MustNewConstMetric(dbInUse, prometheus.GaugeValue, float64(stats.InUse))
+	ch <- prometheus.MustNewConstMetric(dbIdle, prometheus.GaugeValue, float64(stats.Idle))
+	ch <- prometheus.MustNewConstMetric(dbWaitCount, prometheus.CounterValue, float64(stats.WaitCount))
+	ch <- prometheus.MustNewConstMetric(dbWaitDuration, prometheus.CounterValue, stats.WaitDuration.Seconds())
+}
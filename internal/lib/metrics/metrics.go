@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "chat"
+
+var (
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of HTTP requests by method, route pattern and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "storage",
+		Name:      "query_duration_seconds",
+		Help:      "Duration of storage calls by Storage method.",
+		Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 8),
+	}, []string{"method"})
+
+	registrations = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "registrations_total",
+		Help:      "Accounts created.",
+	})
+
+	logins = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_total",
+		Help:      "Login attempts by result, success or failure.",
+	}, []string{"result"})
+
+	chatsCreated = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "chats_created_total",
+		Help:      "Chats created by kind: group, channel or direct.",
+	}, []string{"kind"})
+
+	messagesWritten = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_written_total",
+		Help:      "Messages written by users.",
+	})
+)
+
+// Handler serves the metrics to Prometheus.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObserveRequest records a served request. route is the chi route pattern, so
+// /chat/{ID} is one series and not one per chat.
+func ObserveRequest(method string, route string, status int, d time.Duration) {
+	if route == "" {
+		route = "unmatched"
+	}
+	// A handler that writes nothing answers 200.
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	requestDuration.WithLabelValues(method, route, strconv.Itoa(status)).Observe(d.Seconds())
+}
+
+// ObserveQuery records a storage call that began at start. Call it deferred:
+//
+//	defer metrics.ObserveQuery("GetUser", time.Now())
+func ObserveQuery(method string, start time.Time) {
+	queryDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
+
+func UserRegistered() {
+	registrations.Inc()
+}
+
+func LoginSucceeded() {
+	logins.WithLabelValues("success").Inc()
+}
+
+// LoginFailed counts a rejected login: wrong credentials or second factor, a
+// suspended account or a throttled attempt.
+func LoginFailed() {
+	logins.WithLabelValues("failure").Inc()
+}
+
+func ChatCreated(kind string) {
+	chatsCreated.WithLabelValues(kind).Inc()
+}
+
+func MessageWritten() {
+	messagesWritten.Inc()
+}
+
+type DBStatser interface {
+	Stats() sql.DBStats
+}
+
+// RegisterDB exports the connection pool stats of db.
+func RegisterDB(db DBStatser) error {
+	return prometheus.Register(&dbCollector{db: db})
+}
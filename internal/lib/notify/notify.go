@@ -0,0 +1,214 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	KindLog  = "log"
+	KindSMTP = "smtp"
+)
+
+var ErrNoRecipient = errors.New("notification has no recipient address")
+
+type Message struct {
+	// To is the delivery address. Notifiers that only record messages locally accept it empty.
+	To       string
+	Username string
+	Subject  string
+	Body     string
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+type Config struct {
+	Kind     string
+	FilePath string
+	SMTP     SMTPConfig
+}
+
+type SMTPConfig struct {
+	Address  string
+	From     string
+	Username string
+	Password string
+	// Timeout bounds the whole conversation with the server for one message.
+	// Zero means DefaultSMTPTimeout.
+	Timeout time.Duration
+}
+
+const DefaultSMTPTimeout = 10 * time.Second
+
+// New builds the notifier selected by cfg.Kind.
+func New(cfg Config, log *slog.Logger) (Notifier, error) {
+	switch cfg.Kind {
+	case KindLog, "":
+		return &LogNotifier{log: log, path: cfg.FilePath}, nil
+	case KindSMTP:
+		if cfg.SMTP.Address == "" || cfg.SMTP.From == "" {
+			return nil, fmt.Errorf("notify: smtp notifier needs an address and a from address")
+		}
+		return &SMTPNotifier{cfg: cfg.SMTP}, nil
+	default:
+		return nil, fmt.Errorf("notify: unknown notifier kind %q", cfg.Kind)
+	}
+}
+
+// LogNotifier is meant for local development. It writes every message to the
+// log and, when a path is set, appends it to that file.
+type LogNotifier struct {
+	log  *slog.Logger
+	path string
+	mu   sync.Mutex
+}
+
+func NewLogNotifier(log *slog.Logger, path string) *LogNotifier {
+	return &LogNotifier{log: log, path: path}
+}
+
+func (n *LogNotifier) Notify(ctx context.Context, msg Message) error {
+	const op = "notify.LogNotifier.Notify"
+
+	n.log.Info("notification",
+		slog.String("to", msg.To),
+		slog.String("user", msg.Username),
+		slog.String("subject", msg.Subject),
+		slog.String("body", msg.Body),
+	)
+
+	if n.path == "" {
+		return nil
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	f, err := os.OpenFile(n.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "time: %s\nto: %s\nuser: %s\nsubject: %s\n\n%s\n\n",
+		time.Now().Format(time.RFC3339), msg.To, msg.Username, msg.Subject, msg.Body)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// SMTPNotifier sends messages as plain text emails.
+type SMTPNotifier struct {
+	cfg SMTPConfig
+}
+
+func NewSMTPNotifier(cfg SMTPConfig) *SMTPNotifier {
+	return &SMTPNotifier{cfg: cfg}
+}
+
+func (n *SMTPNotifier) Notify(ctx context.Context, msg Message) error {
+	const op = "notify.SMTPNotifier.Notify"
+
+	if msg.To == "" {
+		return fmt.Errorf("%s: %w", op, ErrNoRecipient)
+	}
+	if strings.ContainsAny(msg.To+msg.Subject, "\r\n") {
+		return fmt.Errorf("%s: header contains a line break", op)
+	}
+
+	body := strings.ReplaceAll(msg.Body, "\n", "\r\n")
+	data := "From: " + n.cfg.From + "\r\n" +
+		"To: " + msg.To + "\r\n" +
+		"Subject: " + msg.Subject + "\r\n" +
+		"Date: " + time.Now().Format(time.RFC1123Z) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" + body + "\r\n"
+
+	timeout := n.cfg.Timeout
+	if timeout <= 0 {
+		timeout = DefaultSMTPTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if err := n.send(ctx, msg.To, []byte(data)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// send does what smtp.SendMail does, but over a connection that gives up
+// when ctx is done, so a server that stops answering can't hold the caller.
+func (n *SMTPNotifier) send(ctx context.Context, to string, data []byte) error {
+	host, _, err := net.SplitHostPort(n.cfg.Address)
+	if err != nil {
+		return err
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", n.cfg.Address)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+
+	if n.cfg.Username != "" {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp: server doesn't support AUTH")
+		}
+		if err := c.Auth(smtp.PlainAuth("", n.cfg.Username, n.cfg.Password, host)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(n.cfg.From); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
@@ -0,0 +1,184 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// smtpStub is a minimal SMTP server that keeps what it is sent. A silent stub
+// accepts connections and never answers.
+type smtpStub struct {
+	lis    net.Listener
+	silent bool
+
+	mu       sync.Mutex
+	from     string
+	to       []string
+	messages []string
+}
+
+func newSMTPStub(t *testing.T, silent bool) *smtpStub {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpStub{lis: lis, silent: silent}
+
+	var conns []net.Conn
+	done := make(chan struct{})
+	t.Cleanup(func() {
+		lis.Close()
+		<-done
+		for _, conn := range conns {
+			conn.Close()
+		}
+	})
+
+	go func() {
+		defer close(done)
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+			if !silent {
+				go s.serve(conn)
+			}
+		}
+	}()
+
+	return s
+}
+
+func (s *smtpStub) serve(conn net.Conn) {
+	defer conn.Close()
+
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 stub ready")
+
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250 stub")
+		case "MAIL":
+			s.mu.Lock()
+			s.from = arg
+			s.mu.Unlock()
+			tp.PrintfLine("250 ok")
+		case "RCPT":
+			s.mu.Lock()
+			s.to = append(s.to, arg)
+			s.mu.Unlock()
+			tp.PrintfLine("250 ok")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, string(data))
+			s.mu.Unlock()
+			tp.PrintfLine("250 queued")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func TestSMTPNotifierSends(t *testing.T) {
+	stub := newSMTPStub(t, false)
+	n := NewSMTPNotifier(SMTPConfig{Address: stub.lis.Addr().String(), From: "chat@localhost"})
+
+	err := n.Notify(context.Background(), Message{
+		To:       "bob@example.com",
+		Username: "@bob",
+		Subject:  "Password reset",
+		Body:     "line one\nline two",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+
+	if stub.from != "FROM:<chat@localhost>" || len(stub.to) != 1 || stub.to[0] != "TO:<bob@example.com>" {
+		t.Fatalf("envelope: from %q, to %q", stub.from, stub.to)
+	}
+	if len(stub.messages) != 1 {
+		t.Fatalf("got %d messages, want 1", len(stub.messages))
+	}
+
+	msg, err := textproto.NewReader(bufio.NewReader(strings.NewReader(stub.messages[0]))).ReadMIMEHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Get("To") != "bob@example.com" || msg.Get("Subject") != "Password reset" {
+		t.Fatalf("headers: %v", msg)
+	}
+	if !strings.HasSuffix(stub.messages[0], "\nline one\nline two\n") {
+		t.Fatalf("body: %q", stub.messages[0])
+	}
+}
+
+func TestSMTPNotifierTimesOut(t *testing.T) {
+	stub := newSMTPStub(t, true)
+	n := NewSMTPNotifier(SMTPConfig{
+		Address: stub.lis.Addr().String(),
+		From:    "chat@localhost",
+		Timeout: 100 * time.Millisecond,
+	})
+
+	start := time.Now()
+	err := n.Notify(context.Background(), Message{To: "bob@example.com", Subject: "hi", Body: "hi"})
+	if err == nil {
+		t.Fatal("a silent server accepted the message")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("gave up after %s, want about the timeout", elapsed)
+	}
+}
+
+func TestSMTPNotifierStopsOnCancel(t *testing.T) {
+	stub := newSMTPStub(t, true)
+	n := NewSMTPNotifier(SMTPConfig{Address: stub.lis.Addr().String(), From: "chat@localhost", Timeout: time.Minute})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	if err := n.Notify(ctx, Message{To: "bob@example.com", Subject: "hi", Body: "hi"}); err == nil {
+		t.Fatal("a silent server accepted the message")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("gave up after %s, want soon after the cancel", elapsed)
+	}
+}
+
+func TestSMTPNotifierRejectsHeaderInjection(t *testing.T) {
+	n := NewSMTPNotifier(SMTPConfig{Address: "127.0.0.1:1", From: "chat@localhost"})
+
+	err := n.Notify(context.Background(), Message{To: "bob@example.com\r\nBcc: eve@example.com", Subject: "hi"})
+	if err == nil || !strings.Contains(err.Error(), "line break") {
+		t.Fatalf("got %v, want a line break error", err)
+	}
+}
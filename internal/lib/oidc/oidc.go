@@ -0,0 +1,251 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+
+	CodeChallengeS256 = "S256"
+)
+
+// SupportedScopes are the scopes a client may ask for.
+var SupportedScopes = []string{ScopeOpenID, ScopeProfile}
+
+// Signer signs and verifies the RS256 tokens handed out to relying parties.
+type Signer struct {
+	key    *rsa.PrivateKey
+	keyID  string
+	issuer string
+}
+
+// NewSigner loads the RSA private key from keyPath (PKCS#1 or PKCS#8 PEM). With
+// an empty path a fresh key is generated, so tokens don't survive a restart.
+func NewSigner(issuer, keyPath string) (*Signer, error) {
+	const op = "oidc.NewSigner"
+
+	var key *rsa.PrivateKey
+
+	if keyPath == "" {
+		k, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		key = k
+	} else {
+		data, err := os.ReadFile(keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		k, err := parseKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		key = k
+	}
+
+	sum := sha256.Sum256(x509.MarshalPKCS1PublicKey(&key.PublicKey))
+
+	return &Signer{
+		key:    key,
+		keyID:  base64.RawURLEncoding.EncodeToString(sum[:8]),
+		issuer: issuer,
+	}, nil
+}
+
+func (s *Signer) Issuer() string {
+	return s.issuer
+}
+
+// Sign signs claims and sets the issuer, issue time and expiry.
+func (s *Signer) Sign(claims jwt.MapClaims, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims["iss"] = s.issuer
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(ttl).Unix()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = s.keyID
+
+	return token.SignedString(s.key)
+}
+
+// Verify checks the signature, expiry and issuer of a token signed by Sign.
+func (s *Signer) Verify(tokenString string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		return &s.key.PublicKey, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}),
+		jwt.WithIssuer(s.issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public key in the form published at the jwks_uri.
+func (s *Signer) JWKS() JWKS {
+	pub := s.key.PublicKey
+
+	return JWKS{Keys: []JWK{{
+		Kty: "RSA",
+		Use: "sig",
+		Alg: jwt.SigningMethodRS256.Alg(),
+		Kid: s.keyID,
+		N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}}}
+}
+
+type Discovery struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// NewDiscovery describes the provider for /.well-known/openid-configuration.
+func NewDiscovery(issuer string) Discovery {
+	issuer = strings.TrimSuffix(issuer, "/")
+
+	return Discovery{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/oauth/authorize",
+		TokenEndpoint:                     issuer + "/oauth/token",
+		UserinfoEndpoint:                  issuer + "/userinfo",
+		JWKSURI:                           issuer + "/.well-known/jwks",
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{jwt.SigningMethodRS256.Alg()},
+		ScopesSupported:                   SupportedScopes,
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{CodeChallengeS256},
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "nonce", "name", "preferred_username"},
+	}
+}
+
+// VerifyPKCE checks a code_verifier against the S256 code_challenge sent to
+// the authorization endpoint.
+func VerifyPKCE(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// ParseScope splits a space separated scope and rejects unknown scopes.
+// openid is always required.
+func ParseScope(scope string) ([]string, error) {
+	fields := strings.Fields(scope)
+	hasOpenID := false
+
+	for _, f := range fields {
+		switch f {
+		case ScopeOpenID:
+			hasOpenID = true
+		case ScopeProfile:
+		default:
+			return nil, fmt.Errorf("unsupported scope %q", f)
+		}
+	}
+	if !hasOpenID {
+		return nil, errors.New("the openid scope is required")
+	}
+
+	return fields, nil
+}
+
+// CoversScope reports whether every scope in requested is also in granted.
+func CoversScope(granted, requested string) bool {
+	have := make(map[string]bool)
+	for _, s := range strings.Fields(granted) {
+		have[s] = true
+	}
+	for _, s := range strings.Fields(requested) {
+		if !have[s] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// RandomToken returns a random URL safe string of n random bytes.
+func RandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func parseKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("signing key is not an RSA key")
+	}
+
+	return rsaKey, nil
+}
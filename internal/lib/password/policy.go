@@ -0,0 +1,86 @@
+package password
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrTooShort         = errors.New("password is too short")
+	ErrTooLong          = errors.New("password is too long")
+	ErrBreached         = errors.New("password is too common or has appeared in a data breach")
+	ErrContainsUsername = errors.New("password must not contain the username")
+)
+
+// Policy decides which passwords users may choose.
+type Policy struct {
+	minLength int
+	maxLength int
+	breached  map[string]struct{}
+}
+
+// NewPolicy builds a policy. The breach list is a text file with one password
+// per line; lines starting with # are ignored. An empty path disables the check.
+func NewPolicy(minLength, maxLength int, breachListPath string) (*Policy, error) {
+	const op = "password.NewPolicy"
+
+	p := &Policy{
+		minLength: minLength,
+		maxLength: maxLength,
+		breached:  make(map[string]struct{}),
+	}
+
+	if breachListPath == "" {
+		return p, nil
+	}
+
+	f, err := os.Open(breachListPath)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p.breached[strings.ToLower(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return p, nil
+}
+
+// Validate returns the first rule the password breaks, or nil. The username
+// check is skipped when username is empty.
+func (p *Policy) Validate(username, password string) error {
+	length := utf8.RuneCountInString(password)
+
+	if length < p.minLength {
+		return fmt.Errorf("%w: at least %d characters are required", ErrTooShort, p.minLength)
+	}
+	if p.maxLength > 0 && length > p.maxLength {
+		return fmt.Errorf("%w: at most %d characters are allowed", ErrTooLong, p.maxLength)
+	}
+
+	lower := strings.ToLower(password)
+
+	if _, ok := p.breached[lower]; ok {
+		return ErrBreached
+	}
+
+	name := strings.ToLower(strings.TrimPrefix(username, "@"))
+	if name != "" && strings.Contains(lower, name) {
+		return ErrContainsUsername
+	}
+
+	return nil
+}
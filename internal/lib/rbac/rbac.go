@@ -0,0 +1,74 @@
+package rbac
+
+import "fmt"
+
+// Role is a global role of a user. Every user has exactly one.
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+// Permission is something a route may require.
+type Permission string
+
+const (
+	PermUsersRead         Permission = "users:read"
+	PermUsersSuspend      Permission = "users:suspend"
+	PermUsersDelete       Permission = "users:delete"
+	PermUsersSetRole      Permission = "users:set_role"
+	PermLockoutManage     Permission = "lockout:manage"
+	PermOAuthClientsWrite Permission = "oauth_clients:write"
+)
+
+var permissions = map[Role][]Permission{
+	RoleUser: {},
+	RoleModerator: {
+		PermUsersRead,
+		PermUsersSuspend,
+		PermLockoutManage,
+	},
+	RoleAdmin: {
+		PermUsersRead,
+		PermUsersSuspend,
+		PermUsersDelete,
+		PermUsersSetRole,
+		PermLockoutManage,
+		PermOAuthClientsWrite,
+	},
+}
+
+var ranks = map[Role]int{
+	RoleUser:      0,
+	RoleModerator: 1,
+	RoleAdmin:     2,
+}
+
+// ParseRole checks that s names a known role.
+func ParseRole(s string) (Role, error) {
+	role := Role(s)
+	if _, ok := permissions[role]; !ok {
+		return "", fmt.Errorf("unknown role %q", s)
+	}
+
+	return role, nil
+}
+
+// Can reports whether the role grants perm. Unknown roles grant nothing.
+func (r Role) Can(perm Permission) bool {
+	for _, p := range permissions[r] {
+		if p == perm {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Outranks reports whether r is strictly above other, so that a moderator
+// cannot suspend another moderator or an admin.
+func (r Role) Outranks(other Role) bool {
+	return ranks[r] > ranks[other]
+}
@@ -0,0 +1,126 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	period     = 30
+	digits     = 6
+	secretSize = 20
+	// skew is the number of periods accepted before and after the current one.
+	skew = 1
+
+	recoveryCodeSize = 5
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a random base32 encoded secret for a new authenticator.
+func GenerateSecret() (string, error) {
+	b := make([]byte, secretSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return encoding.EncodeToString(b), nil
+}
+
+// ProvisioningURI builds the otpauth:// URI that authenticator apps read from a QR code.
+func ProvisioningURI(issuer, account, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprintf("%d", digits))
+	v.Set("period", fmt.Sprintf("%d", period))
+
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: v.Encode(),
+	}
+
+	return u.String()
+}
+
+// GenerateCode returns the RFC 6238 code for the given secret at time t.
+func GenerateCode(secret string, t time.Time) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+
+	return hotp(key, uint64(t.Unix()/period)), nil
+}
+
+// Validate reports whether code matches the secret at time t, allowing for
+// clock skew. It also returns the time step the code belongs to: a code is
+// valid for a minute and a half, so the caller must accept each step only once,
+// and none before the last one accepted.
+func Validate(code, secret string, t time.Time) (int64, bool) {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return 0, false
+	}
+
+	code = strings.ReplaceAll(code, " ", "")
+	if len(code) != digits {
+		return 0, false
+	}
+
+	counter := t.Unix() / period
+	for i := int64(-skew); i <= skew; i++ {
+		expected := hotp(key, uint64(counter+i))
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return counter + i, true
+		}
+	}
+
+	return 0, false
+}
+
+// GenerateRecoveryCodes returns n random one-time codes in the xxxx-xxxx form.
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, 0, n)
+
+	for i := 0; i < n; i++ {
+		b := make([]byte, recoveryCodeSize)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(encoding.EncodeToString(b))
+		codes = append(codes, code[:4]+"-"+code[4:])
+	}
+
+	return codes, nil
+}
+
+func hotp(key []byte, counter uint64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
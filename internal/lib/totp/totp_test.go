@@ -0,0 +1,65 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 seed of RFC 6238 Appendix B, "12345678901234567890".
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+// TestRFC6238 checks the SHA1 test vectors of RFC 6238 Appendix B. They are
+// 8 digits long; the 6 digit codes are their last 6 digits.
+func TestRFC6238(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, tt := range tests {
+		got, err := GenerateCode(rfcSecret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := tt.want[len(tt.want)-digits:]; got != want {
+			t.Errorf("T=%d: got %s, want %s", tt.unix, got, want)
+		}
+	}
+}
+
+func TestValidateReturnsTheTimeStep(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := now.Unix() / period
+
+	for _, offset := range []int64{-1, 0, 1} {
+		code, err := GenerateCode(rfcSecret, now.Add(time.Duration(offset*period)*time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		counter, ok := Validate(code, rfcSecret, now)
+		if !ok || counter != step+offset {
+			t.Fatalf("offset %d: got %d, %v, want %d", offset, counter, ok, step+offset)
+		}
+	}
+
+	old, _ := GenerateCode(rfcSecret, now.Add(-2*period*time.Second))
+	if _, ok := Validate(old, rfcSecret, now); ok {
+		t.Fatal("a code two steps old was accepted")
+	}
+
+	code, _ := GenerateCode(rfcSecret, now)
+	if _, ok := Validate(code[:3]+" "+code[3:], rfcSecret, now); !ok {
+		t.Fatal("a code with a space was refused")
+	}
+	if _, ok := Validate(code[:5], rfcSecret, now); ok {
+		t.Fatal("a short code was accepted")
+	}
+}
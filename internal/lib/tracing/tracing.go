@@ -0,0 +1,107 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// shutdownTimeout bounds sending the last spans when the server stops.
+const shutdownTimeout = 5 * time.Second
+
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+// Config is the tracing section of the config of every server. The trace
+// context is passed on to the other services whatever the exporter.
+type Config struct {
+	// Exporter is where the spans go: "none", "stdout" or "otlp".
+	Exporter string `yaml:"exporter" env:"TRACING_EXPORTER" env-default:"none"`
+	// Endpoint is the URL of the OTLP/HTTP collector, like
+	// http://localhost:4318.
+	Endpoint string `yaml:"endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT" env-default:"http://localhost:4318"`
+	// SampleRatio is the share of new traces that are recorded. Requests that
+	// come with a trace follow the caller's decision.
+	SampleRatio float64 `yaml:"sample_ratio" env-default:"1"`
+}
+
+// Setup installs the tracer provider of service and the W3C trace context
+// propagator. The trace context is passed on even when nothing is exported,
+// so a trace isn't cut in the middle by a server that doesn't record it. The
+// returned func sends the remaining spans and stops the exporter.
+func Setup(ctx context.Context, service string, cfg Config) (func() error, error) {
+	const op = "tracing.Setup"
+
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{},
+	))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch cfg.Exporter {
+	case ExporterNone, "":
+		return func() error { return nil }, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterOTLP:
+		exporter, err = otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+	default:
+		return nil, fmt.Errorf("%s: unknown exporter %q", op, cfg.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := resource.Merge(resource.Default(),
+		resource.NewSchemaless(attribute.String("service.name", service)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		return provider.Shutdown(ctx)
+	}, nil
+}
+
+// Middleware continues the trace of an incoming request, or starts one. The
+// probes and /metrics are left out, they would only fill the traces.
+func Middleware() func(http.Handler) http.Handler {
+	return otelhttp.NewMiddleware("http.server", otelhttp.WithFilter(func(r *http.Request) bool {
+		switch r.URL.Path {
+		case "/healthz", "/readyz", "/metrics":
+			return false
+		}
+		return true
+	}))
+}
+
+// Transport passes the trace of the request on to the called server.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(base)
+}
@@ -0,0 +1,115 @@
+package chatmaker_service
+
+import (
+	user_client "chat_go/internal/clients/user"
+	chatmaker_config "chat_go/internal/config/chatmaker"
+	chatmaker_grpc "chat_go/internal/grpc-server/handlers/chatmaker"
+	chatmaker_handler "chat_go/internal/http-server/handlers/chatmaker"
+	"chat_go/internal/http-server/handlers/health"
+	authorization_middleware "chat_go/internal/http-server/middlewares/authorization"
+	"chat_go/internal/storage/sqlite"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"google.golang.org/grpc"
+)
+
+// Service is everything chatmakerServer serves: chats, their members, pins and
+// invites.
+type Service struct {
+	log     *slog.Logger
+	cfg     *chatmaker_config.Config
+	storage *sqlite.Storage
+	users   user_client.UserDirectory
+}
+
+// New returns the service. users is how usernames are checked, over the
+// network or, when the user service runs in the same process, in the storage.
+func New(log *slog.Logger, cfg *chatmaker_config.Config, storage *sqlite.Storage, users user_client.UserDirectory) *Service {
+	return &Service{log: log, cfg: cfg, storage: storage, users: users}
+}
+
+// NewUserDirectory returns the client of the user service from the config.
+// Without a token userServer answers every call with 401, so it is an error.
+func NewUserDirectory(log *slog.Logger, cfg *chatmaker_config.Config) (*user_client.Client, error) {
+	const op = "services.chatmaker.NewUserDirectory"
+
+	if cfg.UserService.Token == "" {
+		return nil, fmt.Errorf("%s: user_service.token (INTERNAL_API_TOKEN) is empty, users can't be checked", op)
+	}
+
+	return user_client.New(user_client.Config{
+		BaseURL:          cfg.UserService.BaseURL,
+		GRPCAddress:      cfg.UserService.GRPCAddress,
+		Token:            cfg.UserService.Token,
+		Timeout:          cfg.UserService.Timeout,
+		Retries:          cfg.UserService.Retries,
+		RetryDelay:       cfg.UserService.RetryDelay,
+		BreakerThreshold: cfg.UserService.BreakerThreshold,
+		BreakerCooldown:  cfg.UserService.BreakerCooldown,
+	})
+}
+
+// UserServiceCheck is the readiness check of the user service. A rejected
+// token doesn't make chatmaker unready: it is a configuration error that every
+// instance shares, and most routes don't need the user service.
+func UserServiceCheck(users *user_client.Client) health.Check {
+	return health.Check{Name: "user_service", Run: func(ctx context.Context) error {
+		err := users.Ping(ctx)
+		if errors.Is(err, user_client.ErrUnauthorized) {
+			return health.Warn(err)
+		}
+		return err
+	}}
+}
+
+// CheckToken asks the user service once whether it accepts the token. Only a
+// rejected token is an error: the user service may just not be up yet.
+func CheckToken(ctx context.Context, users *user_client.Client) error {
+	const op = "services.chatmaker.CheckToken"
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if err := users.Ping(ctx); errors.Is(err, user_client.ErrUnauthorized) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Service) Routes(router chi.Router) {
+	log, storage, users := s.log, s.storage, s.users
+
+	router.Group(func(r chi.Router) {
+		r.Use(authorization_middleware.AuthorizeJWTToken)
+		r.Use(authorization_middleware.RequireValidSession(storage))
+
+		r.Post("/chat/make", chatmaker_handler.NewChatmakerHandler(log, storage, users))
+		r.Post("/chat/dm/{username}", chatmaker_handler.NewDirectChatHandler(log, storage, users))
+		r.Get("/chat/channels", chatmaker_handler.NewSearchChannelsHandler(log, storage))
+		r.Get("/chat/{chatName}/{ID}", chatmaker_handler.NewGetChatHandler(log, storage, s.cfg.Attachments.BaseURL))
+		r.Patch("/chat/{ID}", chatmaker_handler.NewUpdateChatHandler(log, storage))
+		r.Get("/chat/{ID}/members", chatmaker_handler.NewGetMembersHandler(log, storage))
+		r.Post("/chat/{ID}/members", chatmaker_handler.NewAddMembersHandler(log, storage, users))
+		r.Delete("/chat/{ID}/members/{username}", chatmaker_handler.NewRemoveMemberHandler(log, storage))
+		r.Put("/chat/{ID}/members/{username}/role", chatmaker_handler.NewSetMemberRoleHandler(log, storage))
+		r.Post("/chat/{ID}/transfer", chatmaker_handler.NewTransferOwnershipHandler(log, storage))
+		r.Post("/chat/{ID}/join", chatmaker_handler.NewJoinChannelHandler(log, storage))
+		r.Post("/chat/{ID}/leave", chatmaker_handler.NewLeaveHandler(log, storage))
+		r.Post("/chat/{ID}/pins/{messageID}", chatmaker_handler.NewPinHandler(log, storage, s.cfg.Pins.Limit))
+		r.Delete("/chat/{ID}/pins/{messageID}", chatmaker_handler.NewUnpinHandler(log, storage))
+		r.Post("/chat/{ID}/invites", chatmaker_handler.NewCreateInviteHandler(log, storage))
+		r.Get("/chat/{ID}/invites", chatmaker_handler.NewListInvitesHandler(log, storage))
+		r.Delete("/chat/{ID}/invites/{inviteID}", chatmaker_handler.NewRevokeInviteHandler(log, storage))
+		r.Post("/chat/join/{token}", chatmaker_handler.NewJoinHandler(log, storage))
+	})
+}
+
+func (s *Service) RegisterGRPC(srv *grpc.Server) {
+	chatmaker_grpc.Register(srv, s.log, s.storage)
+}
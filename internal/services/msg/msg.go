@@ -0,0 +1,145 @@
+package msg_service
+
+import (
+	msg_config "chat_go/internal/config/msg"
+	msg_grpc "chat_go/internal/grpc-server/handlers/msg"
+	"chat_go/internal/http-server/handlers/msg/attachments"
+	"chat_go/internal/http-server/handlers/msg/mentions"
+	"chat_go/internal/http-server/handlers/msg/remove"
+	"chat_go/internal/http-server/handlers/msg/write"
+	authorization_middleware "chat_go/internal/http-server/middlewares/authorization"
+	"chat_go/internal/lib/blob"
+	"chat_go/internal/lib/events"
+	"chat_go/internal/lib/media"
+	"chat_go/internal/lib/mention"
+	"chat_go/internal/lib/notify"
+	"chat_go/internal/storage/sqlite"
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/go-chi/chi/v5"
+	"google.golang.org/grpc"
+)
+
+// Service is everything msgServer serves: messages, mentions and attachments,
+// with the workers that make thumbnails and send notifications.
+type Service struct {
+	log        *slog.Logger
+	cfg        *msg_config.Config
+	storage    *sqlite.Storage
+	blobs      blob.BlobStore
+	thumbnails *media.Processor
+	bus        *events.Bus
+	stopSweep  context.CancelFunc
+	swept      chan struct{}
+}
+
+func New(log *slog.Logger, cfg *msg_config.Config, storage *sqlite.Storage) (*Service, error) {
+	const op = "services.msg.New"
+
+	notifier, err := notify.New(notify.Config{
+		Kind:     cfg.Notifier.Kind,
+		FilePath: cfg.Notifier.FilePath,
+		SMTP: notify.SMTPConfig{
+			Address:  cfg.Notifier.SMTP.Address,
+			From:     cfg.Notifier.SMTP.From,
+			Username: cfg.Notifier.SMTP.Username,
+			Password: cfg.Notifier.SMTP.Password,
+			Timeout:  cfg.Notifier.SMTP.Timeout,
+		},
+	}, log)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	blobs, err := blob.New(blob.Config{
+		Kind: cfg.Attachments.Store.Kind,
+		Dir:  cfg.Attachments.Store.Dir,
+		S3: blob.S3Config{
+			Endpoint:  cfg.Attachments.Store.S3.Endpoint,
+			Region:    cfg.Attachments.Store.S3.Region,
+			Bucket:    cfg.Attachments.Store.S3.Bucket,
+			AccessKey: cfg.Attachments.Store.S3.AccessKey,
+			SecretKey: cfg.Attachments.Store.S3.SecretKey,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	thumbnails := media.NewProcessor(log, blobs, storage,
+		cfg.Attachments.Thumbnails.Sizes, cfg.Attachments.Thumbnails.Workers, cfg.Attachments.Thumbnails.QueueSize,
+	)
+
+	bus := events.NewBus(log, events.Config{
+		Workers:   cfg.Notifier.Workers,
+		QueueSize: cfg.Notifier.QueueSize,
+		Timeout:   cfg.Notifier.Timeout,
+	})
+	bus.Subscribe(mention.NewNotifyHandler(log, notifier, storage))
+
+	ctx, stopSweep := context.WithCancel(context.Background())
+	swept := make(chan struct{})
+	go func() {
+		defer close(swept)
+		sweepOrphans(ctx, log, storage, blobs)
+	}()
+
+	return &Service{
+		log:        log,
+		cfg:        cfg,
+		storage:    storage,
+		blobs:      blobs,
+		thumbnails: thumbnails,
+		bus:        bus,
+		stopSweep:  stopSweep,
+		swept:      swept,
+	}, nil
+}
+
+func (s *Service) Routes(router chi.Router) {
+	log, storage, blobs, cfg := s.log, s.storage, s.blobs, s.cfg
+
+	router.Group(func(r chi.Router) {
+		r.Use(authorization_middleware.AuthorizeJWTToken)
+		r.Use(authorization_middleware.RequireValidSession(storage))
+
+		r.Post("/chat/write", write.NewWriteMessagesHandler(log, storage, s.bus))
+		r.Get("/chat/mentions", mentions.NewGetMentionsHandler(log, storage))
+		r.Delete("/chat/{ID}/messages/{messageID}", remove.NewDeleteMessageHandler(log, storage, blobs))
+		r.Post("/chat/{ID}/attachments", attachments.NewUploadHandler(log, storage, blobs, s.thumbnails, attachments.Limits{
+			MaxSize:      cfg.Attachments.MaxSize,
+			AllowedTypes: cfg.Attachments.AllowedTypes,
+		}, cfg.Attachments.BaseURL))
+		r.Get("/chat/{ID}/attachments/{attachmentID}", attachments.NewDownloadHandler(log, storage, blobs))
+		r.Get("/chat/{ID}/attachments/{attachmentID}/thumbnails/{size}", attachments.NewThumbnailHandler(log, storage, blobs))
+	})
+}
+
+func (s *Service) RegisterGRPC(srv *grpc.Server) {
+	msg_grpc.Register(srv, s.log, s.storage, s.bus)
+}
+
+// Close waits for the thumbnails and notifications in progress, or until ctx
+// is done. It is called once the servers have stopped, so no new ones come.
+func (s *Service) Close(ctx context.Context) error {
+	const op = "services.msg.Close"
+
+	s.stopSweep()
+	select {
+	case <-s.swept:
+	case <-ctx.Done():
+		return fmt.Errorf("%s: orphan sweeper: %w", op, ctx.Err())
+	}
+
+	if err := s.thumbnails.Close(ctx); err != nil {
+		return fmt.Errorf("%s: thumbnails: %w", op, err)
+	}
+
+	if err := s.bus.Close(ctx); err != nil {
+		return fmt.Errorf("%s: events: %w", op, err)
+	}
+
+	return nil
+}
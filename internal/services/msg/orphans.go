@@ -0,0 +1,74 @@
+package msg_service
+
+import (
+	"chat_go/internal/lib/blob"
+	"chat_go/internal/lib/logger/sl"
+	"context"
+	"log/slog"
+	"time"
+)
+
+const (
+	// sweepInterval is how often the blobs of deleted chats are looked for.
+	sweepInterval = time.Minute
+	// sweepBatch is how many of them are deleted at a time.
+	sweepBatch = 100
+)
+
+type OrphanStorage interface {
+	OrphanedBlobs(ctx context.Context, limit int) ([]string, error)
+	ForgetOrphanedBlobs(ctx context.Context, keys []string) error
+}
+
+// sweepOrphans deletes the blobs of deleted chats until ctx is done. Any
+// service can delete a chat, when its last member leaves or is deleted, but
+// only msgServer has the blob store, so the storage queues the keys for it.
+func sweepOrphans(ctx context.Context, log *slog.Logger, storage OrphanStorage, blobs blob.BlobStore) {
+	log = log.With(slog.String("component", "msg/orphans"))
+
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		sweep(ctx, log, storage, blobs)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func sweep(ctx context.Context, log *slog.Logger, storage OrphanStorage, blobs blob.BlobStore) {
+	for ctx.Err() == nil {
+		keys, err := storage.OrphanedBlobs(ctx, sweepBatch)
+		if err != nil {
+			log.Error("failed to get orphaned blobs", sl.Err(err))
+			return
+		}
+		if len(keys) == 0 {
+			return
+		}
+
+		deleted := make([]string, 0, len(keys))
+		for _, key := range keys {
+			if err := blobs.Delete(ctx, key); err != nil {
+				log.Error("failed to delete orphaned blob", slog.String("key", key), sl.Err(err))
+				continue
+			}
+			deleted = append(deleted, key)
+		}
+
+		if err := storage.ForgetOrphanedBlobs(ctx, deleted); err != nil {
+			log.Error("failed to forget orphaned blobs", sl.Err(err))
+			return
+		}
+		log.Info("orphaned blobs deleted", slog.Int("count", len(deleted)))
+
+		// The rest is tried again on the next round.
+		if len(deleted) < len(keys) {
+			return
+		}
+	}
+}
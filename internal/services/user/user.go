@@ -0,0 +1,192 @@
+package user_service
+
+import (
+	user_config "chat_go/internal/config/user"
+	user_grpc "chat_go/internal/grpc-server/handlers/user"
+	admin_handler "chat_go/internal/http-server/handlers/user/admin"
+	login_handler "chat_go/internal/http-server/handlers/user/login"
+	mfa_handler "chat_go/internal/http-server/handlers/user/mfa"
+	oauth_handler "chat_go/internal/http-server/handlers/user/oauth"
+	password_handler "chat_go/internal/http-server/handlers/user/password"
+	profile_handler "chat_go/internal/http-server/handlers/user/profile"
+	"chat_go/internal/http-server/handlers/user/save"
+	authorization_middleware "chat_go/internal/http-server/middlewares/authorization"
+	"chat_go/internal/lib/events"
+	"chat_go/internal/lib/lockout"
+	"chat_go/internal/lib/notify"
+	"chat_go/internal/lib/oidc"
+	"chat_go/internal/lib/password"
+	"chat_go/internal/lib/rbac"
+	"chat_go/internal/storage"
+	"chat_go/internal/storage/sqlite"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/go-chi/chi/v5"
+	"google.golang.org/grpc"
+)
+
+// Service is everything userServer serves: accounts, logins, OpenID Connect
+// and the admin API.
+type Service struct {
+	log     *slog.Logger
+	cfg     *user_config.Config
+	storage *sqlite.Storage
+	guard   *lockout.Guard
+	policy  *password.Policy
+	signer  *oidc.Signer
+	bus     *events.Bus
+}
+
+func New(log *slog.Logger, cfg *user_config.Config, s *sqlite.Storage) (*Service, error) {
+	const op = "services.user.New"
+
+	for _, username := range cfg.Admin.Bootstrap {
+		err := s.SetRole(context.Background(), username, string(rbac.RoleAdmin))
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("bootstrap admin is not registered yet", slog.String("user", username))
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: bootstrap admin: %w", op, err)
+		}
+	}
+
+	guard := lockout.New(lockout.Config{
+		AccountMaxFailures: cfg.Lockout.AccountMaxFailures,
+		IPMaxFailures:      cfg.Lockout.IPMaxFailures,
+		BaseDelay:          cfg.Lockout.BaseDelay,
+		MaxDelay:           cfg.Lockout.MaxDelay,
+		Duration:           cfg.Lockout.Duration,
+	})
+
+	notifier, err := notify.New(notify.Config{
+		Kind:     cfg.Notifier.Kind,
+		FilePath: cfg.Notifier.FilePath,
+		SMTP: notify.SMTPConfig{
+			Address:  cfg.Notifier.SMTP.Address,
+			From:     cfg.Notifier.SMTP.From,
+			Username: cfg.Notifier.SMTP.Username,
+			Password: cfg.Notifier.SMTP.Password,
+			Timeout:  cfg.Notifier.SMTP.Timeout,
+		},
+	}, log)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	policy, err := password.NewPolicy(
+		cfg.PasswordPolicy.MinLength,
+		cfg.PasswordPolicy.MaxLength,
+		cfg.PasswordPolicy.BreachListPath,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if cfg.OIDC.SigningKeyPath == "" {
+		log.Warn("no oidc signing key configured, using a temporary one")
+	}
+	signer, err := oidc.NewSigner(cfg.OIDC.Issuer, cfg.OIDC.SigningKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	bus := events.NewBus(log, events.Config{
+		Workers:   cfg.Notifier.Workers,
+		QueueSize: cfg.Notifier.QueueSize,
+		Timeout:   cfg.Notifier.Timeout,
+	})
+	bus.Subscribe(password_handler.NewSendResetTokenHandler(log, s, notifier, cfg.PasswordReset.TokenTTL))
+
+	return &Service{
+		log:     log,
+		cfg:     cfg,
+		storage: s,
+		guard:   guard,
+		policy:  policy,
+		signer:  signer,
+		bus:     bus,
+	}, nil
+}
+
+func (s *Service) Routes(router chi.Router) {
+	log, storage, cfg := s.log, s.storage, s.cfg
+
+	router.Post("/chat/register", save_handler.NewSaveHandler(log, storage, s.policy))
+	router.Post("/chat/login", login_handler.NewLoginHandler(log, storage, s.guard))
+	router.Post("/chat/login/mfa", mfa_handler.NewLoginMFAHandler(log, storage, s.guard))
+	router.Post("/chat/password/reset", password_handler.NewResetRequestHandler(log, s.bus))
+	router.Post("/chat/password/reset/confirm", password_handler.NewResetConfirmHandler(log, storage, s.policy))
+
+	router.Get("/.well-known/openid-configuration", oauth_handler.NewDiscoveryHandler(s.signer))
+	router.Get("/.well-known/jwks", oauth_handler.NewJWKSHandler(s.signer))
+	router.Post("/oauth/token", oauth_handler.NewTokenHandler(log, s.signer, storage, cfg.OIDC.AccessTokenTTL, cfg.OIDC.IDTokenTTL))
+	router.Get("/userinfo", oauth_handler.NewUserInfoHandler(log, s.signer, storage))
+	router.Post("/userinfo", oauth_handler.NewUserInfoHandler(log, s.signer, storage))
+
+	router.Group(func(r chi.Router) {
+		r.Use(authorization_middleware.AuthorizeJWTToken)
+		r.Use(authorization_middleware.RequireValidSession(storage))
+
+		r.Get("/chat/{username}", profile_handler.NewGetUserHandler(log, storage))
+		r.Post("/chat/mfa/totp", mfa_handler.NewEnrollHandler(log, storage, cfg.MFA.Issuer))
+		r.Post("/chat/password", password_handler.NewChangeHandler(log, storage, s.policy))
+		r.Post("/chat/mfa/totp/confirm", mfa_handler.NewConfirmHandler(log, storage, cfg.MFA.RecoveryCodeCount))
+	})
+
+	router.Group(func(r chi.Router) {
+		r.Use(oauth_handler.RedirectToLogin(cfg.OIDC.LoginURL, cfg.OIDC.Issuer))
+		r.Use(authorization_middleware.AuthorizeJWTToken)
+		r.Use(authorization_middleware.RequireValidSession(storage))
+
+		r.Get("/oauth/authorize", oauth_handler.NewAuthorizeHandler(log, s.signer, storage))
+		r.Post("/oauth/authorize", oauth_handler.NewConsentHandler(log, s.signer, storage))
+	})
+
+	router.Route("/internal", func(r chi.Router) {
+		r.Use(authorization_middleware.RequireServiceToken(cfg.InternalAPI.Token))
+
+		r.Post("/users/exist", profile_handler.NewExistUsersHandler(log, storage))
+	})
+
+	router.Route("/admin", func(r chi.Router) {
+		r.Use(authorization_middleware.AuthorizeJWTToken)
+		r.Use(authorization_middleware.RequireValidSession(storage))
+
+		r.With(authorization_middleware.RequirePermission(rbac.PermUsersRead)).
+			Get("/users", admin_handler.NewListUsersHandler(log, storage))
+		r.With(authorization_middleware.RequirePermission(rbac.PermUsersSuspend)).
+			Post("/users/{username}/suspend", admin_handler.NewSuspendHandler(log, storage, storage, true))
+		r.With(authorization_middleware.RequirePermission(rbac.PermUsersSuspend)).
+			Delete("/users/{username}/suspend", admin_handler.NewSuspendHandler(log, storage, storage, false))
+		r.With(authorization_middleware.RequirePermission(rbac.PermUsersDelete)).
+			Delete("/users/{username}", admin_handler.NewDeleteUserHandler(log, storage, storage))
+		r.With(authorization_middleware.RequirePermission(rbac.PermUsersSetRole)).
+			Put("/users/{username}/role", admin_handler.NewSetRoleHandler(log, storage, storage))
+		r.With(authorization_middleware.RequirePermission(rbac.PermLockoutManage)).
+			Post("/users/{username}/unlock", admin_handler.NewUnlockAccountHandler(log, s.guard, storage))
+		r.With(authorization_middleware.RequirePermission(rbac.PermLockoutManage)).
+			Post("/ips/unlock", admin_handler.NewUnlockIPHandler(log, s.guard, storage))
+		r.With(authorization_middleware.RequirePermission(rbac.PermOAuthClientsWrite)).
+			Post("/oauth/clients", oauth_handler.NewRegisterClientHandler(log, storage))
+	})
+}
+
+func (s *Service) RegisterGRPC(srv *grpc.Server) {
+	user_grpc.Register(srv, s.log, s.storage)
+}
+
+// Close waits for the reset tokens being sent, or until ctx is done. It is
+// called once the servers have stopped, so no new ones come.
+func (s *Service) Close(ctx context.Context) error {
+	const op = "services.user.Close"
+
+	if err := s.bus.Close(ctx); err != nil {
+		return fmt.Errorf("%s: events: %w", op, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,267 @@
+package sqlite
+
+import (
+	"chat_go/internal/lib/api/models"
+	"chat_go/internal/storage"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// SaveAttachmentMessage writes a message with one attachment. The attachment's
+// contents must already be in the blob store.
+func (s *Storage) SaveAttachmentMessage(ctx context.Context, sender string, chatID int64, text string, att models.Attachment) (_ int64, _ int64, err error) {
+	const op = "storage.sqlite.SaveAttachmentMessage"
+	defer observe(ctx, "SaveAttachmentMessage")(&err)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		"INSERT INTO messages(sender, chatName, chatID, text) SELECT ?, name, id, ? FROM chats WHERE id = ?",
+		sender, text, chatID,
+	)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return 0, 0, storage.ErrChatNotFound
+	}
+
+	messageID, err := res.LastInsertId()
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: failed to get last insert id: %w", op, err)
+	}
+
+	res, err = tx.Exec(`
+	INSERT INTO attachments(message_id, chat_id, blob_key, filename, content_type, size, width, height)
+	VALUES(?, ?, ?, ?, ?, ?, ?, ?)
+	`, messageID, chatID, att.Key, att.Filename, att.ContentType, att.Size, att.Width, att.Height)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	attachmentID, err := res.LastInsertId()
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: failed to get last insert id: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return messageID, attachmentID, nil
+}
+
+func (s *Storage) GetAttachment(ctx context.Context, chatID int64, attachmentID int64) (_ models.Attachment, err error) {
+	const op = "storage.sqlite.GetAttachment"
+	defer observe(ctx, "GetAttachment")(&err)
+
+	var att models.Attachment
+
+	err = s.db.QueryRow(`
+	SELECT id, message_id, chat_id, blob_key, filename, content_type, size, width, height, created_at
+	FROM attachments WHERE id = ? AND chat_id = ?
+	`, attachmentID, chatID).Scan(
+		&att.ID, &att.MessageID, &att.ChatID, &att.Key, &att.Filename, &att.ContentType, &att.Size,
+		&att.Width, &att.Height, &att.CreatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Attachment{}, storage.ErrAttachmentNotFound
+	}
+	if err != nil {
+		return models.Attachment{}, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	return att, nil
+}
+
+// GetChatAttachments returns every attachment in the chat with its thumbnails,
+// in message order.
+func (s *Storage) GetChatAttachments(ctx context.Context, chatID int64) (_ []models.Attachment, err error) {
+	const op = "storage.sqlite.GetChatAttachments"
+	defer observe(ctx, "GetChatAttachments")(&err)
+
+	rows, err := s.db.Query(`
+	SELECT id, message_id, chat_id, blob_key, filename, content_type, size, width, height, created_at
+	FROM attachments WHERE chat_id = ? ORDER BY message_id, id
+	`, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var attachments []models.Attachment
+
+	for rows.Next() {
+		var att models.Attachment
+
+		err := rows.Scan(
+			&att.ID, &att.MessageID, &att.ChatID, &att.Key, &att.Filename, &att.ContentType, &att.Size,
+			&att.Width, &att.Height, &att.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		attachments = append(attachments, att)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	rows.Close()
+
+	thumbs, err := s.db.Query(`
+	SELECT t.attachment_id, t.size, t.width, t.height, t.blob_key, t.content_type
+	FROM attachment_thumbnails t JOIN attachments a ON a.id = t.attachment_id
+	WHERE a.chat_id = ? ORDER BY t.size
+	`, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer thumbs.Close()
+
+	byID := map[int64][]models.Thumbnail{}
+
+	for thumbs.Next() {
+		var id int64
+		var t models.Thumbnail
+		if err := thumbs.Scan(&id, &t.Size, &t.Width, &t.Height, &t.Key, &t.ContentType); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		byID[id] = append(byID[id], t)
+	}
+	if err := thumbs.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for i := range attachments {
+		attachments[i].Thumbnails = byID[attachments[i].ID]
+	}
+
+	return attachments, nil
+}
+
+// SaveThumbnail records a thumbnail whose contents are in the blob store under
+// key. It fails with storage.ErrAttachmentNotFound if the attachment is gone.
+func (s *Storage) SaveThumbnail(ctx context.Context, attachmentID int64, size int, width int, height int, key string, contentType string) (err error) {
+	const op = "storage.sqlite.SaveThumbnail"
+	defer observe(ctx, "SaveThumbnail")(&err)
+
+	res, err := s.db.Exec(`
+	INSERT OR REPLACE INTO attachment_thumbnails(attachment_id, size, width, height, blob_key, content_type)
+	SELECT id, ?, ?, ?, ?, ? FROM attachments WHERE id = ?
+	`, size, width, height, key, contentType, attachmentID)
+	if err != nil {
+		return fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return storage.ErrAttachmentNotFound
+	}
+
+	return nil
+}
+
+func (s *Storage) GetThumbnail(ctx context.Context, chatID int64, attachmentID int64, size int) (_ models.Thumbnail, err error) {
+	const op = "storage.sqlite.GetThumbnail"
+	defer observe(ctx, "GetThumbnail")(&err)
+
+	var t models.Thumbnail
+
+	err = s.db.QueryRow(`
+	SELECT t.size, t.width, t.height, t.blob_key, t.content_type
+	FROM attachment_thumbnails t JOIN attachments a ON a.id = t.attachment_id
+	WHERE a.chat_id = ? AND t.attachment_id = ? AND t.size = ?
+	`, chatID, attachmentID, size).Scan(&t.Size, &t.Width, &t.Height, &t.Key, &t.ContentType)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Thumbnail{}, storage.ErrAttachmentNotFound
+	}
+	if err != nil {
+		return models.Thumbnail{}, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	return t, nil
+}
+
+// OrphanedBlobs returns up to limit blob keys of deleted chats.
+func (s *Storage) OrphanedBlobs(ctx context.Context, limit int) (_ []string, err error) {
+	const op = "storage.sqlite.OrphanedBlobs"
+	defer observe(ctx, "OrphanedBlobs")(&err)
+
+	rows, err := s.db.QueryContext(ctx, "SELECT blob_key FROM orphaned_blobs ORDER BY created_at LIMIT ?", limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+	defer rows.Close()
+
+	var keys []string
+
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return keys, nil
+}
+
+// ForgetOrphanedBlobs removes keys from the queue once their blobs are deleted.
+func (s *Storage) ForgetOrphanedBlobs(ctx context.Context, keys []string) (err error) {
+	const op = "storage.sqlite.ForgetOrphanedBlobs"
+	defer observe(ctx, "ForgetOrphanedBlobs")(&err)
+
+	for _, key := range keys {
+		if _, err := s.db.ExecContext(ctx, "DELETE FROM orphaned_blobs WHERE blob_key = ?", key); err != nil {
+			return fmt.Errorf("%s: execute statement: %w", op, err)
+		}
+	}
+
+	return nil
+}
+
+// attachmentKeys returns the blob keys of the attachments of a message and of
+// their thumbnails.
+func attachmentKeys(tx *sql.Tx, chatID int64, messageID int64) ([]string, error) {
+	rows, err := tx.Query(`
+	SELECT blob_key FROM attachments WHERE chat_id = ? AND message_id = ?
+	UNION ALL
+	SELECT t.blob_key FROM attachment_thumbnails t JOIN attachments a ON a.id = t.attachment_id
+	WHERE a.chat_id = ? AND a.message_id = ?
+	`, chatID, messageID, chatID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
@@ -0,0 +1,23 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+)
+
+func (s *Storage) SaveAuditEvent(ctx context.Context, kind, subject, ip, detail string) (err error) {
+	const op = "storage.sqlite.SaveAuditEvent"
+	defer observe(ctx, "SaveAuditEvent")(&err)
+
+	stmt, err := s.db.Prepare("INSERT INTO audit_events(kind, subject, ip, detail) VALUES(?, ?, ?, ?)")
+	if err != nil {
+		return fmt.Errorf("%s: prepare statement: %w", op, err)
+	}
+
+	_, err = stmt.Exec(kind, subject, ip, detail)
+	if err != nil {
+		return fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package sqlite
+
+import (
+	"chat_go/internal/lib/api/models"
+	"chat_go/internal/lib/chatrole"
+	"chat_go/internal/storage"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SearchChannels returns public channels whose name, description or topic
+// contain query, the most subscribed first. An empty query matches all of them.
+func (s *Storage) SearchChannels(ctx context.Context, query string, limit int, offset int) (_ []models.Channel, err error) {
+	const op = "storage.sqlite.SearchChannels"
+	defer observe(ctx, "SearchChannels")(&err)
+
+	pattern := "%" + escapeLike(query) + "%"
+
+	rows, err := s.db.Query(`
+	SELECT id, name, description, topic, avatar,
+	(SELECT COUNT(*) FROM chat_members WHERE chat_id = chats.id) AS subscribers
+	FROM chats
+	WHERE kind = ? AND public = 1
+	AND (name LIKE ? ESCAPE '\' OR description LIKE ? ESCAPE '\' OR topic LIKE ? ESCAPE '\')
+	ORDER BY subscribers DESC, id
+	LIMIT ? OFFSET ?
+	`, models.ChatKindChannel, pattern, pattern, pattern, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	channels := []models.Channel{}
+
+	for rows.Next() {
+		var c models.Channel
+		if err := rows.Scan(&c.ID, &c.Name, &c.Description, &c.Topic, &c.Avatar, &c.Subscribers); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		channels = append(channels, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return channels, nil
+}
+
+// JoinChannel subscribes username to a public channel. It reports false if the
+// user was subscribed already.
+func (s *Storage) JoinChannel(ctx context.Context, chatID int64, username string) (_ bool, err error) {
+	const op = "storage.sqlite.JoinChannel"
+	defer observe(ctx, "JoinChannel")(&err)
+
+	res, err := s.db.Exec(`
+	INSERT OR IGNORE INTO chat_members(chat_id, username, role)
+	SELECT id, ?, ? FROM chats WHERE id = ? AND kind = ? AND public = 1
+	`, username, chatrole.Member, chatID, models.ChatKindChannel)
+	if err != nil {
+		return false, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	if n > 0 {
+		return true, nil
+	}
+
+	// Nothing was inserted: either the user is subscribed already, or there
+	// is no such public channel.
+	_, err = s.GetChatRole(ctx, chatID, username)
+	if errors.Is(err, storage.ErrNotChatMember) {
+		return false, storage.ErrChatNotFound
+	}
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return false, nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,471 @@
+package sqlite
+
+import (
+	"chat_go/internal/lib/api/models"
+	"chat_go/internal/lib/chatrole"
+	"chat_go/internal/storage"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// GetChatRole returns the role of username in the chat.
+func (s *Storage) GetChatRole(ctx context.Context, chatID int64, username string) (_ string, err error) {
+	const op = "storage.sqlite.GetChatRole"
+	defer observe(ctx, "GetChatRole")(&err)
+
+	var role string
+
+	err = s.db.QueryRow(
+		"SELECT role FROM chat_members WHERE chat_id = ? AND username = ?", chatID, username,
+	).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", storage.ErrNotChatMember
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	return role, nil
+}
+
+// GetChatMembers returns the members of the chat in the order they joined.
+func (s *Storage) GetChatMembers(ctx context.Context, chatID int64) (_ []models.ChatMember, err error) {
+	const op = "storage.sqlite.GetChatMembers"
+	defer observe(ctx, "GetChatMembers")(&err)
+
+	rows, err := s.db.Query("SELECT username, role FROM chat_members WHERE chat_id = ? ORDER BY rowid", chatID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var members []models.ChatMember
+
+	for rows.Next() {
+		var m models.ChatMember
+		if err := rows.Scan(&m.Username, &m.Role); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		members = append(members, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return members, nil
+}
+
+func (s *Storage) SetChatRole(ctx context.Context, chatID int64, username string, role string) (err error) {
+	const op = "storage.sqlite.SetChatRole"
+	defer observe(ctx, "SetChatRole")(&err)
+
+	if err := notDirect(s.db, chatID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := s.db.Exec(
+		"UPDATE chat_members SET role = ? WHERE chat_id = ? AND username = ?", role, chatID, username,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return storage.ErrNotChatMember
+	}
+
+	return nil
+}
+
+// AddChatMembers adds usernames to the chat as members and returns the ones
+// that weren't members already.
+func (s *Storage) AddChatMembers(ctx context.Context, chatID int64, usernames []string) (_ []string, err error) {
+	const op = "storage.sqlite.AddChatMembers"
+	defer observe(ctx, "AddChatMembers")(&err)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if err := notDirect(tx, chatID); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var added []string
+
+	for _, username := range usernames {
+		res, err := tx.Exec(
+			"INSERT OR IGNORE INTO chat_members(chat_id, username, role) VALUES(?, ?, ?)", chatID, username, chatrole.Member,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: execute statement: %w", op, err)
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if n > 0 {
+			added = append(added, username)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return added, nil
+}
+
+// TransferOwnership makes to an owner of the chat and demotes from to admin.
+func (s *Storage) TransferOwnership(ctx context.Context, chatID int64, from string, to string) (err error) {
+	const op = "storage.sqlite.TransferOwnership"
+	defer observe(ctx, "TransferOwnership")(&err)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if err := notDirect(tx, chatID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, m := range []struct {
+		username string
+		role     chatrole.Role
+	}{
+		{to, chatrole.Owner},
+		{from, chatrole.Admin},
+	} {
+		res, err := tx.Exec(
+			"UPDATE chat_members SET role = ? WHERE chat_id = ? AND username = ?", m.role, chatID, m.username,
+		)
+		if err != nil {
+			return fmt.Errorf("%s: execute statement: %w", op, err)
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if n == 0 {
+			return storage.ErrNotChatMember
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// LeaveChat removes username from the chat. When the last owner leaves, the
+// longest serving admin, or failing that member, becomes the owner and is
+// returned. When the last member leaves, the chat is deleted.
+func (s *Storage) LeaveChat(ctx context.Context, chatID int64, username string) (_ string, err error) {
+	const op = "storage.sqlite.LeaveChat"
+	defer observe(ctx, "LeaveChat")(&err)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("DELETE FROM chat_members WHERE chat_id = ? AND username = ?", chatID, username)
+	if err != nil {
+		return "", fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return "", storage.ErrNotChatMember
+	}
+
+	promoted, err := ensureOwner(tx, chatID)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return promoted, nil
+}
+
+// ensureOwner promotes a member to owner if the chat has members but no owner,
+// and deletes the chat if it has no members left. The blobs of a deleted chat
+// are queued in orphaned_blobs, for msgServer to delete once the transaction
+// is committed.
+func ensureOwner(tx *sql.Tx, chatID int64) (string, error) {
+	var owners, members int
+
+	err := tx.QueryRow(
+		"SELECT COUNT(*), COALESCE(SUM(role = ?), 0) FROM chat_members WHERE chat_id = ?", chatrole.Owner, chatID,
+	).Scan(&members, &owners)
+	if err != nil {
+		return "", err
+	}
+
+	if members == 0 {
+		_, err := tx.Exec(`
+		INSERT OR IGNORE INTO orphaned_blobs(blob_key)
+		SELECT blob_key FROM attachments WHERE chat_id = ?
+		UNION ALL
+		SELECT t.blob_key FROM attachment_thumbnails t JOIN attachments a ON a.id = t.attachment_id
+		WHERE a.chat_id = ?
+		`, chatID, chatID)
+		if err != nil {
+			return "", err
+		}
+
+		for _, q := range []string{
+			"DELETE FROM chat_pins WHERE chat_id = ?",
+			"DELETE FROM mentions WHERE chat_id = ?",
+			"DELETE FROM attachment_thumbnails WHERE attachment_id IN (SELECT id FROM attachments WHERE chat_id = ?)",
+			"DELETE FROM attachments WHERE chat_id = ?",
+			"DELETE FROM messages WHERE chatID = ?",
+			"DELETE FROM chat_invites WHERE chat_id = ?",
+			"DELETE FROM chats WHERE id = ?",
+		} {
+			if _, err := tx.Exec(q, chatID); err != nil {
+				return "", err
+			}
+		}
+		return "", nil
+	}
+	if owners > 0 {
+		return "", nil
+	}
+
+	var successor string
+
+	err = tx.QueryRow(`
+	SELECT username FROM chat_members WHERE chat_id = ?
+	ORDER BY role = ? DESC, rowid LIMIT 1
+	`, chatID, chatrole.Admin).Scan(&successor)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec(
+		"UPDATE chat_members SET role = ? WHERE chat_id = ? AND username = ?", chatrole.Owner, chatID, successor,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return successor, nil
+}
+
+// leaveAllChats removes username from every chat, promoting new owners where needed.
+func leaveAllChats(tx *sql.Tx, username string) error {
+	rows, err := tx.Query("SELECT chat_id FROM chat_members WHERE username = ?", username)
+	if err != nil {
+		return err
+	}
+
+	var chatIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		chatIDs = append(chatIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, q := range []string{
+		"DELETE FROM chat_members WHERE username = ?",
+		"DELETE FROM mentions WHERE username = ?",
+	} {
+		if _, err := tx.Exec(q, username); err != nil {
+			return err
+		}
+	}
+
+	for _, id := range chatIDs {
+		if _, err := ensureOwner(tx, id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Storage) GetChatInfo(ctx context.Context, chatID int64) (_ models.ChatInfo, err error) {
+	const op = "storage.sqlite.GetChatInfo"
+	defer observe(ctx, "GetChatInfo")(&err)
+
+	info := models.ChatInfo{ID: chatID}
+	var createdAt sql.NullTime
+
+	err = s.db.QueryRow(`
+	SELECT name, kind, public, description, topic, avatar, created_by, created_at,
+	(SELECT COUNT(*) FROM chat_members WHERE chat_id = chats.id)
+	FROM chats WHERE id = ?
+	`, chatID).Scan(
+		&info.Name, &info.Kind, &info.Public, &info.Description, &info.Topic, &info.Avatar,
+		&info.CreatedBy, &createdAt, &info.MemberCount,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.ChatInfo{}, storage.ErrChatNotFound
+	}
+	if err != nil {
+		return models.ChatInfo{}, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+	if createdAt.Valid {
+		info.CreatedAt = &createdAt.Time
+	}
+
+	return info, nil
+}
+
+// UpdateChat changes the fields of the chat set in update. Messages store the
+// chat name too, so they follow a rename.
+func (s *Storage) UpdateChat(ctx context.Context, chatID int64, update models.ChatUpdate) (err error) {
+	const op = "storage.sqlite.UpdateChat"
+	defer observe(ctx, "UpdateChat")(&err)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+	UPDATE chats SET
+	name = COALESCE(?, name),
+	description = COALESCE(?, description),
+	topic = COALESCE(?, topic),
+	avatar = COALESCE(?, avatar)
+	WHERE id = ?
+	`, update.Name, update.Description, update.Topic, update.Avatar, chatID)
+	if err != nil {
+		return fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return storage.ErrChatNotFound
+	}
+
+	if update.Name != nil {
+		if _, err := tx.Exec("UPDATE messages SET chatName = ? WHERE chatID = ?", *update.Name, chatID); err != nil {
+			return fmt.Errorf("%s: execute statement: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// SaveSystemMessage records a change to the chat in its history.
+func (s *Storage) SaveSystemMessage(ctx context.Context, chatID int64, text string) (err error) {
+	const op = "storage.sqlite.SaveSystemMessage"
+	defer observe(ctx, "SaveSystemMessage")(&err)
+
+	_, err = s.db.Exec(
+		"INSERT INTO messages(sender, chatName, chatID, text, kind) SELECT '', name, id, ?, ? FROM chats WHERE id = ?",
+		text, models.MessageKindSystem, chatID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) GetMessageSender(ctx context.Context, chatID int64, messageID int64) (_ string, err error) {
+	const op = "storage.sqlite.GetMessageSender"
+	defer observe(ctx, "GetMessageSender")(&err)
+
+	var sender string
+
+	err = s.db.QueryRow(
+		"SELECT sender FROM messages WHERE id = ? AND chatID = ?", messageID, chatID,
+	).Scan(&sender)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", storage.ErrMessageNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	return sender, nil
+}
+
+// DeleteMessage deletes a message along with its pin, mentions and
+// attachments. It returns the blob keys of the attachments and their
+// thumbnails, whose contents the caller should delete from the blob store.
+func (s *Storage) DeleteMessage(ctx context.Context, chatID int64, messageID int64) (_ []string, err error) {
+	const op = "storage.sqlite.DeleteMessage"
+	defer observe(ctx, "DeleteMessage")(&err)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("DELETE FROM messages WHERE id = ? AND chatID = ?", messageID, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return nil, storage.ErrMessageNotFound
+	}
+
+	keys, err := attachmentKeys(tx, chatID, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, q := range []string{
+		"DELETE FROM chat_pins WHERE chat_id = ? AND message_id = ?",
+		"DELETE FROM mentions WHERE chat_id = ? AND message_id = ?",
+		"DELETE FROM attachment_thumbnails WHERE attachment_id IN (SELECT id FROM attachments WHERE chat_id = ? AND message_id = ?)",
+		"DELETE FROM attachments WHERE chat_id = ? AND message_id = ?",
+	} {
+		if _, err := tx.Exec(q, chatID, messageID); err != nil {
+			return nil, fmt.Errorf("%s: execute statement: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,92 @@
+package sqlite
+
+import (
+	"chat_go/internal/lib/api/models"
+	"chat_go/internal/lib/chatrole"
+	"chat_go/internal/storage"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// GetOrMakeDirectChat returns the direct chat between from and to, creating it
+// if there is none. Both users are owners of a direct chat, and one who has
+// left it is added back. It also reports whether the chat was created.
+func (s *Storage) GetOrMakeDirectChat(ctx context.Context, from string, to string) (_ int64, _ bool, err error) {
+	const op = "storage.sqlite.GetOrMakeDirectChat"
+	defer observe(ctx, "GetOrMakeDirectChat")(&err)
+
+	usernames := []string{from}
+	if to != from {
+		usernames = append(usernames, to)
+	}
+	slices.Sort(usernames)
+
+	key := strings.Join(usernames, " ")
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, false, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+	INSERT INTO chats(name, kind, dm_key, created_by, created_at) VALUES(?, ?, ?, ?, ?)
+	ON CONFLICT(dm_key) DO NOTHING
+	`, strings.Join(usernames, "-"), models.ChatKindDirect, key, from, time.Now().UTC())
+	if err != nil {
+		return 0, false, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var id int64
+	if err := tx.QueryRow("SELECT id FROM chats WHERE dm_key = ?", key).Scan(&id); err != nil {
+		return 0, false, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	for _, username := range usernames {
+		_, err := tx.Exec(
+			"INSERT OR IGNORE INTO chat_members(chat_id, username, role) VALUES(?, ?, ?)", id, username, chatrole.Owner,
+		)
+		if err != nil {
+			return 0, false, fmt.Errorf("%s: execute statement: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, n > 0, nil
+}
+
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// notDirect returns storage.ErrDirectChat for a direct chat, whose members
+// and roles can't change.
+func notDirect(q queryRower, chatID int64) error {
+	var kind string
+
+	err := q.QueryRow("SELECT kind FROM chats WHERE id = ?", chatID).Scan(&kind)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.ErrChatNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if kind == models.ChatKindDirect {
+		return storage.ErrDirectChat
+	}
+
+	return nil
+}
@@ -0,0 +1,160 @@
+package sqlite
+
+import (
+	"chat_go/internal/lib/api/models"
+	"chat_go/internal/lib/chatrole"
+	"chat_go/internal/storage"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SaveChatInvite stores a new invite link for the chat. A nil expiresAt never
+// expires, and maxUses 0 allows any number of uses.
+func (s *Storage) SaveChatInvite(ctx context.Context, chatID int64, token string, createdBy string, expiresAt *time.Time, maxUses int) (_ int64, err error) {
+	const op = "storage.sqlite.SaveChatInvite"
+	defer observe(ctx, "SaveChatInvite")(&err)
+
+	if err := notDirect(s.db, chatID); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var expires interface{}
+	if expiresAt != nil {
+		expires = expiresAt.UTC()
+	}
+
+	res, err := s.db.Exec(
+		"INSERT INTO chat_invites(chat_id, token_hash, created_by, expires_at, max_uses) VALUES(?, ?, ?, ?, ?)",
+		chatID, hashInviteToken(token), createdBy, expires, maxUses,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s: failed to get last insert id: %w", op, err)
+	}
+
+	return id, nil
+}
+
+func (s *Storage) GetChatInvites(ctx context.Context, chatID int64) (_ []models.ChatInvite, err error) {
+	const op = "storage.sqlite.GetChatInvites"
+	defer observe(ctx, "GetChatInvites")(&err)
+
+	rows, err := s.db.Query(`
+	SELECT id, chat_id, created_by, expires_at, max_uses, uses, revoked, created_at
+	FROM chat_invites WHERE chat_id = ? ORDER BY id
+	`, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	invites := []models.ChatInvite{}
+
+	for rows.Next() {
+		var inv models.ChatInvite
+		var expires sql.NullTime
+
+		err := rows.Scan(&inv.ID, &inv.ChatID, &inv.CreatedBy, &expires, &inv.MaxUses, &inv.Uses, &inv.Revoked, &inv.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if expires.Valid {
+			inv.ExpiresAt = &expires.Time
+		}
+
+		invites = append(invites, inv)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return invites, nil
+}
+
+func (s *Storage) RevokeChatInvite(ctx context.Context, chatID int64, inviteID int64) (err error) {
+	const op = "storage.sqlite.RevokeChatInvite"
+	defer observe(ctx, "RevokeChatInvite")(&err)
+
+	res, err := s.db.Exec("UPDATE chat_invites SET revoked = 1 WHERE id = ? AND chat_id = ?", inviteID, chatID)
+	if err != nil {
+		return fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return storage.ErrInviteNotFound
+	}
+
+	return nil
+}
+
+// JoinChatByInvite adds username to the chat the invite belongs to and returns
+// the chat's id. joined is false when the user was already a member, in which
+// case the invite isn't used up.
+func (s *Storage) JoinChatByInvite(ctx context.Context, token string, username string) (chatID int64, joined bool, err error) {
+	const op = "storage.sqlite.JoinChatByInvite"
+	defer observe(ctx, "JoinChatByInvite")(&err)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, false, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var inviteID int64
+
+	err = tx.QueryRow(`
+	SELECT id, chat_id FROM chat_invites
+	WHERE token_hash = ? AND revoked = 0
+	AND (expires_at IS NULL OR expires_at > ?)
+	AND (max_uses = 0 OR uses < max_uses)
+	`, hashInviteToken(token), time.Now().UTC()).Scan(&inviteID, &chatID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, storage.ErrInvalidInvite
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	res, err := tx.Exec(
+		"INSERT OR IGNORE INTO chat_members(chat_id, username, role) VALUES(?, ?, ?)", chatID, username, chatrole.Member,
+	)
+	if err != nil {
+		return 0, false, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, false, fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return chatID, false, nil
+	}
+
+	if _, err := tx.Exec("UPDATE chat_invites SET uses = uses + 1 WHERE id = ?", inviteID); err != nil {
+		return 0, false, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return chatID, true, nil
+}
+
+func hashInviteToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,104 @@
+package sqlite
+
+import (
+	"chat_go/internal/lib/api/models"
+	"chat_go/internal/storage"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// SaveMentions records that the message mentions usernames. Users who aren't
+// members of the chat are skipped, and the ones saved are returned.
+func (s *Storage) SaveMentions(ctx context.Context, chatID int64, messageID int64, usernames []string) (_ []string, err error) {
+	const op = "storage.sqlite.SaveMentions"
+	defer observe(ctx, "SaveMentions")(&err)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var saved []string
+
+	for _, username := range usernames {
+		res, err := tx.Exec(`
+		INSERT OR IGNORE INTO mentions(message_id, chat_id, username)
+		SELECT ?, chat_id, username FROM chat_members WHERE chat_id = ? AND username = ?
+		`, messageID, chatID, username)
+		if err != nil {
+			return nil, fmt.Errorf("%s: execute statement: %w", op, err)
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if n > 0 {
+			saved = append(saved, username)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return saved, nil
+}
+
+// GetMentions returns the messages mentioning username, newest first. Chats
+// the user has left are skipped.
+func (s *Storage) GetMentions(ctx context.Context, username string, limit int, offset int) (_ []models.Mention, err error) {
+	const op = "storage.sqlite.GetMentions"
+	defer observe(ctx, "GetMentions")(&err)
+
+	rows, err := s.db.Query(`
+	SELECT m.id, m.chatID, c.name, m.sender, m.text, mn.created_at
+	FROM mentions mn
+	JOIN messages m ON m.id = mn.message_id
+	JOIN chats c ON c.id = mn.chat_id
+	JOIN chat_members cm ON cm.chat_id = mn.chat_id AND cm.username = mn.username
+	WHERE mn.username = ?
+	ORDER BY mn.message_id DESC
+	LIMIT ? OFFSET ?
+	`, username, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	mentions := []models.Mention{}
+
+	for rows.Next() {
+		var m models.Mention
+		if err := rows.Scan(&m.MessageID, &m.ChatID, &m.ChatName, &m.Sender, &m.Text, &m.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		mentions = append(mentions, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return mentions, nil
+}
+
+func (s *Storage) GetEmailByUsername(ctx context.Context, username string) (_ string, err error) {
+	const op = "storage.sqlite.GetEmailByUsername"
+	defer observe(ctx, "GetEmailByUsername")(&err)
+
+	var email string
+
+	err = s.db.QueryRow("SELECT email FROM users WHERE username = ?", username).Scan(&email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", storage.ErrUserNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	return email, nil
+}
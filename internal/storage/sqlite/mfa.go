@@ -0,0 +1,185 @@
+package sqlite
+
+import (
+	"chat_go/internal/storage"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+func (s *Storage) GetUsernameByID(ctx context.Context, id int64) (_ string, err error) {
+	const op = "storage.sqlite.GetUsernameByID"
+	defer observe(ctx, "GetUsernameByID")(&err)
+
+	stmt, err := s.db.Prepare("SELECT username FROM users WHERE id = ?")
+	if err != nil {
+		return "", fmt.Errorf("%s: prepare statement: %w", op, err)
+	}
+
+	var username string
+
+	err = stmt.QueryRow(id).Scan(&username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", storage.ErrUserNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	return username, nil
+}
+
+// SetTOTPSecret stores a new, not yet confirmed, authenticator secret for the user.
+func (s *Storage) SetTOTPSecret(ctx context.Context, userID int64, secret string) (err error) {
+	const op = "storage.sqlite.SetTOTPSecret"
+	defer observe(ctx, "SetTOTPSecret")(&err)
+
+	res, err := s.db.Exec("UPDATE users SET totp_secret = ? WHERE id = ? AND totp_enabled = 0", secret, userID)
+	if err != nil {
+		return fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		_, enabled, err := s.GetTOTP(ctx, userID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if enabled {
+			return fmt.Errorf("%s: %w", op, storage.ErrMFAAlreadyEnabled)
+		}
+	}
+
+	return nil
+}
+
+func (s *Storage) GetTOTP(ctx context.Context, userID int64) (_ string, _ bool, err error) {
+	const op = "storage.sqlite.GetTOTP"
+	defer observe(ctx, "GetTOTP")(&err)
+
+	var secret string
+	var enabled bool
+
+	err = s.db.QueryRow("SELECT totp_secret, totp_enabled FROM users WHERE id = ?", userID).Scan(&secret, &enabled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, storage.ErrUserNotFound
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+	if secret == "" {
+		return "", false, storage.ErrMFANotEnrolled
+	}
+
+	return secret, enabled, nil
+}
+
+// EnableTOTP turns on two-factor authentication for the user and replaces any
+// previous recovery codes with the given ones.
+func (s *Storage) EnableTOTP(ctx context.Context, userID int64, recoveryCodes []string) (err error) {
+	const op = "storage.sqlite.EnableTOTP"
+	defer observe(ctx, "EnableTOTP")(&err)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("UPDATE users SET totp_enabled = 1 WHERE id = ? AND totp_secret != ''", userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrMFANotEnrolled)
+	}
+
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	stmt, err := tx.Prepare("INSERT INTO recovery_codes(user_id, code_hash) VALUES(?, ?)")
+	if err != nil {
+		return fmt.Errorf("%s: prepare statement: %w", op, err)
+	}
+	defer stmt.Close()
+
+	for _, code := range recoveryCodes {
+		if _, err := stmt.Exec(userID, hashRecoveryCode(code)); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// UseTOTPCounter records that the TOTP code of the given time step was used.
+// It fails with storage.ErrTOTPCodeUsed unless counter is later than the step
+// of the last code accepted, so a code can't be replayed, nor an older one
+// used after it.
+func (s *Storage) UseTOTPCounter(ctx context.Context, userID int64, counter int64) (err error) {
+	const op = "storage.sqlite.UseTOTPCounter"
+	defer observe(ctx, "UseTOTPCounter")(&err)
+
+	res, err := s.db.Exec(
+		"UPDATE users SET totp_last_counter = ? WHERE id = ? AND totp_last_counter < ?",
+		counter, userID, counter,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return storage.ErrTOTPCodeUsed
+	}
+
+	return nil
+}
+
+// UseRecoveryCode marks a matching unused recovery code as used.
+func (s *Storage) UseRecoveryCode(ctx context.Context, userID int64, code string) (err error) {
+	const op = "storage.sqlite.UseRecoveryCode"
+	defer observe(ctx, "UseRecoveryCode")(&err)
+
+	res, err := s.db.Exec(
+		"UPDATE recovery_codes SET used = 1 WHERE user_id = ? AND code_hash = ? AND used = 0",
+		userID, hashRecoveryCode(code),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return storage.ErrInvalidRecoveryCode
+	}
+
+	return nil
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(code))))
+	return hex.EncodeToString(sum[:])
+}
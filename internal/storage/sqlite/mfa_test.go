@@ -0,0 +1,38 @@
+package sqlite_test
+
+import (
+	"chat_go/internal/storage"
+	"chat_go/internal/storage/sqlite"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestUseTOTPCounter(t *testing.T) {
+	ctx := context.Background()
+
+	st, err := sqlite.New(filepath.Join(t.TempDir(), "chat.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+
+	userID, err := st.SaveUser(ctx, "bio", "Passw0rd!x", "Alice", "@alice", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := st.UseTOTPCounter(ctx, userID, 100); err != nil {
+		t.Fatalf("first code: %v", err)
+	}
+	if err := st.UseTOTPCounter(ctx, userID, 100); !errors.Is(err, storage.ErrTOTPCodeUsed) {
+		t.Fatalf("same code again: got %v, want ErrTOTPCodeUsed", err)
+	}
+	if err := st.UseTOTPCounter(ctx, userID, 99); !errors.Is(err, storage.ErrTOTPCodeUsed) {
+		t.Fatalf("older code: got %v, want ErrTOTPCodeUsed", err)
+	}
+	if err := st.UseTOTPCounter(ctx, userID, 101); err != nil {
+		t.Fatalf("next code: %v", err)
+	}
+}
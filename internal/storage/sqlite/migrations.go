@@ -0,0 +1,274 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// migrations are applied in order on top of the base tables created in New.
+// Never edit an entry that has already been released, append a new one instead.
+var migrations = []string{
+	// 1: TOTP two-factor authentication.
+	`
+	ALTER TABLE users ADD COLUMN totp_secret TEXT NOT NULL DEFAULT '';
+	ALTER TABLE users ADD COLUMN totp_enabled INTEGER NOT NULL DEFAULT 0;
+	CREATE TABLE IF NOT EXISTS recovery_codes(
+	id INTEGER PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	code_hash TEXT NOT NULL,
+	used INTEGER NOT NULL DEFAULT 0);
+	CREATE INDEX IF NOT EXISTS idx_recovery_codes_user_id ON recovery_codes(user_id);
+	`,
+	// 2: audit trail for security relevant events.
+	`
+	CREATE TABLE IF NOT EXISTS audit_events(
+	id INTEGER PRIMARY KEY,
+	kind TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	ip TEXT NOT NULL,
+	detail TEXT NOT NULL,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP);
+	`,
+	// 3: password change and reset.
+	`
+	ALTER TABLE users ADD COLUMN email TEXT NOT NULL DEFAULT '';
+	ALTER TABLE users ADD COLUMN session_version INTEGER NOT NULL DEFAULT 0;
+	CREATE TABLE IF NOT EXISTS password_resets(
+	id INTEGER PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	token_hash TEXT NOT NULL UNIQUE,
+	expires_at DATETIME NOT NULL,
+	used INTEGER NOT NULL DEFAULT 0);
+	`,
+	// 4: OAuth2/OpenID Connect provider.
+	`
+	CREATE TABLE IF NOT EXISTS oauth_clients(
+	id INTEGER PRIMARY KEY,
+	client_id TEXT NOT NULL UNIQUE,
+	secret_hash TEXT NOT NULL,
+	name TEXT NOT NULL,
+	redirect_uris TEXT NOT NULL,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP);
+	CREATE TABLE IF NOT EXISTS oauth_codes(
+	id INTEGER PRIMARY KEY,
+	code_hash TEXT NOT NULL UNIQUE,
+	client_id TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	redirect_uri TEXT NOT NULL,
+	scope TEXT NOT NULL,
+	nonce TEXT NOT NULL,
+	code_challenge TEXT NOT NULL,
+	expires_at DATETIME NOT NULL,
+	used INTEGER NOT NULL DEFAULT 0);
+	CREATE TABLE IF NOT EXISTS oauth_consents(
+	user_id INTEGER NOT NULL,
+	client_id TEXT NOT NULL,
+	scope TEXT NOT NULL,
+	PRIMARY KEY(user_id, client_id));
+	`,
+	// 5: global roles and suspension.
+	`
+	ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user';
+	ALTER TABLE users ADD COLUMN suspended INTEGER NOT NULL DEFAULT 0;
+	`,
+	// 6: per-chat member roles. Existing chats get their participants as
+	// members. Chats made before this didn't record who created them, and the
+	// participants were stored as the creator typed them, so the creator
+	// can't be recovered. The first participant listed becomes the owner
+	// instead: that is usually the creator, but not always, and the owner
+	// can hand the chat over with a transfer.
+	`
+	CREATE TABLE IF NOT EXISTS chat_members(
+	chat_id INTEGER NOT NULL,
+	username TEXT NOT NULL,
+	role TEXT NOT NULL DEFAULT 'member',
+	joined_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY(chat_id, username));
+	CREATE INDEX IF NOT EXISTS idx_chat_members_username ON chat_members(username);
+	WITH RECURSIVE split(chat_id, username, rest) AS (
+		SELECT id, '', REPLACE(participantsUsernames, ' ', '') || ',' FROM chats
+		UNION ALL
+		SELECT chat_id, substr(rest, 1, instr(rest, ',') - 1), substr(rest, instr(rest, ',') + 1)
+		FROM split WHERE rest != ''
+	)
+	INSERT OR IGNORE INTO chat_members(chat_id, username)
+	SELECT chat_id, username FROM split WHERE username != '';
+	UPDATE chat_members SET role = 'owner'
+	WHERE rowid IN (SELECT MIN(rowid) FROM chat_members GROUP BY chat_id);
+	`,
+	// 7: chat membership can change after creation. chat_members is the only
+	// source of truth now, so the chats table is rebuilt without the UNIQUE
+	// constraint on participantsUsernames, which is no longer written. Messages
+	// get a kind, to tell system messages apart.
+	`
+	CREATE TABLE chats_new(
+	id INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	messages TEXT,
+	participantsUsernames TEXT NOT NULL DEFAULT '',
+	numberOfParticipants INTEGER);
+	INSERT INTO chats_new(id, name, messages, participantsUsernames, numberOfParticipants)
+	SELECT id, name, messages, participantsUsernames, numberOfParticipants FROM chats;
+	DROP TABLE chats;
+	ALTER TABLE chats_new RENAME TO chats;
+	ALTER TABLE messages ADD COLUMN kind TEXT NOT NULL DEFAULT 'user';
+	`,
+	// 8: chat invite links. max_uses 0 means unlimited, a NULL expires_at never
+	// expires.
+	`
+	CREATE TABLE IF NOT EXISTS chat_invites(
+	id INTEGER PRIMARY KEY,
+	chat_id INTEGER NOT NULL,
+	token_hash TEXT NOT NULL UNIQUE,
+	created_by TEXT NOT NULL,
+	expires_at DATETIME,
+	max_uses INTEGER NOT NULL DEFAULT 0,
+	uses INTEGER NOT NULL DEFAULT 0,
+	revoked INTEGER NOT NULL DEFAULT 0,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP);
+	CREATE INDEX IF NOT EXISTS idx_chat_invites_chat_id ON chat_invites(chat_id);
+	`,
+	// 9: chat metadata. SQLite can't add a column defaulting to
+	// CURRENT_TIMESTAMP, so created_at stays NULL for older chats, and their
+	// created_by is taken from the first owner, which is the guess made in 6.
+	`
+	ALTER TABLE chats ADD COLUMN description TEXT NOT NULL DEFAULT '';
+	ALTER TABLE chats ADD COLUMN topic TEXT NOT NULL DEFAULT '';
+	ALTER TABLE chats ADD COLUMN avatar TEXT NOT NULL DEFAULT '';
+	ALTER TABLE chats ADD COLUMN created_by TEXT NOT NULL DEFAULT '';
+	ALTER TABLE chats ADD COLUMN created_at DATETIME;
+	UPDATE chats SET created_by = COALESCE((SELECT username FROM chat_members
+	WHERE chat_id = chats.id AND role = 'owner' ORDER BY rowid LIMIT 1), '');
+	`,
+	// 10: chat kinds. dm_key holds the sorted usernames of a direct chat, so
+	// that there is only one per pair. Existing chats stay groups.
+	`
+	ALTER TABLE chats ADD COLUMN kind TEXT NOT NULL DEFAULT 'group';
+	ALTER TABLE chats ADD COLUMN dm_key TEXT;
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_chats_dm_key ON chats(dm_key);
+	`,
+	// 11: public channels, which anyone can find and join.
+	`
+	ALTER TABLE chats ADD COLUMN public INTEGER NOT NULL DEFAULT 0;
+	CREATE INDEX IF NOT EXISTS idx_chats_kind ON chats(kind, public);
+	`,
+	// 12: pinned messages.
+	`
+	CREATE TABLE IF NOT EXISTS chat_pins(
+	chat_id INTEGER NOT NULL,
+	message_id INTEGER NOT NULL,
+	pinned_by TEXT NOT NULL,
+	pinned_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY(chat_id, message_id));
+	`,
+	// 13: @mentions of chat members.
+	`
+	CREATE TABLE IF NOT EXISTS mentions(
+	message_id INTEGER NOT NULL,
+	chat_id INTEGER NOT NULL,
+	username TEXT NOT NULL,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY(message_id, username));
+	CREATE INDEX IF NOT EXISTS idx_mentions_username ON mentions(username);
+	`,
+	// 14: file attachments. The contents are in the blob store under blob_key.
+	`
+	CREATE TABLE IF NOT EXISTS attachments(
+	id INTEGER PRIMARY KEY,
+	message_id INTEGER NOT NULL,
+	chat_id INTEGER NOT NULL,
+	blob_key TEXT NOT NULL UNIQUE,
+	filename TEXT NOT NULL,
+	content_type TEXT NOT NULL,
+	size INTEGER NOT NULL,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP);
+	CREATE INDEX IF NOT EXISTS idx_attachments_chat_id ON attachments(chat_id, message_id);
+	`,
+	// 15: image dimensions and thumbnails.
+	`
+	ALTER TABLE attachments ADD COLUMN width INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE attachments ADD COLUMN height INTEGER NOT NULL DEFAULT 0;
+	CREATE TABLE IF NOT EXISTS attachment_thumbnails(
+	attachment_id INTEGER NOT NULL,
+	size INTEGER NOT NULL,
+	width INTEGER NOT NULL,
+	height INTEGER NOT NULL,
+	blob_key TEXT NOT NULL UNIQUE,
+	content_type TEXT NOT NULL,
+	PRIMARY KEY(attachment_id, size));
+	`,
+	// 16: blobs of deleted chats, which msgServer deletes from the blob store.
+	`
+	CREATE TABLE IF NOT EXISTS orphaned_blobs(
+	blob_key TEXT PRIMARY KEY,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP);
+	`,
+	// 17: the time step of the last TOTP code accepted, so no code is
+	// accepted twice.
+	`
+	ALTER TABLE users ADD COLUMN totp_last_counter INTEGER NOT NULL DEFAULT 0;
+	`,
+}
+
+func migrate(db *sql.DB) error {
+	const op = "storage.sqlite.migrate"
+
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS schema_migrations(
+	version INTEGER PRIMARY KEY);
+	`)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	var current int
+	err = db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	for i := current; i < len(migrations); i++ {
+		version := i + 1
+
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("%s: migration %d: %w", op, version, err)
+		}
+
+		if _, err := tx.Exec("INSERT INTO schema_migrations(version) VALUES(?)", version); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("%s: migration %d: %w", op, version, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("%s: migration %d: %w", op, version, err)
+		}
+	}
+
+	return nil
+}
+
+// CheckMigrations returns an error when the database is behind the migrations
+// of this build, for example after a failed migration.
+func (s *Storage) CheckMigrations(ctx context.Context) (err error) {
+	const op = "storage.sqlite.CheckMigrations"
+	defer observe(ctx, "CheckMigrations")(&err)
+
+	var current int
+	err = s.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if current < len(migrations) {
+		return fmt.Errorf("%s: database is at version %d of %d", op, current, len(migrations))
+	}
+
+	return nil
+}
@@ -0,0 +1,195 @@
+package sqlite
+
+import (
+	"chat_go/internal/lib/api/models"
+	"chat_go/internal/storage"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+func (s *Storage) GetUserByID(ctx context.Context, id int64) (_ models.User, err error) {
+	const op = "storage.sqlite.GetUserByID"
+	defer observe(ctx, "GetUserByID")(&err)
+
+	var user models.User
+
+	err = s.db.QueryRow("SELECT username, nickname, bio FROM users WHERE id = ?", id).
+		Scan(&user.Username, &user.Nickname, &user.Bio)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.User{}, storage.ErrUserNotFound
+	}
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	return user, nil
+}
+
+// SaveOAuthClient registers a relying party. Public clients have an empty secret.
+func (s *Storage) SaveOAuthClient(ctx context.Context, client models.OAuthClient, secret string) (err error) {
+	const op = "storage.sqlite.SaveOAuthClient"
+	defer observe(ctx, "SaveOAuthClient")(&err)
+
+	secretHash := ""
+	if secret != "" {
+		secretHash = hashOAuthSecret(secret)
+	}
+
+	_, err = s.db.Exec(
+		"INSERT INTO oauth_clients(client_id, secret_hash, name, redirect_uris) VALUES(?, ?, ?, ?)",
+		client.ClientID, secretHash, client.Name, strings.Join(client.RedirectURIs, "\n"),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) GetOAuthClient(ctx context.Context, clientID string) (_ models.OAuthClient, err error) {
+	const op = "storage.sqlite.GetOAuthClient"
+	defer observe(ctx, "GetOAuthClient")(&err)
+
+	var secretHash, redirectURIs string
+	client := models.OAuthClient{ClientID: clientID}
+
+	err = s.db.QueryRow(
+		"SELECT secret_hash, name, redirect_uris FROM oauth_clients WHERE client_id = ?", clientID,
+	).Scan(&secretHash, &client.Name, &redirectURIs)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.OAuthClient{}, storage.ErrClientNotFound
+	}
+	if err != nil {
+		return models.OAuthClient{}, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	client.RedirectURIs = strings.Split(redirectURIs, "\n")
+	client.Confidential = secretHash != ""
+
+	return client, nil
+}
+
+// CheckOAuthClientSecret reports whether secret belongs to a confidential client.
+func (s *Storage) CheckOAuthClientSecret(ctx context.Context, clientID string, secret string) (_ bool, err error) {
+	const op = "storage.sqlite.CheckOAuthClientSecret"
+	defer observe(ctx, "CheckOAuthClientSecret")(&err)
+
+	var secretHash string
+
+	err = s.db.QueryRow("SELECT secret_hash FROM oauth_clients WHERE client_id = ?", clientID).Scan(&secretHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, storage.ErrClientNotFound
+	}
+	if err != nil {
+		return false, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+	if secretHash == "" {
+		return false, nil
+	}
+
+	return subtle.ConstantTimeCompare([]byte(secretHash), []byte(hashOAuthSecret(secret))) == 1, nil
+}
+
+// GetConsent returns the scope the user has already granted to the client, or
+// an empty string.
+func (s *Storage) GetConsent(ctx context.Context, userID int64, clientID string) (_ string, err error) {
+	const op = "storage.sqlite.GetConsent"
+	defer observe(ctx, "GetConsent")(&err)
+
+	var scope string
+
+	err = s.db.QueryRow(
+		"SELECT scope FROM oauth_consents WHERE user_id = ? AND client_id = ?", userID, clientID,
+	).Scan(&scope)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	return scope, nil
+}
+
+func (s *Storage) SaveConsent(ctx context.Context, userID int64, clientID string, scope string) (err error) {
+	const op = "storage.sqlite.SaveConsent"
+	defer observe(ctx, "SaveConsent")(&err)
+
+	_, err = s.db.Exec(`
+	INSERT INTO oauth_consents(user_id, client_id, scope) VALUES(?, ?, ?)
+	ON CONFLICT(user_id, client_id) DO UPDATE SET scope = excluded.scope
+	`, userID, clientID, scope)
+	if err != nil {
+		return fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) SaveAuthorizationCode(ctx context.Context, code string, authCode models.AuthorizationCode) (err error) {
+	const op = "storage.sqlite.SaveAuthorizationCode"
+	defer observe(ctx, "SaveAuthorizationCode")(&err)
+
+	_, err = s.db.Exec(`
+	INSERT INTO oauth_codes(code_hash, client_id, user_id, redirect_uri, scope, nonce, code_challenge, expires_at)
+	VALUES(?, ?, ?, ?, ?, ?, ?, ?)
+	`, hashOAuthSecret(code), authCode.ClientID, authCode.UserID, authCode.RedirectURI,
+		authCode.Scope, authCode.Nonce, authCode.CodeChallenge, authCode.ExpiresAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	return nil
+}
+
+// UseAuthorizationCode redeems a code. A code can be redeemed only once.
+func (s *Storage) UseAuthorizationCode(ctx context.Context, code string) (_ models.AuthorizationCode, err error) {
+	const op = "storage.sqlite.UseAuthorizationCode"
+	defer observe(ctx, "UseAuthorizationCode")(&err)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return models.AuthorizationCode{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var id int64
+	var authCode models.AuthorizationCode
+
+	err = tx.QueryRow(`
+	SELECT id, client_id, user_id, redirect_uri, scope, nonce, code_challenge, expires_at
+	FROM oauth_codes WHERE code_hash = ? AND used = 0 AND expires_at > ?
+	`, hashOAuthSecret(code), time.Now().UTC()).Scan(
+		&id, &authCode.ClientID, &authCode.UserID, &authCode.RedirectURI,
+		&authCode.Scope, &authCode.Nonce, &authCode.CodeChallenge, &authCode.ExpiresAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.AuthorizationCode{}, storage.ErrInvalidAuthorizationCode
+	}
+	if err != nil {
+		return models.AuthorizationCode{}, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	if _, err := tx.Exec("UPDATE oauth_codes SET used = 1 WHERE id = ?", id); err != nil {
+		return models.AuthorizationCode{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.AuthorizationCode{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return authCode, nil
+}
+
+func hashOAuthSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,42 @@
+package sqlite
+
+import (
+	"chat_go/internal/lib/metrics"
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("chat_go/internal/storage/sqlite")
+
+// observe records a storage call. It starts a span when ctx is part of a
+// trace, and the returned func ends it, with the error the call returned, and
+// records the duration:
+//
+//	defer observe(ctx, "GetUser")(&err)
+func observe(ctx context.Context, method string) func(err *error) {
+	start := time.Now()
+
+	var span trace.Span
+	if trace.SpanContextFromContext(ctx).IsValid() {
+		_, span = tracer.Start(ctx, "storage."+method,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attribute.String("db.system", "sqlite")),
+		)
+	}
+
+	return func(err *error) {
+		if span != nil {
+			if *err != nil {
+				span.RecordError(*err)
+				span.SetStatus(codes.Error, (*err).Error())
+			}
+			span.End()
+		}
+		metrics.ObserveQuery(method, start)
+	}
+}
@@ -0,0 +1,52 @@
+package sqlite_test
+
+import (
+	"chat_go/internal/storage"
+	"chat_go/internal/storage/sqlite"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestSpansRecordErrors(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	st, err := sqlite.New(filepath.Join(t.TempDir(), "chat.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+
+	ctx, span := provider.Tracer("test").Start(context.Background(), "request")
+	if _, err := st.GetUser(ctx, "@nobody"); !errors.Is(err, storage.ErrUserNotFound) {
+		t.Fatalf("got %v, want ErrUserNotFound", err)
+	}
+	if _, err := st.SaveUser(ctx, "bio", "Passw0rd!x", "Alice", "@alice", ""); err != nil {
+		t.Fatal(err)
+	}
+	span.End()
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, s := range recorder.Ended() {
+		spans[s.Name()] = s
+	}
+
+	failed := spans["storage.GetUser"]
+	if failed == nil || failed.Status().Code != codes.Error || len(failed.Events()) != 1 {
+		t.Fatalf("storage.GetUser span: %+v", failed)
+	}
+	saved := spans["storage.SaveUser"]
+	if saved == nil || saved.Status().Code != codes.Unset || len(saved.Events()) != 0 {
+		t.Fatalf("storage.SaveUser span: %+v", saved)
+	}
+}
@@ -0,0 +1,191 @@
+package sqlite
+
+import (
+	"chat_go/internal/lib/password"
+	"chat_go/internal/storage"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+func (s *Storage) GetSessionVersion(ctx context.Context, userID int64) (_ int64, err error) {
+	const op = "storage.sqlite.GetSessionVersion"
+	defer observe(ctx, "GetSessionVersion")(&err)
+
+	var version int64
+
+	err = s.db.QueryRow("SELECT session_version FROM users WHERE id = ?", userID).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, storage.ErrUserNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	return version, nil
+}
+
+// ChangePassword replaces the password after checking the old one and revokes
+// all sessions of the user. It returns the new session version.
+func (s *Storage) ChangePassword(ctx context.Context, userID int64, oldPassword string, newPassword string) (_ int64, err error) {
+	const op = "storage.sqlite.ChangePassword"
+	defer observe(ctx, "ChangePassword")(&err)
+
+	var hash string
+
+	err = s.db.QueryRow("SELECT password FROM users WHERE id = ?", userID).Scan(&hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, storage.ErrUserNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	ok, _, err := password.Verify(hash, oldPassword)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if !ok {
+		return 0, storage.ErrInvalidLoginOrPassword
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	version, err := setPassword(tx, userID, newPassword)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return version, nil
+}
+
+// SavePasswordResetToken stores a single-use reset token for the user and
+// returns the email address it should be delivered to.
+func (s *Storage) SavePasswordResetToken(ctx context.Context, username string, token string, expiresAt time.Time) (_ string, err error) {
+	const op = "storage.sqlite.SavePasswordResetToken"
+	defer observe(ctx, "SavePasswordResetToken")(&err)
+
+	var userID int64
+	var email string
+
+	err = s.db.QueryRow("SELECT id, email FROM users WHERE username = ?", username).Scan(&userID, &email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", storage.ErrUserNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	_, err = s.db.Exec(
+		"INSERT INTO password_resets(user_id, token_hash, expires_at) VALUES(?, ?, ?)",
+		userID, hashResetToken(token), expiresAt.UTC(),
+	)
+	if err != nil {
+		return "", fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	return email, nil
+}
+
+// ResetPassword sets a new password using a reset token, marks the token as
+// used and revokes all sessions of the user.
+func (s *Storage) ResetPassword(ctx context.Context, token string, newPassword string) (err error) {
+	const op = "storage.sqlite.ResetPassword"
+	defer observe(ctx, "ResetPassword")(&err)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var resetID, userID int64
+
+	err = tx.QueryRow(
+		"SELECT id, user_id FROM password_resets WHERE token_hash = ? AND used = 0 AND expires_at > ?",
+		hashResetToken(token), time.Now().UTC(),
+	).Scan(&resetID, &userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.ErrInvalidResetToken
+	}
+	if err != nil {
+		return fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	if _, err := tx.Exec("UPDATE password_resets SET used = 1 WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := setPassword(tx, userID, newPassword); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// setPassword stores the hash of password and bumps the session version, so
+// tokens issued before the change stop working.
+func setPassword(tx *sql.Tx, userID int64, pswrd string) (int64, error) {
+	hashedPswrd, err := password.Hash(pswrd)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(
+		"UPDATE users SET password = ?, session_version = session_version + 1 WHERE id = ?",
+		hashedPswrd, userID,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	var version int64
+	if err := tx.QueryRow("SELECT session_version FROM users WHERE id = ?", userID).Scan(&version); err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetUsernameByResetToken returns the owner of a valid reset token.
+func (s *Storage) GetUsernameByResetToken(ctx context.Context, token string) (_ string, err error) {
+	const op = "storage.sqlite.GetUsernameByResetToken"
+	defer observe(ctx, "GetUsernameByResetToken")(&err)
+
+	var username string
+
+	err = s.db.QueryRow(`
+	SELECT users.username FROM password_resets
+	JOIN users ON users.id = password_resets.user_id
+	WHERE password_resets.token_hash = ? AND password_resets.used = 0 AND password_resets.expires_at > ?
+	`, hashResetToken(token), time.Now().UTC()).Scan(&username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", storage.ErrInvalidResetToken
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	return username, nil
+}
@@ -0,0 +1,111 @@
+package sqlite
+
+import (
+	"chat_go/internal/lib/api/models"
+	"chat_go/internal/storage"
+	"context"
+	"fmt"
+	"time"
+)
+
+// PinMessage pins a message of the chat, unless limit messages are pinned
+// already. It reports false if the message was pinned before.
+func (s *Storage) PinMessage(ctx context.Context, chatID int64, messageID int64, pinnedBy string, limit int) (_ bool, err error) {
+	const op = "storage.sqlite.PinMessage"
+	defer observe(ctx, "PinMessage")(&err)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var exists, pinned bool
+	var count int
+
+	err = tx.QueryRow(`
+	SELECT
+	EXISTS(SELECT 1 FROM messages WHERE id = ? AND chatID = ?),
+	EXISTS(SELECT 1 FROM chat_pins WHERE chat_id = ? AND message_id = ?),
+	(SELECT COUNT(*) FROM chat_pins WHERE chat_id = ?)
+	`, messageID, chatID, chatID, messageID, chatID).Scan(&exists, &pinned, &count)
+	if err != nil {
+		return false, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+	if !exists {
+		return false, storage.ErrMessageNotFound
+	}
+	if pinned {
+		return false, nil
+	}
+	if count >= limit {
+		return false, storage.ErrTooManyPins
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO chat_pins(chat_id, message_id, pinned_by, pinned_at) VALUES(?, ?, ?, ?)",
+		chatID, messageID, pinnedBy, time.Now().UTC(),
+	)
+	if err != nil {
+		return false, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return true, nil
+}
+
+func (s *Storage) UnpinMessage(ctx context.Context, chatID int64, messageID int64) (err error) {
+	const op = "storage.sqlite.UnpinMessage"
+	defer observe(ctx, "UnpinMessage")(&err)
+
+	res, err := s.db.Exec("DELETE FROM chat_pins WHERE chat_id = ? AND message_id = ?", chatID, messageID)
+	if err != nil {
+		return fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return storage.ErrPinNotFound
+	}
+
+	return nil
+}
+
+// GetPins returns the pinned messages of the chat in the order they were pinned.
+func (s *Storage) GetPins(ctx context.Context, chatID int64) (_ []models.Pin, err error) {
+	const op = "storage.sqlite.GetPins"
+	defer observe(ctx, "GetPins")(&err)
+
+	rows, err := s.db.Query(`
+	SELECT p.message_id, m.sender, m.text, p.pinned_by, p.pinned_at
+	FROM chat_pins p JOIN messages m ON m.id = p.message_id
+	WHERE p.chat_id = ?
+	ORDER BY p.pinned_at, p.rowid
+	`, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	pins := []models.Pin{}
+
+	for rows.Next() {
+		var p models.Pin
+		if err := rows.Scan(&p.MessageID, &p.Sender, &p.Text, &p.PinnedBy, &p.PinnedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		pins = append(pins, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return pins, nil
+}
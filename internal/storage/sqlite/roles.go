@@ -0,0 +1,135 @@
+package sqlite
+
+import (
+	"chat_go/internal/lib/api/models"
+	"chat_go/internal/lib/jwts"
+	"chat_go/internal/storage"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// GetClaims returns what a fresh auth token for the user should carry.
+func (s *Storage) GetClaims(ctx context.Context, userID int64) (_ jwts.Claims, err error) {
+	const op = "storage.sqlite.GetClaims"
+	defer observe(ctx, "GetClaims")(&err)
+
+	claims := jwts.Claims{UserID: userID}
+	var suspended bool
+
+	err = s.db.QueryRow("SELECT username, session_version, role, suspended FROM users WHERE id = ?", userID).
+		Scan(&claims.Username, &claims.SessionVersion, &claims.Role, &suspended)
+	if errors.Is(err, sql.ErrNoRows) {
+		return jwts.Claims{}, storage.ErrUserNotFound
+	}
+	if err != nil {
+		return jwts.Claims{}, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+	if suspended {
+		return jwts.Claims{}, storage.ErrUserSuspended
+	}
+
+	return claims, nil
+}
+
+func (s *Storage) ListUsers(ctx context.Context, limit int, offset int) (_ []models.Account, err error) {
+	const op = "storage.sqlite.ListUsers"
+	defer observe(ctx, "ListUsers")(&err)
+
+	rows, err := s.db.Query(
+		"SELECT id, username, nickname, role, suspended FROM users ORDER BY id LIMIT ? OFFSET ?", limit, offset,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	accounts := []models.Account{}
+
+	for rows.Next() {
+		var a models.Account
+		if err := rows.Scan(&a.ID, &a.Username, &a.Nickname, &a.Role, &a.Suspended); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		accounts = append(accounts, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return accounts, nil
+}
+
+func (s *Storage) GetRole(ctx context.Context, username string) (_ string, err error) {
+	const op = "storage.sqlite.GetRole"
+	defer observe(ctx, "GetRole")(&err)
+
+	var role string
+
+	err = s.db.QueryRow("SELECT role FROM users WHERE username = ?", username).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", storage.ErrUserNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	return role, nil
+}
+
+// SetRole changes the user's global role. The user's sessions are revoked,
+// because their tokens still carry the old role.
+func (s *Storage) SetRole(ctx context.Context, username string, role string) (err error) {
+	const op = "storage.sqlite.SetRole"
+	defer observe(ctx, "SetRole")(&err)
+
+	res, err := s.db.Exec(
+		"UPDATE users SET role = ?, session_version = session_version + 1 WHERE username = ? AND role != ?",
+		role, username, role,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		// Either the user doesn't exist or already has the role.
+		if _, err := s.GetRole(ctx, username); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SetSuspended suspends or reinstates the user. Suspending revokes all of the
+// user's sessions.
+func (s *Storage) SetSuspended(ctx context.Context, username string, suspended bool) (err error) {
+	const op = "storage.sqlite.SetSuspended"
+	defer observe(ctx, "SetSuspended")(&err)
+
+	q := "UPDATE users SET suspended = 0 WHERE username = ?"
+	if suspended {
+		q = "UPDATE users SET suspended = 1, session_version = session_version + 1 WHERE username = ?"
+	}
+
+	res, err := s.db.Exec(q, username)
+	if err != nil {
+		return fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return storage.ErrUserNotFound
+	}
+
+	return nil
+}
@@ -2,21 +2,30 @@ package sqlite
 
 import (
 	"chat_go/internal/lib/api/models"
+	"chat_go/internal/lib/chatrole"
 	"chat_go/internal/lib/jwts"
+	"chat_go/internal/lib/password"
 	"chat_go/internal/storage"
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/mattn/go-sqlite3"
 	_ "github.com/mattn/go-sqlite3"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type Storage struct {
 	db *sql.DB
 }
 
+// dummyHash is compared against when the user does not exist, so a login for an
+// unknown username takes as long as one with a wrong password.
+var dummyHash, _ = password.Hash("dummy password")
+
 type User struct {
 	models.User
 	password string
@@ -26,7 +35,7 @@ type User struct {
 func New(storagePath string) (*Storage, error) {
 	const op = "storage.sqlite.New"
 
-	db, err := sql.Open("sqlite3", "./storage/chat.db")
+	db, err := sql.Open("sqlite3", storagePath)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
@@ -67,23 +76,56 @@ func New(storagePath string) (*Storage, error) {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
+	if err := migrate(db); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
 	return &Storage{db: db}, nil
 }
 
-func (s *Storage) SaveUser(bio string, password string, nickname string, username string) (int64, error) {
+// Ping checks that the database answers.
+func (s *Storage) Ping(ctx context.Context) (err error) {
+	const op = "storage.sqlite.Ping"
+	defer observe(ctx, "Ping")(&err)
+
+	if err := s.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Stats returns the connection pool stats of the database.
+func (s *Storage) Stats() sql.DBStats {
+	return s.db.Stats()
+}
+
+// Close closes the database. Nothing may use the storage after it.
+func (s *Storage) Close() error {
+	const op = "storage.sqlite.Close"
+
+	if err := s.db.Close(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) SaveUser(ctx context.Context, bio string, pswrd string, nickname string, username string, email string) (_ int64, err error) {
 	const op = "storage.sqlite.SaveUser"
+	defer observe(ctx, "SaveUser")(&err)
 
-	stmt, err := s.db.Prepare("INSERT INTO users(nickname, username, password, bio) VALUES(?, ?, ?, ?)")
+	stmt, err := s.db.Prepare("INSERT INTO users(nickname, username, password, bio, email) VALUES(?, ?, ?, ?, ?)")
 	if err != nil {
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
 
-	hashedPswrd, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPswrd, err := password.Hash(pswrd)
 	if err != nil {
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
 
-	res, err := stmt.Exec(nickname, username, hashedPswrd, bio)
+	res, err := stmt.Exec(nickname, username, hashedPswrd, bio, email)
 	if err != nil {
 		if sqliteErr, ok := err.(sqlite3.Error); ok && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
 			return 0, fmt.Errorf("%s: %w", op, storage.ErrUserAlreadyExists)
@@ -99,8 +141,9 @@ func (s *Storage) SaveUser(bio string, password string, nickname string, usernam
 	return id, nil
 }
 
-func (s *Storage) GetUser(username string) (models.User, error) {
+func (s *Storage) GetUser(ctx context.Context, username string) (_ models.User, err error) {
 	const op = "storage.sqlite.GetChat"
+	defer observe(ctx, "GetUser")(&err)
 
 	stmt, err := s.db.Prepare("SELECT bio, nickname FROM users WHERE username = ?")
 	if err != nil {
@@ -126,8 +169,9 @@ func (s *Storage) GetUser(username string) (models.User, error) {
 	return user, nil
 }
 
-func (s *Storage) GetNicknameByUsername(username string) (string, error) {
+func (s *Storage) GetNicknameByUsername(ctx context.Context, username string) (_ string, err error) {
 	const op = "storage.sqlite.GetNicknameByUsername"
+	defer observe(ctx, "GetNicknameByUsername")(&err)
 
 	stmt, err := s.db.Prepare("SELECT nickname FROM users WHERE username = ?")
 	if err != nil {
@@ -147,55 +191,179 @@ func (s *Storage) GetNicknameByUsername(username string) (string, error) {
 	return nickname, nil
 }
 
-func (s *Storage) DeleteUser(username string) error {
+// MissingUsers returns the usernames that don't belong to any account, in the
+// order they were given.
+func (s *Storage) MissingUsers(ctx context.Context, usernames []string) (_ []string, err error) {
+	const op = "storage.sqlite.MissingUsers"
+	defer observe(ctx, "MissingUsers")(&err)
+
+	if len(usernames) == 0 {
+		return nil, nil
+	}
+
+	args := make([]any, len(usernames))
+	for i, username := range usernames {
+		args[i] = username
+	}
+
+	rows, err := s.db.Query(
+		"SELECT username FROM users WHERE username IN (?"+strings.Repeat(", ?", len(usernames)-1)+")", args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+	defer rows.Close()
+
+	found := map[string]bool{}
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		found[username] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var missing []string
+	for _, username := range usernames {
+		if !found[username] && !slices.Contains(missing, username) {
+			missing = append(missing, username)
+		}
+	}
+
+	return missing, nil
+}
+
+// DeleteUser removes the user together with everything stored under the user's
+// id, so a later account that reuses the id doesn't inherit any of it.
+func (s *Storage) DeleteUser(ctx context.Context, username string) (err error) {
 	const op = "storage.sqlite.DeleteUser"
+	defer observe(ctx, "DeleteUser")(&err)
 
-	stmt, err := s.db.Prepare("DELETE FROM users WHERE username = ?")
+	tx, err := s.db.Begin()
 	if err != nil {
-		return fmt.Errorf("%s: prepare statement: %w", op, err)
+		return fmt.Errorf("%s: %w", op, err)
 	}
+	defer tx.Rollback()
+
+	var id int64
 
-	_, err = stmt.Exec(username)
+	err = tx.QueryRow("SELECT id FROM users WHERE username = ?", username).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.ErrUserNotFound
+	}
 	if err != nil {
-		return fmt.Errorf("%s: execute statemnet %w", op, err)
+		return fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	for _, q := range []string{
+		"DELETE FROM recovery_codes WHERE user_id = ?",
+		"DELETE FROM password_resets WHERE user_id = ?",
+		"DELETE FROM oauth_codes WHERE user_id = ?",
+		"DELETE FROM oauth_consents WHERE user_id = ?",
+		"DELETE FROM users WHERE id = ?",
+	} {
+		if _, err := tx.Exec(q, id); err != nil {
+			return fmt.Errorf("%s: execute statement: %w", op, err)
+		}
+	}
+
+	if err := leaveAllChats(tx, username); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
 	return nil
 }
 
-func (s *Storage) LoginUser(username, password string) (string, error) {
+// LoginUser checks the credentials and returns an auth token. When the user has
+// two-factor authentication enabled, the returned token is an mfa pending token
+// and mfaPending is true.
+func (s *Storage) LoginUser(ctx context.Context, username, pswrd string) (_ string, _ bool, err error) {
+	defer observe(ctx, "LoginUser")(&err)
 
 	q := `
-	SELECT id, password FROM users WHERE username = ?
+	SELECT id, password, totp_enabled, session_version, role, suspended FROM users WHERE username = ?
 	`
 	var user User
+	var totpEnabled, suspended bool
+	var sessionVersion int64
+	var role string
 
-	err := s.db.QueryRow(q, username).Scan(&user.id, &user.password)
+	err = s.db.QueryRow(q, username).Scan(&user.id, &user.password, &totpEnabled, &sessionVersion, &role, &suspended)
+	if errors.Is(err, sql.ErrNoRows) {
+		password.Verify(dummyHash, pswrd)
+		return "", false, storage.ErrInvalidLoginOrPassword
+	}
 	if err != nil {
-		return "", err
+		return "", false, err
 	}
-	err = bcrypt.CompareHashAndPassword([]byte(user.password), []byte(password))
+	ok, needsRehash, err := password.Verify(user.password, pswrd)
 	if err != nil {
-		return "", err
+		return "", false, err
+	}
+	if !ok {
+		return "", false, storage.ErrInvalidLoginOrPassword
+	}
+
+	// Checked only after the password, so suspension doesn't reveal which
+	// usernames exist.
+	if suspended {
+		return "", false, storage.ErrUserSuspended
+	}
+
+	if needsRehash {
+		// A failed upgrade must not fail the login, the old hash still works.
+		if hash, err := password.Hash(pswrd); err == nil {
+			s.db.Exec("UPDATE users SET password = ? WHERE id = ?", hash, user.id)
+		}
 	}
 
-	token, err := jwts.GenerateJWTToken(user.id)
+	if totpEnabled {
+		token, err := jwts.GenerateMFAPendingToken(user.id)
+		if err != nil {
+			return "", false, err
+		}
+
+		return token, true, nil
+	}
+
+	token, err := jwts.GenerateJWTToken(jwts.Claims{UserID: user.id, Username: username, SessionVersion: sessionVersion, Role: role})
 	if err != nil {
-		return "", err
+		return "", false, err
 	}
 
-	return token, nil
+	return token, false, nil
 }
 
-func (s *Storage) MakeChat(name string, usernames string) (int64, error) {
+// MakeChat creates a chat with owner as its owner and members as its other
+// members.
+func (s *Storage) MakeChat(ctx context.Context, name string, kind string, public bool, owner string, members []string) (_ int64, err error) {
 	const op = "storage.sqlite.MakeChat"
+	defer observe(ctx, "MakeChat")(&err)
 
-	stmt, err := s.db.Prepare("INSERT INTO chats(name, participantsUsernames) VALUES(?,	 ?)")
+	usernames := []string{owner}
+	for _, m := range members {
+		if m != owner && !slices.Contains(usernames, m) {
+			usernames = append(usernames, m)
+		}
+	}
+
+	tx, err := s.db.Begin()
 	if err != nil {
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
+	defer tx.Rollback()
 
-	res, err := stmt.Exec(name, usernames)
+	res, err := tx.Exec(
+		"INSERT INTO chats(name, kind, public, created_by, created_at) VALUES(?, ?, ?, ?, ?)",
+		name, kind, public, owner, time.Now().UTC(),
+	)
 	if err != nil {
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
@@ -205,10 +373,26 @@ func (s *Storage) MakeChat(name string, usernames string) (int64, error) {
 		return 0, fmt.Errorf("%s: failed to get last insert id: %w", op, err)
 	}
 
+	for i, username := range usernames {
+		role := chatrole.Member
+		if i == 0 {
+			role = chatrole.Owner
+		}
+		_, err := tx.Exec("INSERT INTO chat_members(chat_id, username, role) VALUES(?, ?, ?)", id, username, role)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
 	return id, nil
 }
 
-func (s *Storage) GetAllMessagesByChatName(chatName string) ([]models.Message, error) {
+func (s *Storage) GetAllMessagesByChatName(ctx context.Context, chatName string) (_ []models.Message, err error) {
+	defer observe(ctx, "GetAllMessagesByChatName")(&err)
 
 	var (
 		messages []models.Message
@@ -234,10 +418,17 @@ func (s *Storage) GetAllMessagesByChatName(chatName string) ([]models.Message, e
 	return messages, nil
 }
 
-func (s *Storage) GetParticipantsByChatNameAndID(chatName string, id int64) (string, error) {
+// GetParticipantsByChatNameAndID returns the usernames of the chat's members,
+// separated by ", ".
+func (s *Storage) GetParticipantsByChatNameAndID(ctx context.Context, chatName string, id int64) (_ string, err error) {
 	const op = "storage.sqlite.GetParticipantsByChatNameAndID"
+	defer observe(ctx, "GetParticipantsByChatNameAndID")(&err)
 
-	stmt, err := s.db.Prepare("SELECT participantsUsernames FROM chats WHERE name = ? AND id = ?")
+	stmt, err := s.db.Prepare(`
+	SELECT COALESCE((SELECT group_concat(username, ', ') FROM
+	(SELECT username FROM chat_members WHERE chat_id = chats.id ORDER BY rowid)), '')
+	FROM chats WHERE name = ? AND id = ?
+	`)
 	if err != nil {
 		return "", fmt.Errorf("%s: prepare statement: %w", op, err)
 	}
@@ -255,8 +446,9 @@ func (s *Storage) GetParticipantsByChatNameAndID(chatName string, id int64) (str
 	return participants, nil
 }
 
-func (s *Storage) SaveMessage(sender string, chatName string, chatID int64, text string) (int64, error) {
+func (s *Storage) SaveMessage(ctx context.Context, sender string, chatName string, chatID int64, text string) (_ int64, err error) {
 	const op = "storage.sqlite.SaveMessage"
+	defer observe(ctx, "SaveMessage")(&err)
 
 	stmt, err := s.db.Prepare("INSERT INTO messages(sender, chatName, chatID, text) VALUES(?, ?, ?, ?)")
 	if err != nil {
@@ -276,8 +468,9 @@ func (s *Storage) SaveMessage(sender string, chatName string, chatID int64, text
 	return id, nil
 }
 
-func (s *Storage) GetSenderOfMessageByChatName(chatName string) (string, error) {
+func (s *Storage) GetSenderOfMessageByChatName(ctx context.Context, chatName string) (_ string, err error) {
 	const op = "storage.sqlite.GetSenderOfMessageByChatName"
+	defer observe(ctx, "GetSenderOfMessageByChatName")(&err)
 
 	stmt, err := s.db.Prepare("SELECT sender FROM messages WHERE chatName = ?")
 	if err != nil {
@@ -297,10 +490,11 @@ func (s *Storage) GetSenderOfMessageByChatName(chatName string) (string, error)
 	return sender, nil
 }
 
-func (s *Storage) GetAllMessagesByChatnameAndID(chatName string, id int64) ([]models.Message, error) {
+func (s *Storage) GetAllMessagesByChatnameAndID(ctx context.Context, chatName string, id int64) (_ []models.Message, err error) {
 	const op = "storage.sqlite.GetAllMessagesBySenderAndChatname"
+	defer observe(ctx, "GetAllMessagesByChatnameAndID")(&err)
 
-	stmt, err := s.db.Prepare("SELECT text, sender, id FROM messages WHERE chatName = ? AND chatID = ?")
+	stmt, err := s.db.Prepare("SELECT text, sender, id, kind FROM messages WHERE chatName = ? AND chatID = ? ORDER BY id")
 	if err != nil {
 		return nil, fmt.Errorf("%s: prepare statement: %w", op, err)
 	}
@@ -315,7 +509,7 @@ func (s *Storage) GetAllMessagesByChatnameAndID(chatName string, id int64) ([]mo
 
 	for rows.Next() {
 		msg := models.Message{}
-		err := rows.Scan(&msg.Text, &msg.Sender, &msg.ID)
+		err := rows.Scan(&msg.Text, &msg.Sender, &msg.ID, &msg.Kind)
 		if err != nil {
 			return nil, err
 		}
@@ -11,4 +11,19 @@ var (
 	ErrMessageNotFound = errors.New("message not found")
 	ErrChatNotFound = errors.New("chat not found")
 	ErrChatAlreadyExists = errors.New("chat already exists")
+	ErrMFANotEnrolled = errors.New("mfa not enrolled")
+	ErrMFAAlreadyEnabled = errors.New("mfa already enabled")
+	ErrInvalidRecoveryCode = errors.New("invalid recovery code")
+	ErrTOTPCodeUsed = errors.New("totp code already used")
+	ErrInvalidResetToken = errors.New("invalid or expired reset token")
+	ErrClientNotFound = errors.New("oauth client not found")
+	ErrInvalidAuthorizationCode = errors.New("invalid or expired authorization code")
+	ErrUserSuspended = errors.New("user is suspended")
+	ErrNotChatMember = errors.New("user is not a member of the chat")
+	ErrInviteNotFound = errors.New("invite not found")
+	ErrInvalidInvite = errors.New("invalid, expired or used up invite")
+	ErrDirectChat = errors.New("not allowed in a direct chat")
+	ErrTooManyPins = errors.New("pin limit reached")
+	ErrPinNotFound = errors.New("message is not pinned")
+	ErrAttachmentNotFound = errors.New("attachment not found")
 )
\ No newline at end of file